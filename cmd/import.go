@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 Paul Schwendenman
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <paths...>",
+	Short: "Import log files and archives",
+	Long: `Imports log files from disk into a DuckDB database file.
+
+By default only the ingest pipeline runs: rows are bulk loaded into --db-file
+as fast as possible, indexes are created once loading finishes, and magic-log
+exits so the file can then be opened with 'magic-log server --db-file'. Use
+--serve to start the web interface instead and keep it running after the
+import, in which case --db-file is optional.
+
+Files compressed with gzip, zstd or bzip2 are decompressed automatically and
+tar archives (including .tar.gz and .tar.zst) are walked, so support bundles
+can be imported as-is. Directories are imported recursively. Each file is
+recorded with its path, or its path inside the archive, as the source.
+
+Progress and lines/sec are shown while reading, followed by a summary of how
+many lines were parsed and how many fell back to 'raw'.
+
+Examples:
+  magic-log import --db-file history.duckdb app.log app.log.1.gz
+  magic-log import --db-file access.duckdb --log-format text --regex-preset apache access.log.zst
+  magic-log import --serve support-bundle.tar.gz`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Bind again now that the root flags have been bound in initConfig.
+		viper.BindPFlags(cmd.Flags())
+
+		opts := app.ImportOptions{
+			Paths: args,
+			Serve: viper.GetBool("serve"),
+		}
+		if !opts.Serve && viper.GetString("db-file") == "" {
+			log.Fatalf("❌ --db-file is required unless --serve is used")
+		}
+		app.ImportFiles(loadAppConfig(), opts, staticFiles)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().Bool("serve", false, "Start the web UI and keep it running after the import")
+	importCmd.Flags().String("db-file", "", "Path to a DuckDB database file")
+	importCmd.Flags().Int("port", 3000, "Port to serve the web UI on")
+	importCmd.Flags().Bool("launch", false, "Open the UI in a browser")
+	importCmd.Flags().Bool("echo", false, "Echo parsed output to stdout")
+	importCmd.Flags().Bool("no-auto-analyze", false, "Disable automatic ANALYZE of logs table")
+	importCmd.Flags().Bool("no-templates", false, "Disable grouping messages into templates")
+	importCmd.Flags().String("log-format", "json", "Log format: json, csv, syslog, cri or plain text")
+	importCmd.Flags().String("regex", "", "Custom regex to parse logs (use with text format)")
+	importCmd.Flags().String("regex-preset", "", "Regex preset to use")
+	importCmd.Flags().String("jq", "", "A jq expression to apply to parsed logs")
+	importCmd.Flags().String("jq-preset", "", "jq preset to use")
+	importCmd.Flags().String("csv-fields", "", "Comma-separated field names for CSV logs")
+	importCmd.Flags().Bool("has-csv-header", true, "Whether CSV logs include a header row")
+	importCmd.Flags().String("sampling-preset", "", "Sampling preset to use for noisy logs")
+	importCmd.Flags().Int("buffer-size", 10000, "Number of lines read ahead of parsing and inserting")
+	importCmd.Flags().String("on-full", "block", "What to do with new lines when the buffer is full: block, drop or spill")
+}
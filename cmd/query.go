@@ -0,0 +1,74 @@
+/*
+Copyright © 2025 Paul Schwendenman
+*/
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query <filter...>",
+	Short: "Search a database file with a filter",
+	Long: `Prints the most recent entries in a DuckDB database file that match a
+filter, oldest first, without writing SQL.
+
+A filter is a list of terms that must all match:
+
+  level:error            field matches, case-insensitively (* is a wildcard)
+  request.method=GET     field is exactly the value
+  status>=500            field compares as a number, timestamp or text
+  timeout "timed out"    message or raw line contains the word or phrase
+  user_id:*              field is set
+  -path:/health          term does not match (or NOT path:/health)
+
+Terms can be combined with OR and grouped with parentheses. Fields are
+columns such as level or trace_id, or fields in the log JSON, with dotted
+paths for nested fields. The same filters can be used in the web UI and the
+/query API.
+
+The database file cannot be searched while magic-log has it open.
+
+Examples:
+  magic-log query --db-file logs.duckdb level:error service:api
+  magic-log query --db-file logs.duckdb 'status>=500 -path:/health' --limit 20
+  magic-log query --db-file logs.duckdb '(level:error OR level:warn) "timeout"' --json | jq .
+  magic-log query --sql 'status>=500'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Bind again now that the root flags have been bound in initConfig.
+		viper.BindPFlags(cmd.Flags())
+
+		opts := app.QueryOptions{
+			DBFile: viper.GetString("db-file"),
+			Filter: strings.Join(args, " "),
+			Limit:  viper.GetInt("limit"),
+			JSON:   viper.GetBool("json"),
+			SQL:    viper.GetBool("sql"),
+		}
+		if opts.DBFile == "" && !opts.SQL {
+			log.Fatalf("❌ --db-file is required")
+		}
+		if opts.Limit <= 0 {
+			log.Fatalf("❌ --limit must be positive")
+		}
+		if err := app.Query(opts, os.Stdout, context.Background()); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+
+	queryCmd.Flags().String("db-file", "", "Path to a DuckDB database file")
+	queryCmd.Flags().Int("limit", 100, "Maximum number of entries to print")
+	queryCmd.Flags().Bool("json", false, "Print each entry's log JSON")
+	queryCmd.Flags().Bool("sql", false, "Print the SQL the filter compiles to instead of running it")
+}
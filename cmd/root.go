@@ -19,6 +19,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -61,13 +62,27 @@ func init() {
 	rootCmd.Flags().Bool("launch", false, "Open the UI in a browser")
 	rootCmd.Flags().Bool("echo", false, "Echo parsed stdin input to stdout")
 	rootCmd.Flags().Bool("no-auto-analyze", false, "Disable automatic ANALYZE of logs table")
-	rootCmd.Flags().String("log-format", "json", "Log format: json, csv or plain text")
+	rootCmd.Flags().Bool("no-templates", false, "Disable grouping messages into templates")
+	rootCmd.Flags().String("log-format", "json", "Log format: json, csv, syslog, cri or plain text")
 	rootCmd.Flags().String("regex", "", "Custom regex to parse logs (use with text format)")
 	rootCmd.Flags().String("regex-preset", "", "Regex preset to use")
 	rootCmd.Flags().String("jq", "", "A jq expression to apply to parsed logs")
 	rootCmd.Flags().String("jq-preset", "", "jq preset to use")
 	rootCmd.Flags().String("csv-fields", "", "Comma-separated field names for CSV logs")
 	rootCmd.Flags().Bool("has-csv-header", true, "Whether CSV logs include a header row")
+	rootCmd.Flags().String("sampling-preset", "", "Sampling preset to use for noisy logs")
+	rootCmd.Flags().String("dedup", "", "Collapse repeated lines into one entry: exact, or numbers to ignore numbers that differ")
+	rootCmd.Flags().Duration("dedup-window", 10*time.Second, "How long after a line its repeats are collapsed into it")
+	rootCmd.Flags().Int("buffer-size", 10000, "Number of lines read ahead of parsing and inserting")
+	rootCmd.Flags().String("on-full", "block", "What to do with new lines when the buffer is full: block, drop or spill")
+	rootCmd.Flags().Duration("alert-interval", 15*time.Second, "How often alert rules are evaluated (0 to disable)")
+	rootCmd.Flags().Bool("allow-alert-commands", false, "Let alert rules run shell commands")
+	rootCmd.Flags().String("on-eof", "stay", "What to do when stdin closes: stay, exit or exit-after-idle=DURATION")
+	rootCmd.Flags().String("syslog-udp", "", "Address to receive syslog messages on over UDP (e.g. :5514)")
+	rootCmd.Flags().String("syslog-tcp", "", "Address to receive syslog messages on over TCP (e.g. :5514)")
+	rootCmd.Flags().Bool("docker", false, "Follow logs from running Docker containers")
+	rootCmd.Flags().StringSlice("docker-filter", nil, "Only follow containers matching a filter (e.g. name=api or label=com.docker.compose.project=shop)")
+	rootCmd.Flags().String("docker-socket", "/var/run/docker.sock", "Path to the Docker daemon socket")
 }
 
 func initConfig() {
@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 Paul Schwendenman
+*/
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run -- <command> [args...]",
+	Short: "Run a command and ingest its stdout and stderr",
+	Long: `Starts the Magic Log web interface and runs the given command, ingesting
+its stdout and stderr as separate sources.
+
+Lines from stderr that cannot be parsed are recorded with level 'error'.
+Signals such as Ctrl-C are forwarded to the command, its exit code is recorded
+as a final log entry, and magic-log exits with the same code. Use --restart to
+run the command again when it exits.
+
+Examples:
+  magic-log run -- npm run dev
+  magic-log run --log-format text --regex-preset sveltekit -- pnpm dev
+  magic-log run --restart on-failure -- ./server`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Bind again now that the root flags have been bound in initConfig.
+		viper.BindPFlags(cmd.Flags())
+
+		opts := app.RunOptions{
+			Command: args,
+			Restart: viper.GetString("restart"),
+		}
+		switch opts.Restart {
+		case "never", "on-failure", "always":
+		default:
+			log.Fatalf("❌ --restart must be one of: never, on-failure, always")
+		}
+		app.RunCommand(loadAppConfig(), opts, staticFiles)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	// Flags after the command name belong to the command, not magic-log.
+	runCmd.Flags().SetInterspersed(false)
+
+	runCmd.Flags().String("restart", "never", "Restart policy when the command exits: never, on-failure or always")
+	runCmd.Flags().String("db-file", "", "Path to a DuckDB database file")
+	runCmd.Flags().Int("port", 3000, "Port to serve the web UI on")
+	runCmd.Flags().Bool("launch", false, "Open the UI in a browser")
+	runCmd.Flags().Bool("echo", false, "Echo parsed output to stdout")
+	runCmd.Flags().Bool("no-auto-analyze", false, "Disable automatic ANALYZE of logs table")
+	runCmd.Flags().Bool("no-templates", false, "Disable grouping messages into templates")
+	runCmd.Flags().String("log-format", "json", "Log format: json, csv, syslog, cri or plain text")
+	runCmd.Flags().String("regex", "", "Custom regex to parse logs (use with text format)")
+	runCmd.Flags().String("regex-preset", "", "Regex preset to use")
+	runCmd.Flags().String("jq", "", "A jq expression to apply to parsed logs")
+	runCmd.Flags().String("jq-preset", "", "jq preset to use")
+	runCmd.Flags().String("csv-fields", "", "Comma-separated field names for CSV logs")
+	runCmd.Flags().Bool("has-csv-header", true, "Whether CSV logs include a header row")
+	runCmd.Flags().String("sampling-preset", "", "Sampling preset to use for noisy logs")
+	runCmd.Flags().String("dedup", "", "Collapse repeated lines into one entry: exact, or numbers to ignore numbers that differ")
+	runCmd.Flags().Duration("dedup-window", 10*time.Second, "How long after a line its repeats are collapsed into it")
+	runCmd.Flags().Int("buffer-size", 10000, "Number of lines read ahead of parsing and inserting")
+	runCmd.Flags().String("on-full", "block", "What to do with new lines when the buffer is full: block, drop or spill")
+	runCmd.Flags().Duration("alert-interval", 15*time.Second, "How often alert rules are evaluated (0 to disable)")
+	runCmd.Flags().Bool("allow-alert-commands", false, "Let alert rules run shell commands")
+
+	runCmd.RegisterFlagCompletionFunc("restart", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"never", "on-failure", "always"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
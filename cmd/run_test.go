@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestRunCmdFlags(t *testing.T) {
+	if runCmd.Flags().Lookup("restart").DefValue != "never" {
+		t.Errorf("expected default restart never, got %s", runCmd.Flags().Lookup("restart").DefValue)
+	}
+
+	// Flags after the command belong to the child process.
+	if err := runCmd.Flags().Parse([]string{"--port", "4000", "npm", "run", "dev", "--port", "5173"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if got := runCmd.Flags().Args(); len(got) != 5 || got[3] != "--port" {
+		t.Errorf("expected child args to be passed through, got %v", got)
+	}
+	if port, _ := runCmd.Flags().GetInt("port"); port != 4000 {
+		t.Errorf("expected port 4000, got %d", port)
+	}
+}
@@ -6,9 +6,15 @@ package cmd
 import (
 	"embed"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/paul-schwendenman/magic-log-ui/internal/app"
 	"github.com/paul-schwendenman/magic-log-ui/internal/config"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -23,55 +29,137 @@ var serverCmd = &cobra.Command{
 
 The logs are parsed using the selected format (json, csv, or regex),
 optionally filtered using jq expressions, and stored in a DuckDB database
-(either in-memory or on-disk).
+(either in-memory or on-disk). Syslog messages can also be received over
+UDP or TCP, and Docker container logs followed, alongside stdin.
+
+Lines are read ahead of parsing and inserting into a buffer of --buffer-size
+lines, so a slow insert does not stall the producer. When the buffer is full,
+--on-full decides whether to block the producer, drop new lines, or spill them
+to a temporary file until there is room.
+
+When stdin closes the web UI keeps running so you can keep browsing. Use
+--on-eof exit to shut down instead, or --on-eof exit-after-idle=5m to shut down
+once nothing has used the UI for five minutes.
+
+Sampling presets from the config file can keep only a fraction of noisy lines,
+such as health checks, while always keeping errors. --dedup collapses lines
+repeated within --dedup-window into the first of them, counting the repeats.
 
 You can also configure presets, query past logs, and auto-analyze your data.
 
 Examples:
   pnpm dev | magic-log server --port 5000 --log-format json
-  cat logs.txt | magic-log server --regex-preset apache --log-format text`,
+  cat logs.txt | magic-log server --regex-preset apache --log-format text
+  magic-log server --syslog-udp :5514 --syslog-tcp :5514
+  magic-log server --docker --docker-filter label=com.docker.compose.project=shop
+  pnpm dev | magic-log server --on-full spill
+  pnpm dev | magic-log server --sampling-preset quiet
+  ./retry-loop | magic-log server --dedup numbers --dedup-window 1m
+  cat app.log | magic-log server --db-file app.duckdb --on-eof exit`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fileCfg, err := config.Load()
-		if err != nil {
-			log.Fatalf("❌ Failed to load config: %v", err)
-		}
-
-		resolvedRegex, err := app.ResolveRegex(
-			viper.GetString("regex_preset"),
-			viper.GetString("regex"),
-			fileCfg,
-		)
-		if err != nil {
-			log.Fatalf("❌ %v", err)
-		}
-
-		resolvedJq, err := app.ResolveJqFilter(
-			viper.GetString("jq_preset"),
-			viper.GetString("jq"),
-			fileCfg,
-		)
-		if err != nil {
-			log.Fatalf("❌ %v", err)
-		}
-
-		cfg := app.Config{
-			DBFile:       viper.GetString("db-file"),
-			Port:         viper.GetInt("port"),
-			Launch:       viper.GetBool("launch"),
-			Echo:         viper.GetBool("echo"),
-			LogFormat:    viper.GetString("log-format"),
-			ParseRegex:   resolvedRegex,
-			JqFilter:     resolvedJq,
-			CSVFieldsStr: viper.GetString("csv-fields"),
-			HasCSVHeader: viper.GetBool("has-csv-header"),
-			AutoAnalyze:  !viper.GetBool("no-auto-analyze"),
-			Version:      Version,
-		}
-
-		app.Run(cfg, staticFiles)
+		app.Run(loadAppConfig(), staticFiles)
 	},
 }
 
+// loadAppConfig resolves presets from the config file and builds the app
+// configuration from the bound flags.
+func loadAppConfig() app.Config {
+	fileCfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("❌ Failed to load config: %v", err)
+	}
+
+	resolvedRegex, err := app.ResolveRegex(
+		viper.GetString("regex_preset"),
+		viper.GetString("regex"),
+		fileCfg,
+	)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	resolvedJq, err := app.ResolveJqFilter(
+		viper.GetString("jq_preset"),
+		viper.GetString("jq"),
+		fileCfg,
+	)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	onFull := viper.GetString("on-full")
+	if !slices.Contains(ingest.BufferPolicies, onFull) {
+		log.Fatalf("❌ --on-full must be one of: %s", strings.Join(ingest.BufferPolicies, ", "))
+	}
+
+	samplingPreset := viper.GetString("sampling-preset")
+	if samplingPreset == "" {
+		samplingPreset = fileCfg.SamplingPreset
+	}
+	sampler, err := app.ResolveSampler(samplingPreset, fileCfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	redactor, err := redact.New(fileCfg.Redact)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	dedup := viper.GetString("dedup")
+	if dedup != "" && !slices.Contains(ingest.DedupModes, dedup) {
+		log.Fatalf("❌ --dedup must be one of: %s", strings.Join(ingest.DedupModes, ", "))
+	}
+	dedupWindow := viper.GetDuration("dedup-window")
+	if dedupWindow <= 0 {
+		log.Fatalf("❌ --dedup-window must be positive")
+	}
+
+	var miner *templates.Miner
+	if !viper.GetBool("no-templates") {
+		miner = templates.NewMiner()
+	}
+
+	alertPeriod := viper.GetDuration("alert-interval")
+	if alertPeriod < 0 {
+		log.Fatalf("❌ --alert-interval cannot be negative")
+	}
+
+	onEOF, err := app.ParseEOFPolicy(viper.GetString("on-eof"))
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	return app.Config{
+		DBFile:       viper.GetString("db-file"),
+		Port:         viper.GetInt("port"),
+		Launch:       viper.GetBool("launch"),
+		Echo:         viper.GetBool("echo"),
+		LogFormat:    viper.GetString("log-format"),
+		ParseRegex:   resolvedRegex,
+		JqFilter:     resolvedJq,
+		CSVFieldsStr: viper.GetString("csv-fields"),
+		HasCSVHeader: viper.GetBool("has-csv-header"),
+		AutoAnalyze:  !viper.GetBool("no-auto-analyze"),
+		SyslogUDP:    viper.GetString("syslog-udp"),
+		SyslogTCP:    viper.GetString("syslog-tcp"),
+		Docker:       viper.GetBool("docker"),
+		DockerFilter: viper.GetStringSlice("docker-filter"),
+		DockerSocket: viper.GetString("docker-socket"),
+		BufferSize:   viper.GetInt("buffer-size"),
+		OnFull:       onFull,
+		OnEOF:        onEOF,
+		Redactor:     redactor,
+		Sampler:      sampler,
+		Dedup:        dedup,
+		DedupWindow:  dedupWindow,
+		Templates:    miner,
+		AlertPeriod:  alertPeriod,
+		AlertCommand: viper.GetBool("allow-alert-commands"),
+		Version:      Version,
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
@@ -80,13 +168,27 @@ func init() {
 	serverCmd.Flags().Bool("launch", false, "Open the UI in a browser")
 	serverCmd.Flags().Bool("echo", false, "Echo parsed stdin input to stdout")
 	serverCmd.Flags().Bool("no-auto-analyze", false, "Disable automatic ANALYZE of logs table")
-	serverCmd.Flags().String("log-format", "json", "Log format: json, csv or plain text")
+	serverCmd.Flags().Bool("no-templates", false, "Disable grouping messages into templates")
+	serverCmd.Flags().String("log-format", "json", "Log format: json, csv, syslog, cri or plain text")
 	serverCmd.Flags().String("regex", "", "Custom regex to parse logs (use with text format)")
 	serverCmd.Flags().String("regex-preset", "", "Regex preset to use")
 	serverCmd.Flags().String("jq", "", "A jq expression to apply to parsed logs")
 	serverCmd.Flags().String("jq-preset", "", "jq preset to use")
 	serverCmd.Flags().String("csv-fields", "", "Comma-separated field names for CSV logs")
 	serverCmd.Flags().Bool("has-csv-header", true, "Whether CSV logs include a header row")
+	serverCmd.Flags().String("sampling-preset", "", "Sampling preset to use for noisy logs")
+	serverCmd.Flags().String("dedup", "", "Collapse repeated lines into one entry: exact, or numbers to ignore numbers that differ")
+	serverCmd.Flags().Duration("dedup-window", 10*time.Second, "How long after a line its repeats are collapsed into it")
+	serverCmd.Flags().Int("buffer-size", 10000, "Number of lines read ahead of parsing and inserting")
+	serverCmd.Flags().String("on-full", "block", "What to do with new lines when the buffer is full: block, drop or spill")
+	serverCmd.Flags().Duration("alert-interval", 15*time.Second, "How often alert rules are evaluated (0 to disable)")
+	serverCmd.Flags().Bool("allow-alert-commands", false, "Let alert rules run shell commands")
+	serverCmd.Flags().String("on-eof", "stay", "What to do when stdin closes: stay, exit or exit-after-idle=DURATION")
+	serverCmd.Flags().String("syslog-udp", "", "Address to receive syslog messages on over UDP (e.g. :5514)")
+	serverCmd.Flags().String("syslog-tcp", "", "Address to receive syslog messages on over TCP (e.g. :5514)")
+	serverCmd.Flags().Bool("docker", false, "Follow logs from running Docker containers")
+	serverCmd.Flags().StringSlice("docker-filter", nil, "Only follow containers matching a filter (e.g. name=api or label=com.docker.compose.project=shop)")
+	serverCmd.Flags().String("docker-socket", "/var/run/docker.sock", "Path to the Docker daemon socket")
 
 	viper.BindPFlags(serverCmd.Flags())
 }
@@ -0,0 +1,190 @@
+package alerts_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func setup(t *testing.T) (*sql.DB, *alerts.Store, *ingest.Pipeline) {
+	t.Helper()
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	t.Cleanup(func() { db.Close() })
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+	return db, alerts.NewStore(db), pipeline
+}
+
+func process(t *testing.T, pipeline *ingest.Pipeline, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if err := pipeline.Process(line, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// webhook records the events posted to it.
+type webhook struct {
+	mu     sync.Mutex
+	events []alerts.Event
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e alerts.Event
+	json.NewDecoder(r.Body).Decode(&e)
+	h.mu.Lock()
+	h.events = append(h.events, e)
+	h.mu.Unlock()
+}
+
+func TestStore_Validate(t *testing.T) {
+	ctx := context.Background()
+	_, store, _ := setup(t)
+
+	_, err := store.CreateRule(alerts.Rule{
+		Where:     "no_such_column = 1",
+		Window:    "soon",
+		Threshold: -1,
+		Notify:    []alerts.Target{{Type: "webhook", URL: "ftp://example.com"}, {Type: "command"}, {Type: "pager"}},
+	}, ctx)
+	var invalid *alerts.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Errs) != 7 {
+		t.Errorf("Expected 7 validation errors, got %v", err)
+	}
+
+	rule, err := store.CreateRule(alerts.Rule{Name: "Errors", Filter: "level:error"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Window != "1m" || rule.Status.State != alerts.StatePending {
+		t.Errorf("Unexpected defaults %+v", rule)
+	}
+}
+
+func TestScheduler_Evaluate(t *testing.T) {
+	ctx := context.Background()
+	db, store, pipeline := setup(t)
+
+	hook := &webhook{}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+
+	rule, err := store.CreateRule(alerts.Rule{
+		Name:      "Errors",
+		Filter:    "level:error",
+		Where:     "message <> 'ignored'",
+		Window:    "1m",
+		Threshold: 2,
+		Notify:    []alerts.Target{{Type: "webhook", URL: srv.URL}},
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := alerts.NewScheduler(store, false)
+
+	evaluate := func() alerts.Rule {
+		t.Helper()
+		if err := scheduler.Evaluate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := store.GetRule(rule.ID, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rule
+	}
+
+	process(t, pipeline, `{"level":"error","message":"a"}`, `{"level":"error","message":"b"}`, `{"level":"error","message":"ignored"}`)
+	if got := evaluate(); got.Status.State != alerts.StateOK || got.Status.LastCount != 2 {
+		t.Errorf("Expected ok at the threshold, got %+v", got.Status)
+	}
+
+	process(t, pipeline, `{"level":"error","message":"c"}`)
+	if got := evaluate(); got.Status.State != alerts.StateFiring || got.Status.LastCount != 3 {
+		t.Errorf("Expected firing over the threshold, got %+v", got.Status)
+	}
+	// A firing rule is only notified once.
+	evaluate()
+
+	// The rule resolves once the lines stop matching.
+	if _, err := db.ExecContext(ctx, `DELETE FROM logs WHERE message = 'c'`); err != nil {
+		t.Fatal(err)
+	}
+	if got := evaluate(); got.Status.State != alerts.StateOK {
+		t.Errorf("Expected the rule to resolve, got %+v", got.Status)
+	}
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.events) != 2 || hook.events[0].State != alerts.StateFiring || hook.events[1].State != alerts.StateResolved {
+		t.Fatalf("Expected firing then resolved notifications, got %+v", hook.events)
+	}
+	if firing := hook.events[0]; firing.Count != 3 || len(firing.Samples) != 3 || !strings.Contains(firing.Samples[0], `"message":"c"`) {
+		t.Errorf("Unexpected firing event %+v", firing)
+	}
+
+	events, err := store.ListEvents(rule.ID, 10, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].State != alerts.StateResolved {
+		t.Errorf("Expected the history newest first, got %+v", events)
+	}
+}
+
+func TestScheduler_Commands(t *testing.T) {
+	ctx := context.Background()
+	_, store, pipeline := setup(t)
+	out := filepath.Join(t.TempDir(), "alert.json")
+
+	_, err := store.CreateRule(alerts.Rule{
+		Name:   "Panics",
+		Where:  "message ILIKE '%panic%'",
+		Notify: []alerts.Target{{Type: "command", Command: `cat > '` + out + `'; echo "$MAGIC_LOG_ALERT_STATE" >> '` + out + `'`}},
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	process(t, pipeline, `{"message":"panic: nil map"}`)
+
+	// Commands do not run unless allowed.
+	if err := alerts.NewScheduler(store, false).Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := store.ListEvents("", 10, ctx)
+	if len(events) != 1 || len(events[0].NotifyErrors) != 1 || !strings.Contains(events[0].NotifyErrors[0], "--allow-alert-commands") {
+		t.Errorf("Expected the command to be refused, got %+v", events)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Expected the command not to run, got %v", err)
+	}
+
+	// Editing a rule resets its state, so it fires again.
+	rules, _ := store.ListRules(ctx)
+	if _, err := store.UpdateRule(rules[0], ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := alerts.NewScheduler(store, true).Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"rule":"Panics"`) || !strings.HasSuffix(string(data), "firing\n") {
+		t.Errorf("Unexpected command input %q", data)
+	}
+}
@@ -0,0 +1,123 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifyTimeout bounds how long a webhook or command may take, since rules
+// are evaluated one after another.
+const notifyTimeout = 10 * time.Second
+
+var errCommandsDisabled = errors.New("command targets are disabled; start magic-log with --allow-alert-commands")
+
+func (s *Scheduler) notify(target Target, event Event, ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	switch target.Type {
+	case "desktop":
+		return notifyDesktop(event, ctx)
+	case "webhook":
+		return notifyWebhook(target.URL, event, ctx)
+	case "command":
+		if !s.allowCommands {
+			return errCommandsDisabled
+		}
+		return notifyCommand(target.Command, event, ctx)
+	}
+	return fmt.Errorf("unknown target type %q", target.Type)
+}
+
+// notifyWebhook posts the event as JSON.
+func notifyWebhook(url string, event Event, ctx context.Context) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyCommand runs command with the shell, passing the event as JSON on
+// stdin and its main fields in MAGIC_LOG_ALERT_* environment variables.
+func notifyCommand(command string, event Event, ctx context.Context) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"MAGIC_LOG_ALERT_RULE="+event.Rule,
+		"MAGIC_LOG_ALERT_STATE="+event.State,
+		"MAGIC_LOG_ALERT_COUNT="+strconv.FormatInt(event.Count, 10),
+		"MAGIC_LOG_ALERT_MESSAGE="+event.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if output := strings.TrimSpace(string(out)); output != "" {
+			return fmt.Errorf("%v: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
+
+// notifyDesktop shows a desktop notification with whichever notifier the
+// system has.
+func notifyDesktop(event Event, ctx context.Context) error {
+	title := "magic-log: " + event.Rule
+
+	var cmd *exec.Cmd
+	switch {
+	case isCommandAvailable("notify-send"):
+		cmd = exec.CommandContext(ctx, "notify-send", title, event.Message) // Linux
+	case isCommandAvailable("osascript"):
+		// Pass the text as arguments so that it needs no quoting.
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, event.Message) // macOS
+	default:
+		return errors.New("no supported desktop notifier found")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func isCommandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,365 @@
+// Package alerts evaluates alert rules against the logs table in the
+// background and notifies when they start or stop firing.
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+)
+
+// TargetTypes lists where alerts can be sent.
+var TargetTypes = []string{"desktop", "webhook", "command"}
+
+// States of a rule. A rule is pending until it is first evaluated.
+const (
+	StatePending  = "pending"
+	StateOK       = "ok"
+	StateFiring   = "firing"
+	StateError    = "error"
+	StateResolved = "resolved"
+)
+
+const defaultWindow = "1m"
+
+var ErrNotFound = errors.New("not found")
+
+// Rule fires while more than Threshold lines received in the last Window
+// match its conditions. A threshold of 0 fires on any matching line.
+type Rule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Where is a SQL condition on the logs table and Filter uses the filter
+	// syntax. Lines match if they satisfy both; at least one is set.
+	Where     string    `json:"where,omitempty"`
+	Filter    string    `json:"filter,omitempty"`
+	Window    string    `json:"window"`
+	Threshold int       `json:"threshold"`
+	Notify    []Target  `json:"notify"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Status is set by the scheduler and ignored when saving a rule.
+	Status Status `json:"status"`
+}
+
+// Target is somewhere to send alerts: a desktop notification, a POST to URL,
+// or Command run by the shell.
+type Target struct {
+	Type    string `json:"type"`
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+type Status struct {
+	State         string     `json:"state"`
+	Since         *time.Time `json:"since,omitempty"`
+	LastEvaluated *time.Time `json:"last_evaluated,omitempty"`
+	LastCount     int64      `json:"last_count"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Event records a rule starting to fire, resolving, or failing to evaluate.
+// It is also what notifications send.
+type Event struct {
+	ID           string    `json:"id"`
+	RuleID       string    `json:"rule_id"`
+	Rule         string    `json:"rule"`
+	State        string    `json:"state"`
+	Count        int64     `json:"count"`
+	Threshold    int       `json:"threshold"`
+	Window       string    `json:"window"`
+	Message      string    `json:"message"`
+	Samples      []string  `json:"samples,omitempty"`
+	NotifyErrors []string  `json:"notify_errors,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// ValidationError reports everything wrong with a rule.
+type ValidationError struct {
+	Errs []error
+}
+
+func (e *ValidationError) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+func (r *Rule) setDefaults() {
+	if r.Window == "" {
+		r.Window = defaultWindow
+	}
+	if r.Notify == nil {
+		r.Notify = []Target{}
+	}
+}
+
+// window returns the rule's window, which Validate has checked.
+func (r *Rule) window() time.Duration {
+	d, _ := time.ParseDuration(r.Window)
+	return d
+}
+
+// condition returns the SQL condition for the rule's lines, with its
+// arguments.
+func (r *Rule) condition() (string, []any, error) {
+	var where []string
+	var args []any
+	if r.Where != "" {
+		where = append(where, "("+r.Where+")")
+	}
+	if r.Filter != "" {
+		condition, filterArgs, err := filter.Compile(r.Filter)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, condition)
+		args = append(args, filterArgs...)
+	}
+	return strings.Join(where, " AND "), args, nil
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store for the alert_rules and alert_events tables
+// created by logdb.MustInit.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Validate checks a rule, including that its SQL condition runs against
+// the logs table.
+func (s *Store) Validate(r Rule, ctx context.Context) error {
+	var errs []error
+	if strings.TrimSpace(r.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if strings.TrimSpace(r.Where) == "" && strings.TrimSpace(r.Filter) == "" {
+		errs = append(errs, errors.New("where or filter is required"))
+	} else if condition, args, err := r.condition(); err != nil {
+		errs = append(errs, fmt.Errorf("filter: %v", err))
+	} else if rows, err := s.db.QueryContext(ctx, "SELECT 1 FROM logs WHERE "+condition+" LIMIT 0", args...); err != nil {
+		errs = append(errs, fmt.Errorf("where: %v", err))
+	} else {
+		rows.Close()
+	}
+	if d, err := time.ParseDuration(r.Window); r.Window != "" && (err != nil || d <= 0) {
+		errs = append(errs, fmt.Errorf("invalid window %q", r.Window))
+	}
+	if r.Threshold < 0 {
+		errs = append(errs, errors.New("threshold cannot be negative"))
+	}
+	for i, t := range r.Notify {
+		switch t.Type {
+		case "desktop":
+		case "webhook":
+			if u, err := url.Parse(t.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("notify %d: invalid webhook url %q", i+1, t.URL))
+			}
+		case "command":
+			if strings.TrimSpace(t.Command) == "" {
+				errs = append(errs, fmt.Errorf("notify %d: command is required", i+1))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("notify %d: type %q is not one of %s", i+1, t.Type, strings.Join(TargetTypes, ", ")))
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{errs}
+	}
+	return nil
+}
+
+const ruleColumns = `id, name, where_sql, filter, time_window, threshold, notify::TEXT, disabled, created_at, updated_at,
+	state, state_since, last_evaluated_at, last_count, last_error`
+
+// ListRules returns every rule, ordered by name.
+func (s *Store) ListRules(ctx context.Context) ([]Rule, error) {
+	return s.listRules(`ORDER BY lower(name), id`, nil, ctx)
+}
+
+func (s *Store) GetRule(id string, ctx context.Context) (Rule, error) {
+	rules, err := s.listRules(`WHERE id = ?`, []any{id}, ctx)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(rules) == 0 {
+		return Rule{}, ErrNotFound
+	}
+	return rules[0], nil
+}
+
+// CreateRule saves a new rule, giving it an id. It is evaluated from the
+// scheduler's next run.
+func (s *Store) CreateRule(r Rule, ctx context.Context) (Rule, error) {
+	r.setDefaults()
+	if err := s.Validate(r, ctx); err != nil {
+		return Rule{}, err
+	}
+	r.ID = uuid.New().String()
+	r.CreatedAt = now()
+	r.UpdatedAt = r.CreatedAt
+	r.Status = Status{State: StatePending}
+	return r, s.putRule(r, ctx)
+}
+
+// UpdateRule replaces the rule with r's id. Its state starts again from
+// pending, since the conditions it was evaluated against may have changed.
+func (s *Store) UpdateRule(r Rule, ctx context.Context) (Rule, error) {
+	existing, err := s.GetRule(r.ID, ctx)
+	if err != nil {
+		return Rule{}, err
+	}
+	r.setDefaults()
+	if err := s.Validate(r, ctx); err != nil {
+		return Rule{}, err
+	}
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = now()
+	r.Status = Status{State: StatePending}
+	return r, s.putRule(r, ctx)
+}
+
+// DeleteRule deletes a rule, keeping its history.
+func (s *Store) DeleteRule(id string, ctx context.Context) error {
+	if _, err := s.GetRule(id, ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) listRules(clause string, args []any, ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+ruleColumns+` FROM alert_rules `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		var r Rule
+		var where, filterText, notify, lastError sql.NullString
+		var since, lastEvaluated sql.NullTime
+		if err := rows.Scan(&r.ID, &r.Name, &where, &filterText, &r.Window, &r.Threshold, &notify, &r.Disabled,
+			&r.CreatedAt, &r.UpdatedAt, &r.Status.State, &since, &lastEvaluated, &r.Status.LastCount, &lastError); err != nil {
+			return nil, err
+		}
+		r.Where, r.Filter, r.Status.LastError = where.String, filterText.String, lastError.String
+		if since.Valid {
+			r.Status.Since = &since.Time
+		}
+		if lastEvaluated.Valid {
+			r.Status.LastEvaluated = &lastEvaluated.Time
+		}
+		r.Notify = []Target{}
+		if notify.Valid {
+			if err := json.Unmarshal([]byte(notify.String), &r.Notify); err != nil {
+				return nil, fmt.Errorf("rule %s: notify: %w", r.ID, err)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *Store) putRule(r Rule, ctx context.Context) error {
+	notify, err := json.Marshal(r.Notify)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO alert_rules (id, name, where_sql, filter, time_window, threshold, notify, disabled,
+			created_at, updated_at, state, state_since, last_evaluated_at, last_count, last_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, NULL, 0, NULL)
+	`, r.ID, r.Name, r.Where, r.Filter, r.Window, r.Threshold, string(notify), r.Disabled, r.CreatedAt, r.UpdatedAt, r.Status.State)
+	return err
+}
+
+// setStatus records the outcome of evaluating r, unless r has been changed
+// since it was read.
+func (s *Store) setStatus(r Rule, ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE alert_rules
+		SET state = ?, state_since = ?, last_evaluated_at = ?, last_count = ?, last_error = ?
+		WHERE id = ? AND updated_at = ?
+	`, r.Status.State, r.Status.Since, r.Status.LastEvaluated, r.Status.LastCount, r.Status.LastError, r.ID, r.UpdatedAt)
+	return err
+}
+
+// ListEvents returns the most recent events, for one rule if ruleID is set,
+// newest first.
+func (s *Store) ListEvents(ruleID string, limit int, ctx context.Context) ([]Event, error) {
+	where := ""
+	args := []any{}
+	if ruleID != "" {
+		where = "WHERE rule_id = ?"
+		args = append(args, ruleID)
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id::TEXT, rule_id, rule_name, state, count, threshold, time_window, message,
+			samples::TEXT, notify_errors::TEXT, created_at
+		FROM alert_events `+where+`
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var samples, notifyErrors sql.NullString
+		if err := rows.Scan(&e.ID, &e.RuleID, &e.Rule, &e.State, &e.Count, &e.Threshold, &e.Window, &e.Message,
+			&samples, &notifyErrors, &e.At); err != nil {
+			return nil, err
+		}
+		for _, list := range []struct {
+			text sql.NullString
+			dest *[]string
+		}{{samples, &e.Samples}, {notifyErrors, &e.NotifyErrors}} {
+			if list.text.Valid {
+				if err := json.Unmarshal([]byte(list.text.String), list.dest); err != nil {
+					return nil, fmt.Errorf("event %s: %w", e.ID, err)
+				}
+			}
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *Store) addEvent(e Event, ctx context.Context) error {
+	samples, err := json.Marshal(e.Samples)
+	if err != nil {
+		return err
+	}
+	notifyErrors, err := json.Marshal(e.NotifyErrors)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO alert_events (id, rule_id, rule_name, state, count, threshold, time_window, message, samples, notify_errors, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.RuleID, e.Rule, e.State, e.Count, e.Threshold, e.Window, e.Message, string(samples), string(notifyErrors), e.At)
+	return err
+}
+
+// now returns the current time at the precision of a DuckDB TIMESTAMP, so
+// that times read back compare equal.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
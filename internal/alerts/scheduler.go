@@ -0,0 +1,202 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+)
+
+// sampleLines is the number of recent matching lines sent with an alert.
+const sampleLines = 5
+
+var (
+	alertEvents    = metrics.NewCounterVec("magiclog_alert_events_total", "Alert rules starting to fire, resolving or failing to evaluate, by state.", "state")
+	notifyFailures = metrics.NewCounter("magiclog_alert_notify_failures_total", "Alert notifications that could not be sent.")
+)
+
+// Scheduler evaluates every enabled rule on an interval. It is not safe to
+// evaluate from more than one goroutine.
+type Scheduler struct {
+	store         *Store
+	allowCommands bool
+	done          chan struct{}
+}
+
+// NewScheduler returns a scheduler for the rules in store. Command targets
+// are only run if allowCommands is set, since anyone who can reach the API
+// can add rules.
+func NewScheduler(store *Store, allowCommands bool) *Scheduler {
+	return &Scheduler{store: store, allowCommands: allowCommands}
+}
+
+// Start evaluates the rules every interval until ctx is cancelled.
+func (s *Scheduler) Start(interval time.Duration, ctx context.Context) {
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		log.Printf("🚨 Evaluating alert rules every %s\n", interval)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Evaluate(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("⚠️ Failed to evaluate alert rules: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Wait blocks until a started scheduler has stopped, so that the database
+// can be closed.
+func (s *Scheduler) Wait() {
+	if s == nil || s.done == nil {
+		return
+	}
+	<-s.done
+}
+
+// Evaluate checks every enabled rule once, recording and sending an event
+// for each rule that starts firing, resolves or starts failing.
+func (s *Scheduler) Evaluate(ctx context.Context) error {
+	rules, err := s.store.ListRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		if err := s.evaluate(rule, ctx); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) evaluate(rule Rule, ctx context.Context) error {
+	evaluatedAt := now()
+	since := evaluatedAt.Add(-rule.window())
+
+	count, samples, evalErr := s.count(rule, since, ctx)
+	state := StateOK
+	switch {
+	case evalErr != nil:
+		state = StateError
+	case count > int64(rule.Threshold):
+		state = StateFiring
+	}
+
+	previous := rule.Status.State
+	rule.Status.LastEvaluated = &evaluatedAt
+	rule.Status.LastCount = count
+	rule.Status.LastError = ""
+	if evalErr != nil {
+		rule.Status.LastError = evalErr.Error()
+	}
+	if state != previous {
+		rule.Status.State = state
+		rule.Status.Since = &evaluatedAt
+	}
+
+	// Rules starting out fine, or recovering from an error, are not worth
+	// telling anyone about.
+	event := Event{
+		ID:        uuid.New().String(),
+		RuleID:    rule.ID,
+		Rule:      rule.Name,
+		Count:     count,
+		Threshold: rule.Threshold,
+		Window:    rule.Window,
+		At:        evaluatedAt,
+	}
+	switch {
+	case state == previous:
+		return s.store.setStatus(rule, ctx)
+	case state == StateFiring:
+		event.State = StateFiring
+		event.Message = fmt.Sprintf("%s: %s in the last %s, more than %d", rule.Name, matchingLines(count), rule.Window, rule.Threshold)
+		event.Samples = samples
+	case state == StateOK && previous == StateFiring:
+		event.State = StateResolved
+		event.Message = fmt.Sprintf("%s: resolved, %s in the last %s", rule.Name, matchingLines(count), rule.Window)
+	case state == StateError:
+		event.State = StateError
+		event.Message = fmt.Sprintf("%s: %v", rule.Name, evalErr)
+		log.Printf("⚠️ Alert rule %q failed: %v", rule.Name, evalErr)
+	default:
+		return s.store.setStatus(rule, ctx)
+	}
+
+	if event.State != StateError {
+		log.Printf("🚨 %s", event.Message)
+		for _, target := range rule.Notify {
+			if err := s.notify(target, event, ctx); err != nil {
+				notifyFailures.Inc()
+				log.Printf("⚠️ Failed to send alert to %s: %v", target.Type, err)
+				event.NotifyErrors = append(event.NotifyErrors, fmt.Sprintf("%s: %v", target.Type, err))
+			}
+		}
+	}
+	alertEvents.With(event.State).Inc()
+
+	if err := s.store.addEvent(event, ctx); err != nil {
+		return err
+	}
+	return s.store.setStatus(rule, ctx)
+}
+
+// count returns the number of matching lines received since since, counting
+// sampled and repeated lines, and the most recent of them if there are more
+// than the rule's threshold.
+func (s *Scheduler) count(rule Rule, since time.Time, ctx context.Context) (int64, []string, error) {
+	condition, args, err := rule.condition()
+	if err != nil {
+		return 0, nil, err
+	}
+	where := "created_at > ? AND " + condition
+	args = append([]any{since}, args...)
+
+	var count int64
+	err = s.store.db.QueryRowContext(ctx, `
+		SELECT coalesce(sum(coalesce(sample_weight, 1) * coalesce(repeat_count, 1)), 0)
+		FROM logs WHERE `+where, args...).Scan(&count)
+	if err != nil || count <= int64(rule.Threshold) {
+		return count, nil, err
+	}
+
+	rows, err := s.store.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT raw_log FROM logs WHERE %s ORDER BY created_at DESC LIMIT %d
+	`, where, sampleLines), args...)
+	if err != nil {
+		return count, nil, err
+	}
+	defer rows.Close()
+
+	var samples []string
+	for rows.Next() {
+		var line sql.NullString
+		if err := rows.Scan(&line); err != nil {
+			return count, nil, err
+		}
+		samples = append(samples, line.String)
+	}
+	return count, samples, rows.Err()
+}
+
+func matchingLines(n int64) string {
+	if n == 1 {
+		return "1 matching line"
+	}
+	return fmt.Sprintf("%d matching lines", n)
+}
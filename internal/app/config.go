@@ -210,8 +210,8 @@ var knownKeys = map[string]KeyMeta{
 		Suggest: shared.SuggestBool,
 	},
 	"log_format": {
-		Coerce:  shared.ParseEnum("log_format", "json", "text"),
-		Suggest: func() []string { return []string{"json", "text", "csv"} },
+		Coerce:  shared.ParseEnum("log_format", "json", "text", "syslog", "cri"),
+		Suggest: func() []string { return []string{"json", "text", "csv", "syslog", "cri"} },
 	},
 	"regex": {
 		Coerce:  shared.ValidateRegex("regex"),
@@ -229,6 +229,10 @@ var knownKeys = map[string]KeyMeta{
 		Coerce:  shared.StringPassThrough("jq_preset"),
 		Suggest: func() []string { return getKeysFromSection("jq_presets") },
 	},
+	"sampling_preset": {
+		Coerce:  shared.StringPassThrough("sampling_preset"),
+		Suggest: func() []string { return getKeysFromSection("sampling_presets") },
+	},
 	"csv_fields": {
 		Coerce:  shared.StringPassThrough("csv_fields"),
 		Suggest: nil,
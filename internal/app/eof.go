@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/handlers"
+)
+
+const defaultIdle = 5 * time.Minute
+
+// EOFPolicy decides what happens once stdin has been read to the end.
+type EOFPolicy struct {
+	// Exit shuts down once stdin closes.
+	Exit bool
+	// Idle delays exiting until nothing has used magic-log for this long.
+	Idle time.Duration
+}
+
+// ParseEOFPolicy parses the value of --on-eof: stay, exit, or
+// exit-after-idle=DURATION.
+func ParseEOFPolicy(s string) (EOFPolicy, error) {
+	name, value, hasValue := strings.Cut(s, "=")
+	switch {
+	case name == "stay" && !hasValue:
+		return EOFPolicy{}, nil
+	case name == "exit" && !hasValue:
+		return EOFPolicy{Exit: true}, nil
+	case name == "exit-after-idle":
+		idle := defaultIdle
+		if hasValue {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return EOFPolicy{}, fmt.Errorf("invalid idle duration %q", value)
+			}
+			idle = d
+		}
+		return EOFPolicy{Exit: true, Idle: idle}, nil
+	}
+	return EOFPolicy{}, fmt.Errorf("--on-eof must be one of: stay, exit, exit-after-idle=DURATION")
+}
+
+// inputClosed tells browsers that an input has ended and applies the policy,
+// calling exit when magic-log should shut down.
+func inputClosed(source string, stats ingest.Stats, policy EOFPolicy, exit func(), ctx context.Context) {
+	handlers.Notify(handlers.Event{
+		Event:   "input_closed",
+		Source:  source,
+		Message: fmt.Sprintf("%s closed after %s", source, stats),
+	})
+
+	if !policy.Exit {
+		return
+	}
+	if policy.Idle > 0 {
+		log.Printf("💤 Exiting after %s without activity\n", policy.Idle)
+		if !waitIdle(policy.Idle, ctx) {
+			return
+		}
+	}
+	log.Printf("🏁 %s closed, exiting\n", source)
+	exit()
+}
+
+// waitIdle returns true once there have been no requests to the web server,
+// no browsers connected and no lines ingested for idle, or false if ctx is
+// cancelled first.
+func waitIdle(idle time.Duration, ctx context.Context) bool {
+	ticker := time.NewTicker(max(min(idle/10, 5*time.Second), 10*time.Millisecond))
+	defer ticker.Stop()
+
+	lastActive := time.Now()
+	lines := ingest.Snapshot().Lines
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if n := ingest.Snapshot().Lines; n != lines || handlers.ClientCount() > 0 {
+			lines = n
+			lastActive = now
+		}
+		if t := server.LastActivity(); t.After(lastActive) {
+			lastActive = t
+		}
+		if now.Sub(lastActive) >= idle {
+			return true
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server"
+)
+
+func TestParseEOFPolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want EOFPolicy
+	}{
+		{"stay", EOFPolicy{}},
+		{"exit", EOFPolicy{Exit: true}},
+		{"exit-after-idle", EOFPolicy{Exit: true, Idle: 5 * time.Minute}},
+		{"exit-after-idle=90s", EOFPolicy{Exit: true, Idle: 90 * time.Second}},
+	}
+	for _, tt := range tests {
+		got, err := ParseEOFPolicy(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseEOFPolicy(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "quit", "exit=5m", "exit-after-idle=soon", "exit-after-idle=-1m"} {
+		if _, err := ParseEOFPolicy(in); err == nil {
+			t.Errorf("Expected an error for %q", in)
+		}
+	}
+}
+
+func TestWaitIdle_IgnoresMetricsScrapes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	go server.Start(port, embed.FS{}, db, pipeline, ctx)
+
+	idle := make(chan bool, 1)
+	go func() {
+		idle <- waitIdle(300*time.Millisecond, ctx)
+	}()
+
+	// Scrape far more often than the idle period until waitIdle gives up.
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ok := <-idle:
+			if !ok {
+				t.Error("Expected waitIdle to report idle")
+			}
+			return
+		case <-deadline:
+			t.Fatal("Expected metrics scrapes not to count as activity")
+		case <-time.After(50 * time.Millisecond):
+			for _, path := range []string{"/metrics", "/api/ingest/stats"} {
+				if resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path)); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+	}
+}
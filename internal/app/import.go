@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"embed"
+	"log"
+	"os"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/importer"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+type ImportOptions struct {
+	Paths []string
+	// Serve starts the web UI and keeps it running after the import instead
+	// of bulk loading into the database file and exiting.
+	Serve bool
+}
+
+// ImportFiles ingests log files, archives and directories. By default the
+// files are bulk loaded into config.DBFile without starting the web server.
+func ImportFiles(config Config, opts ImportOptions, staticFiles embed.FS) {
+	if opts.Serve {
+		importAndServe(config, opts.Paths, staticFiles)
+		return
+	}
+
+	ctx, _ := signalContext()
+	db, appender := logdb.MustInitBulk(config.DBFile, ctx)
+	log.Printf("💾 Bulk loading into DuckDB file: %s\n", config.DBFile)
+
+	weights := ingest.NewSampleWeights(db, config.Sampler)
+	templateWriter, err := ingest.NewTemplateWriter(db, config.Templates, ctx)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	pipeline := newPipeline(config, appender).WithoutBroadcast()
+
+	summary, importErr := importer.Import(opts.Paths, pipeline, os.Stderr, ctx)
+
+	// Keep the rows loaded before an interrupt: flush them, index them and
+	// checkpoint the file even though ctx is cancelled.
+	finishCtx := context.WithoutCancel(ctx)
+	if err := appender.Close(); err != nil {
+		log.Fatalf("❌ Failed to write logs: %v", err)
+	}
+	// Appended rows can only be updated once the appender has been closed.
+	weights.Close()
+	templateWriter.Close()
+
+	log.Println("🗂️  Creating indexes")
+	logdb.MustCreateIndexes(db, finishCtx)
+	if _, err := db.ExecContext(finishCtx, `ANALYZE logs`); err != nil {
+		log.Printf("⚠️ Failed to analyze logs table: %v", err)
+	}
+	log.Println("💾 Checkpointing database")
+	if err := logdb.Close(db, finishCtx); err != nil {
+		log.Fatalf("❌ Failed to close database: %v", err)
+	}
+
+	if ctx.Err() != nil {
+		log.Fatalf("🛑 Import interrupted after %s; the lines read so far were saved", summary)
+	}
+	if importErr != nil {
+		log.Fatalf("❌ Import failed after %s: %v", summary, importErr)
+	}
+	log.Printf("✅ Imported %s\n", summary)
+}
+
+func importAndServe(config Config, paths []string, staticFiles embed.FS) {
+	ctx, _ := signalContext()
+	inst := start(config, staticFiles, ctx)
+
+	summary, err := importer.Import(paths, inst.pipeline, os.Stderr, ctx)
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("❌ Import failed: %v", err)
+	}
+	log.Printf("✅ Imported %s\n", summary)
+
+	<-ctx.Done()
+	inst.shutdown()
+}
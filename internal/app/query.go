@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+type QueryOptions struct {
+	DBFile string
+	Filter string
+	Limit  int
+	// JSON prints each entry's log JSON instead of its timestamp, level and
+	// message.
+	JSON bool
+	// SQL prints the SQL the filter compiles to instead of running it.
+	SQL bool
+}
+
+// Query prints the most recent entries in a database file that match a
+// filter, oldest first.
+func Query(opts QueryOptions, out io.Writer, ctx context.Context) error {
+	condition, args, err := filter.Compile(opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT timestamp, level, message, log::TEXT FROM logs WHERE %s ORDER BY timestamp DESC, created_at DESC LIMIT %d", condition, opts.Limit)
+
+	if opts.SQL {
+		fmt.Fprintln(out, query)
+		for i, arg := range args {
+			fmt.Fprintf(out, "-- $%d = %v\n", i+1, arg)
+		}
+		return nil
+	}
+
+	db, err := logdb.OpenReadOnly(opts.DBFile, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", opts.DBFile, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var timestamp sql.NullTime
+		var level, message, logJSON sql.NullString
+		if err := rows.Scan(&timestamp, &level, &message, &logJSON); err != nil {
+			return err
+		}
+		if opts.JSON {
+			lines = append(lines, logJSON.String)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %-5s %s", timestamp.Time.UTC().Format(time.RFC3339), strings.ToUpper(level.String), message.String))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	slices.Reverse(lines)
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
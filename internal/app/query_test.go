@@ -0,0 +1,67 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/app"
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "logs.duckdb")
+
+	db := logdb.MustInit(path, ctx)
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+	for _, line := range []string{
+		`{"timestamp":"2025-01-01T10:00:00Z","level":"error","message":"first failure","status":500}`,
+		`{"timestamp":"2025-01-01T10:00:01Z","level":"info","message":"ok","status":200}`,
+		`{"timestamp":"2025-01-01T10:00:02Z","level":"error","message":"second failure","status":503}`,
+		`{"timestamp":"2025-01-01T10:00:03Z","level":"error","message":"third failure","status":502}`,
+	} {
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := logdb.Close(db, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := app.Query(app.QueryOptions{DBFile: path, Filter: "status>=500 -message:third*", Limit: 10}, &out, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2025-01-01T10:00:00Z ERROR first failure\n2025-01-01T10:00:02Z ERROR second failure\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	// The most recent entries are kept when limited.
+	out.Reset()
+	err = app.Query(app.QueryOptions{DBFile: path, Filter: "level:error", Limit: 1, JSON: true}, &out, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"message":"third failure"`) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	var syntaxErr *filter.SyntaxError
+	err = app.Query(app.QueryOptions{DBFile: path, Filter: "status>=", Limit: 10}, &out, ctx)
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected a syntax error, got %v", err)
+	}
+
+	err = app.Query(app.QueryOptions{DBFile: filepath.Join(t.TempDir(), "missing.duckdb"), Limit: 10}, &out, ctx)
+	if err == nil {
+		t.Error("Expected an error for a missing database file")
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+const restartDelay = time.Second
+
+type RunOptions struct {
+	Command []string
+	Restart string
+}
+
+// RunCommand starts the web UI and ingests the output of a child process.
+// stdout and stderr are recorded as separate sources, signals are forwarded
+// to the child, and magic-log exits with the child's exit code once its output
+// has been stored and the database closed.
+func RunCommand(config Config, opts RunOptions, staticFiles embed.FS) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inst := start(config, staticFiles, ctx)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+
+	for {
+		exitCode, stopped, err := runChild(opts.Command, inst.pipeline, signals, ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to run %s: %v", opts.Command[0], err)
+		}
+
+		if stopped || !shouldRestart(opts.Restart, exitCode) {
+			go func() {
+				<-signals
+				forceExit()
+			}()
+			cancel()
+			inst.shutdown()
+			os.Exit(exitCode)
+		}
+
+		log.Printf("🔁 Restarting %s in %s\n", opts.Command[0], restartDelay)
+		time.Sleep(restartDelay)
+	}
+}
+
+func shouldRestart(policy string, exitCode int) bool {
+	switch policy {
+	case "always":
+		return true
+	case "on-failure":
+		return exitCode != 0
+	default:
+		return false
+	}
+}
+
+// runChild runs the command to completion. stopped reports whether it was
+// asked to terminate by a forwarded signal, in which case it is not restarted.
+func runChild(command []string, pipeline *ingest.Pipeline, signals <-chan os.Signal, ctx context.Context) (exitCode int, stopped bool, err error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	// The child is not in the terminal's foreground process group, so it
+	// would be stopped by SIGTTIN if it read from the terminal. Piped input
+	// is passed on.
+	if !isTerminal(os.Stdin) {
+		cmd.Stdin = os.Stdin
+	}
+	setProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, false, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, false, err
+	}
+	log.Printf("🚀 Started %s (pid %d)\n", strings.Join(command, " "), cmd.Process.Pid)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		pipeline.WithSource("stdout").Run(stdout, ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		pipeline.WithSource("stderr").WithFallbackLevel("error").Run(stderr, ctx)
+	}()
+
+	var stopping atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+					if stopping.Load() {
+						// Asked twice: don't wait for the child.
+						killProcessGroup(cmd)
+						forceExit()
+					}
+					stopping.Store(true)
+				}
+				log.Printf("📶 Forwarding %v to %s\n", sig, command[0])
+				signalProcessGroup(cmd, sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The pipes must be drained before Wait closes them.
+	wg.Wait()
+	err = cmd.Wait()
+	close(done)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return 0, false, err
+	}
+	// Follow the shell convention for children killed by a signal.
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		exitCode = 128 + int(ws.Signal())
+	}
+
+	recordExit(pipeline, command, cmd.ProcessState, exitCode, ctx)
+	return exitCode, stopping.Load(), nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func recordExit(pipeline *ingest.Pipeline, command []string, state *os.ProcessState, exitCode int, ctx context.Context) {
+	message := fmt.Sprintf("%s exited with code %d", command[0], exitCode)
+	level := "info"
+	if exitCode != 0 {
+		level = "error"
+	}
+	if state != nil && !state.Exited() {
+		message = fmt.Sprintf("%s terminated: %s", command[0], state.String())
+	}
+
+	entry := shared.LogEntry{
+		"message":   message,
+		"level":     level,
+		"exit_code": exitCode,
+		"command":   strings.Join(command, " "),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	log.Printf("🏁 %s\n", message)
+	if err := pipeline.WithSource("run").WithLogFormat("json").ProcessParsed(message, entry, ctx); err != nil {
+		log.Printf("❌ Failed to insert log: %v", err)
+	}
+}
+
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func TestRunChild_ForwardsSignalsToGrandchildren(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "text", "", "", "", false, false).
+		WithBuffer(ingest.BufferOptions{BatchSize: 1})
+
+	// The trap runs in a shell started by the child, not in the child.
+	grandchild := `trap 'echo interrupted; exit 0' INT; echo ready; while :; do sleep 0.05; done`
+	command := []string{"sh", "-c", "sh -c \"" + grandchild + "\"; echo done"}
+
+	signals := make(chan os.Signal, 1)
+	type result struct {
+		stopped bool
+		err     error
+	}
+	finished := make(chan result, 1)
+	go func() {
+		_, stopped, err := runChild(command, pipeline, signals, ctx)
+		finished <- result{stopped, err}
+	}()
+
+	waitForMessage := func(message string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		var count int
+		for time.Now().Before(deadline) {
+			db.QueryRow("SELECT count(*) FROM logs WHERE message = ?", message).Scan(&count)
+			if count > 0 {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("Expected %q to be logged", message)
+	}
+
+	waitForMessage("ready")
+	signals <- syscall.SIGINT
+	waitForMessage("interrupted")
+
+	select {
+	case r := <-finished:
+		if r.err != nil || !r.stopped {
+			t.Errorf("Expected the child to stop, got %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the child to exit")
+	}
+}
@@ -8,11 +8,18 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
 	"github.com/paul-schwendenman/magic-log-ui/internal/config"
+	"github.com/paul-schwendenman/magic-log-ui/internal/docker"
 	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
 	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server"
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
 	"github.com/spf13/viper"
 )
 
@@ -27,15 +34,50 @@ type Config struct {
 	CSVFieldsStr string
 	HasCSVHeader bool
 	AutoAnalyze  bool
+	SyslogUDP    string
+	SyslogTCP    string
+	Docker       bool
+	DockerFilter []string
+	DockerSocket string
+	BufferSize   int
+	OnFull       string
+	OnEOF        EOFPolicy
+	Redactor     *redact.Redactor
+	Sampler      *sampling.Sampler
+	Dedup        string
+	DedupWindow  time.Duration
+	Templates    *templates.Miner
+	// AlertPeriod is how often alert rules are evaluated, or 0 not to, and
+	// AlertCommand lets them run shell commands.
+	AlertPeriod  time.Duration
+	AlertCommand bool
 	Version      string
 }
 
+// Run ingests stdin and serves the web UI until interrupted, or until stdin
+// closes if config.OnEOF says to exit.
 func Run(config Config, staticFiles embed.FS) {
+	ctx, stop := signalContext()
+	inst := start(config, staticFiles, ctx)
+
+	stats := <-inst.pipeline.Start(os.Stdin, ctx)
+	if ctx.Err() == nil {
+		go inputClosed("STDIN", stats, config.OnEOF, stop, ctx)
+	}
+
+	<-ctx.Done()
+	inst.shutdown()
+}
+
+// start opens the database and brings up the web server and network
+// listeners until ctx is cancelled. The returned instance holds the pipeline
+// for further inputs.
+func start(config Config, staticFiles embed.FS, ctx context.Context) *instance {
 	log.Println("⚙️  Using config file:", viper.ConfigFileUsed())
-	ctx := context.Background()
 
 	db := logdb.MustInit(config.DBFile, ctx)
-	logInsert := logdb.MustPrepareInsert(db, ctx)
+	logInsert := logdb.MustPrepareBatchInsert(db, ctx)
+	logdb.RegisterMetrics(db, config.DBFile)
 
 	if config.AutoAnalyze {
 		logdb.StartAutoAnalyze(db, ctx)
@@ -51,15 +93,115 @@ func Run(config Config, staticFiles embed.FS) {
 		log.Printf("💾 Connected to DuckDB file: %s\n", absPath)
 	}
 
-	go server.Start(config.Port, staticFiles, db, ctx)
+	var dedup *ingest.Deduper
+	if config.Dedup != "" {
+		var err error
+		dedup, err = ingest.NewDeduper(db, config.Dedup, config.DedupWindow)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	weights := ingest.NewSampleWeights(db, config.Sampler)
+	templateWriter, err := ingest.NewTemplateWriter(db, config.Templates, ctx)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	pipeline := newPipeline(config, logInsert).WithDedup(dedup)
+
+	stopped := make(chan struct{})
+	go func() {
+		err := server.Start(config.Port, staticFiles, db, pipeline, ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Fatalf("❌ Web server failed: %v", err)
+		} else if err != nil {
+			log.Printf("⚠️ Web server did not shut down cleanly: %v", err)
+		}
+		close(stopped)
+	}()
 
 	if config.Launch {
 		launchBrowser(config.Port)
 	}
 
-	go ingest.Start(os.Stdin, logInsert, config.LogFormat, config.ParseRegex, config.JqFilter, config.CSVFieldsStr, config.HasCSVHeader, config.Echo, ctx)
+	inputs := &sync.WaitGroup{}
+	startSyslog(config, logInsert, dedup, inputs, ctx)
+	startDocker(config, pipeline, inputs, ctx)
+
+	var scheduler *alerts.Scheduler
+	if config.AlertPeriod > 0 {
+		scheduler = alerts.NewScheduler(alerts.NewStore(db), config.AlertCommand)
+		scheduler.Start(config.AlertPeriod, ctx)
+	}
+
+	return &instance{db: db, pipeline: pipeline, dedup: dedup, weights: weights, templates: templateWriter, alerts: scheduler, inputs: inputs, stopped: stopped}
+}
+
+// newPipeline builds the ingest pipeline for the configured log format.
+func newPipeline(config Config, stmt ingest.Inserter) *ingest.Pipeline {
+	return ingest.NewPipeline(stmt, config.LogFormat, config.ParseRegex, config.JqFilter, config.CSVFieldsStr, config.HasCSVHeader, config.Echo).
+		WithBuffer(ingest.BufferOptions{Size: config.BufferSize, Policy: config.OnFull}).
+		WithRedactor(config.Redactor).
+		WithSampler(config.Sampler).
+		WithTemplates(config.Templates)
+}
+
+// startSyslog starts the syslog listeners, adding them to inputs until they
+// have stored the messages read before ctx is cancelled.
+func startSyslog(config Config, stmt ingest.Inserter, dedup *ingest.Deduper, inputs *sync.WaitGroup, ctx context.Context) {
+	if config.SyslogUDP == "" && config.SyslogTCP == "" {
+		return
+	}
+
+	pipeline := ingest.NewPipeline(stmt, "syslog", "", config.JqFilter, "", false, config.Echo).
+		WithRedactor(config.Redactor).
+		WithSampler(config.Sampler).
+		WithTemplates(config.Templates).
+		WithDedup(dedup)
 
-	select {}
+	if config.SyslogUDP != "" {
+		inputs.Add(1)
+		go func() {
+			defer inputs.Done()
+			if err := ingest.ListenSyslogUDP(config.SyslogUDP, pipeline, ctx); err != nil {
+				log.Fatalf("❌ Syslog UDP listener failed: %v", err)
+			}
+		}()
+	}
+	if config.SyslogTCP != "" {
+		inputs.Add(1)
+		go func() {
+			defer inputs.Done()
+			if err := ingest.ListenSyslogTCP(config.SyslogTCP, pipeline, ctx); err != nil {
+				log.Fatalf("❌ Syslog TCP listener failed: %v", err)
+			}
+		}()
+	}
+}
+
+// startDocker follows the logs of Docker containers, adding the watcher to
+// inputs until it has stored the lines read before ctx is cancelled.
+func startDocker(config Config, pipeline *ingest.Pipeline, inputs *sync.WaitGroup, ctx context.Context) {
+	if !config.Docker {
+		return
+	}
+
+	filters, err := docker.ParseFilters(config.DockerFilter)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	client := docker.NewClient(config.DockerSocket)
+	if _, err := client.ListContainers(ctx, filters); err != nil {
+		log.Fatalf("❌ Failed to connect to Docker at %s: %v", config.DockerSocket, err)
+	}
+	log.Printf("🐳 Following Docker containers via %s\n", config.DockerSocket)
+
+	inputs.Add(1)
+	go func() {
+		defer inputs.Done()
+		docker.Watch(client, filters, pipeline, ctx)
+	}()
 }
 
 func ResolveRegex(preset, raw string, cfg *config.Config) (string, error) {
@@ -78,6 +220,23 @@ func ResolveRegex(preset, raw string, cfg *config.Config) (string, error) {
 	return "^(?P<message>.*)$", nil
 }
 
+// ResolveSampler builds the sampler for the named preset, or returns nil if no
+// preset is selected.
+func ResolveSampler(preset string, cfg *config.Config) (*sampling.Sampler, error) {
+	if preset == "" {
+		return nil, nil
+	}
+	samplingConfig, ok := cfg.SamplingPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown sampling preset: %s", preset)
+	}
+	sampler, err := sampling.New(samplingConfig)
+	if err != nil {
+		return nil, fmt.Errorf("sampling preset %q: %v", preset, err)
+	}
+	return sampler, nil
+}
+
 func ResolveJqFilter(preset, raw string, cfg *config.Config) (string, error) {
 	if raw != "" {
 		return raw, nil
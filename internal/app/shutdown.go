@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+// signalContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM, starting a graceful shutdown. A second signal exits immediately.
+// Calling the returned function starts the same shutdown without a signal.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("🛑 Received %v, shutting down (press Ctrl-C again to force)\n", sig)
+		cancel()
+
+		<-signals
+		forceExit()
+	}()
+
+	return ctx, cancel
+}
+
+func forceExit() {
+	log.Println("💥 Forcing exit")
+	os.Exit(1)
+}
+
+// instance is the database and web server brought up by start.
+type instance struct {
+	db        *sql.DB
+	pipeline  *ingest.Pipeline
+	dedup     *ingest.Deduper
+	weights   *ingest.SampleWeights
+	templates *ingest.TemplateWriter
+	alerts    *alerts.Scheduler
+	// inputs tracks the syslog listeners and Docker followers.
+	inputs *sync.WaitGroup
+	// stopped receives once the web server has shut down.
+	stopped chan struct{}
+}
+
+// shutdown is called once the context passed to start has been cancelled and
+// stdin has been drained. It waits for the web server to finish in-flight
+// requests, for the syslog and Docker inputs to store what they have read and
+// for the alert scheduler to stop, writes any outstanding repeat counts,
+// sample weights and templates, then checkpoints and closes the database.
+func (i *instance) shutdown() {
+	<-i.stopped
+	i.inputs.Wait()
+	i.alerts.Wait()
+	i.dedup.Close()
+	i.weights.Close()
+	i.templates.Close()
+
+	log.Println("💾 Checkpointing database")
+	if err := logdb.Close(i.db, context.Background()); err != nil {
+		log.Printf("❌ Failed to close database: %v", err)
+		return
+	}
+	log.Println("👋 Shut down cleanly")
+}
@@ -6,23 +6,30 @@ import (
 	"os"
 
 	"github.com/BurntSushi/toml"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DBFile       string `toml:"db_file" json:"db_file,omitempty"`
-	Port         int    `toml:"port" json:"port,omitempty"`
-	Launch       bool   `toml:"launch" json:"launch,omitempty"`
-	LogFormat    string `toml:"log_format" json:"log_format,omitempty"`
-	RegexPreset  string `toml:"regex_preset" json:"regex_preset,omitempty"`
-	Regex        string `toml:"regex" json:"regex,omitempty"`
-	JqFilter     string `toml:"jq" json:"jq,omitempty"`
-	JqPreset     string `toml:"jq_preset" json:"jq_preset,omitempty"`
-	CSVFields    string `toml:"csv_fields" json:"csv_fields,omitempty"`
-	HasCSVHeader bool   `toml:"has_csv_header" json:"has_csv_header,omitempty"`
+	DBFile         string `toml:"db_file" json:"db_file,omitempty"`
+	Port           int    `toml:"port" json:"port,omitempty"`
+	Launch         bool   `toml:"launch" json:"launch,omitempty"`
+	LogFormat      string `toml:"log_format" json:"log_format,omitempty"`
+	RegexPreset    string `toml:"regex_preset" json:"regex_preset,omitempty"`
+	Regex          string `toml:"regex" json:"regex,omitempty"`
+	JqFilter       string `toml:"jq" json:"jq,omitempty"`
+	JqPreset       string `toml:"jq_preset" json:"jq_preset,omitempty"`
+	CSVFields      string `toml:"csv_fields" json:"csv_fields,omitempty"`
+	HasCSVHeader   bool   `toml:"has_csv_header" json:"has_csv_header,omitempty"`
+	SamplingPreset string `toml:"sampling_preset" json:"sampling_preset,omitempty"`
 
 	RegexPresets map[string]string `toml:"regex_presets" json:"regex_presets,omitempty"`
 	JQPresets    map[string]string `toml:"jq_presets" json:"jq_presets,omitempty"`
+
+	SamplingPresets map[string]sampling.Config `toml:"sampling_presets,omitempty" json:"sampling_presets,omitempty"`
+
+	Redact redact.Config `toml:"redact,omitempty" json:"redact,omitempty"`
 }
 
 func Load() (*Config, error) {
@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/itchyny/gojq"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
 )
 
 type ValidationErrors []error
@@ -38,6 +40,13 @@ func (c *Config) Validate() []error {
 		}
 	}
 
+	// --- Sampling presets ---
+	for name, preset := range c.SamplingPresets {
+		if _, err := sampling.New(preset); err != nil {
+			errs = append(errs, fmt.Errorf("sampling preset %q: %v", name, err))
+		}
+	}
+
 	// --- Defaults ---
 	d := c
 	// d := c.Defaults
@@ -54,6 +63,12 @@ func (c *Config) Validate() []error {
 		}
 	}
 
+	if d.SamplingPreset != "" {
+		if _, ok := c.SamplingPresets[d.SamplingPreset]; !ok {
+			errs = append(errs, fmt.Errorf("defaults.sampling_preset %q not found", d.SamplingPreset))
+		}
+	}
+
 	if d.Regex != "" {
 		if _, err := regexp.Compile(d.Regex); err != nil {
 			errs = append(errs, fmt.Errorf("defaults.regex: %v", err))
@@ -67,14 +82,19 @@ func (c *Config) Validate() []error {
 	}
 
 	switch d.LogFormat {
-	case "", "text", "json":
+	case "", "text", "json", "syslog", "cri":
 	default:
-		errs = append(errs, fmt.Errorf("defaults.log_format must be one of: text, json"))
+		errs = append(errs, fmt.Errorf("defaults.log_format must be one of: text, json, syslog, cri"))
 	}
 
 	if d.Port < 0 || d.Port > 65535 {
 		errs = append(errs, fmt.Errorf("defaults.port must be between 1 and 65535"))
 	}
 
+	// --- Redaction ---
+	if _, err := redact.New(c.Redact); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
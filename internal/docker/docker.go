@@ -0,0 +1,298 @@
+// Package docker follows container logs through the Docker Engine API over
+// its unix socket and feeds them into the ingest pipeline.
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+// PollInterval is how often the container list is refreshed to attach to
+// newly started containers.
+var PollInterval = 2 * time.Second
+
+type Client struct {
+	http *http.Client
+}
+
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Name returns the container name without Docker's leading slash.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:min(12, len(c.ID))]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// ParseFilters converts filters such as "label=com.docker.compose.project=app"
+// or "name=api" into the Docker API filter format.
+func ParseFilters(filters []string) (map[string][]string, error) {
+	parsed := map[string][]string{}
+	for _, f := range filters {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid docker filter %q, expected key=value", f)
+		}
+		parsed[key] = append(parsed[key], value)
+	}
+	return parsed, nil
+}
+
+// ListContainers returns running containers matching the filters.
+func (c *Client) ListContainers(ctx context.Context, filters map[string][]string) ([]Container, error) {
+	query := url.Values{}
+	if len(filters) > 0 {
+		query.Set("filters", string(shared.MustJson(filters)))
+	}
+
+	resp, err := c.get(ctx, "/containers/json", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []Container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+func (c *Client) hasTTY(ctx context.Context, id string) (bool, error) {
+	resp, err := c.get(ctx, "/containers/"+id+"/json", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var inspect struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return false, err
+	}
+	return inspect.Config.Tty, nil
+}
+
+// FollowLogs streams a container's stdout and stderr since the given time,
+// calling fn with each complete line until the stream ends or ctx is done.
+func (c *Client) FollowLogs(ctx context.Context, id string, since time.Time, fn func(stream, line string)) error {
+	tty, err := c.hasTTY(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"follow": {"1"},
+		"stdout": {"1"},
+		"stderr": {"1"},
+		// Whole seconds would repeat the lines already read from the second
+		// a stream ended in.
+		"since": {fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())},
+	}
+	resp, err := c.get(ctx, "/containers/"+id+"/logs", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Containers with a TTY send a raw stream; otherwise stdout and stderr
+	// are multiplexed into frames.
+	if tty {
+		return scanLines(resp.Body, func(line string) { fn("stdout", line) })
+	}
+	return Demultiplex(resp.Body, fn)
+}
+
+// Demultiplex splits Docker's stdcopy framing (an 8 byte header holding the
+// stream type and payload size, followed by the payload) into lines per
+// stream. Partial lines are buffered until their newline arrives.
+func Demultiplex(r io.Reader, fn func(stream, line string)) error {
+	header := make([]byte, 8)
+	pending := map[string]*strings.Builder{
+		"stdout": {},
+		"stderr": {},
+	}
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			for stream, buf := range pending {
+				if buf.Len() > 0 {
+					fn(stream, buf.String())
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		stream := "stdout"
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		buf := pending[stream]
+		for _, chunk := range strings.SplitAfter(string(payload), "\n") {
+			if !strings.HasSuffix(chunk, "\n") {
+				buf.WriteString(chunk)
+				continue
+			}
+			buf.WriteString(strings.TrimRight(chunk, "\r\n"))
+			fn(stream, buf.String())
+			buf.Reset()
+		}
+	}
+}
+
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		fn(strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return scanner.Err()
+}
+
+// Watch follows the logs of every running container that matches the
+// filters, attaching to new containers as they start. Each line is tagged
+// with the container name, id and image and with its stream as the source.
+// Watch returns once ctx is cancelled and every follower has stored the lines
+// it read.
+func Watch(client *Client, filters map[string][]string, pipeline *ingest.Pipeline, ctx context.Context) error {
+	// Only lines written after magic-log started are ingested, and a restarted
+	// container resumes from where its previous stream ended.
+	start := time.Now()
+	var followers sync.WaitGroup
+	defer followers.Wait()
+	var mu sync.Mutex
+	attached := map[string]bool{}
+	resumeAt := map[string]time.Time{}
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		containers, err := client.ListContainers(ctx, filters)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("⚠️ Failed to list docker containers: %v", err)
+		}
+
+		for _, c := range containers {
+			mu.Lock()
+			if attached[c.ID] {
+				mu.Unlock()
+				continue
+			}
+			attached[c.ID] = true
+			since, ok := resumeAt[c.ID]
+			if !ok {
+				since = start
+			}
+			mu.Unlock()
+
+			followers.Add(1)
+			go func(c Container, since time.Time) {
+				defer followers.Done()
+				log.Printf("🐳 Following logs for container %s (%s)\n", c.Name(), c.Image)
+				follow(client, c, since, pipeline, ctx)
+
+				mu.Lock()
+				delete(attached, c.ID)
+				resumeAt[c.ID] = time.Now()
+				mu.Unlock()
+			}(c, since)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func follow(client *Client, c Container, since time.Time, pipeline *ingest.Pipeline, ctx context.Context) {
+	containerPipeline := pipeline.WithFields(shared.LogEntry{
+		"container":    c.Name(),
+		"container_id": c.ID,
+		"image":        c.Image,
+	})
+	streams := map[string]*ingest.Pipeline{
+		"stdout": containerPipeline.WithSource("stdout"),
+		"stderr": containerPipeline.WithSource("stderr").WithFallbackLevel("error"),
+	}
+
+	err := client.FollowLogs(ctx, c.ID, since, func(stream, line string) {
+		if err := streams[stream].Process(line, ctx); err != nil {
+			log.Printf("❌ Failed to insert log: %v", err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("⚠️ Stopped following container %s: %v", c.Name(), err)
+		return
+	}
+	log.Printf("🐳 Log stream for container %s ended\n", c.Name())
+}
@@ -0,0 +1,185 @@
+package docker_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/docker"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemultiplex(t *testing.T) {
+	var body bytes.Buffer
+	body.Write(frame(1, "hello\nwor"))
+	body.Write(frame(2, "oops\n"))
+	body.Write(frame(1, "ld\n"))
+	body.Write(frame(2, "no newline"))
+
+	var got []string
+	err := docker.Demultiplex(&body, func(stream, line string) {
+		got = append(got, stream+": "+line)
+	})
+	if err != nil {
+		t.Fatalf("Demultiplex failed: %v", err)
+	}
+
+	want := []string{"stdout: hello", "stderr: oops", "stdout: world", "stderr: no newline"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	filters, err := docker.ParseFilters([]string{"label=com.docker.compose.project=shop", "name=api"})
+	if err != nil {
+		t.Fatalf("ParseFilters failed: %v", err)
+	}
+	want := map[string][]string{
+		"label": {"com.docker.compose.project=shop"},
+		"name":  {"api"},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("got %v, want %v", filters, want)
+	}
+
+	if _, err := docker.ParseFilters([]string{"api"}); err == nil {
+		t.Error("Expected an error for a filter without a value")
+	}
+}
+
+// fakeDaemon serves a minimal Docker Engine API on a unix socket.
+func fakeDaemon(t *testing.T) (string, chan string) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	filtersSeen := make(chan string, 10)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case filtersSeen <- r.URL.Query().Get("filters"):
+		default:
+		}
+		json.NewEncoder(w).Encode([]map[string]any{{
+			"Id":    "abc123",
+			"Names": []string{"/shop-api-1"},
+			"Image": "shop/api:latest",
+		}})
+	})
+	mux.HandleFunc("/containers/abc123/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"Config": map[string]any{"Tty": false}})
+	})
+	mux.HandleFunc("/containers/abc123/logs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("follow") != "1" {
+			http.Error(w, "expected follow", http.StatusBadRequest)
+			return
+		}
+		if !regexp.MustCompile(`^\d+\.\d{9}$`).MatchString(r.URL.Query().Get("since")) {
+			http.Error(w, "expected since with nanoseconds", http.StatusBadRequest)
+			return
+		}
+		w.Write(frame(1, `{"level":"info","message":"listening"}`+"\n"))
+		w.Write(frame(2, "panic: boom\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return socket, filtersSeen
+}
+
+func TestWatch(t *testing.T) {
+	socket, filtersSeen := fakeDaemon(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+
+	filters, _ := docker.ParseFilters([]string{"name=api"})
+	watched := make(chan struct{})
+	go func() {
+		docker.Watch(docker.NewClient(socket), filters, pipeline, ctx)
+		close(watched)
+	}()
+
+	if got := <-filtersSeen; !strings.Contains(got, `"name":["api"]`) {
+		t.Errorf("Expected name filter to be sent, got %s", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var count int
+	for time.Now().Before(deadline) {
+		db.QueryRow("SELECT count(*) FROM logs").Scan(&count)
+		if count == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 logs, got %d", count)
+	}
+
+	rows, err := db.Query(`
+		SELECT level, message,
+			json_extract_string(log, '$.source'),
+			json_extract_string(log, '$.container'),
+			json_extract_string(log, '$.container_id'),
+			json_extract_string(log, '$.image')
+		FROM logs ORDER BY message`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var got [][]string
+	for rows.Next() {
+		row := make([]string, 6)
+		if err := rows.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5]); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		got = append(got, row)
+	}
+
+	want := [][]string{
+		{"info", "listening", "stdout", "shop-api-1", "abc123", "shop/api:latest"},
+		{"error", "panic: boom", "stderr", "shop-api-1", "abc123", "shop/api:latest"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Watch returns once its followers have stopped.
+	cancel()
+	select {
+	case <-watched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Watch to return after cancelling")
+	}
+}
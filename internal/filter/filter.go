@@ -0,0 +1,501 @@
+// Package filter parses search filters such as
+//
+//	level:error service:api status>=500 "timeout" -path:/health
+//
+// into parameterized DuckDB conditions on the logs table, for people who
+// would rather not write SQL.
+//
+// A filter is a list of terms, all of which must match. Terms are:
+//
+//   - field:value, matching the field case-insensitively, with * as a
+//     wildcard unless the value is quoted. field:* matches any value.
+//   - field=value and field!=value, matching the value exactly.
+//   - field>value, field>=value, field<value and field<=value, comparing
+//     numbers, timestamps or else text.
+//   - a bare word or "quoted phrase", searched for in the message and raw
+//     line.
+//
+// Fields are columns of the logs table, such as level or trace_id, or else
+// fields in the log JSON, with dotted paths for nested fields. Terms can be
+// negated with - or NOT, combined with OR, and grouped with parentheses. AND
+// may be written between terms but is implied.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyntaxError reports where a filter could not be parsed.
+type SyntaxError struct {
+	// Offset is the byte offset of the problem in the filter.
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d: %s", e.Offset+1, e.Message)
+}
+
+// Filter is a parsed filter.
+type Filter struct {
+	root node
+}
+
+// Parse parses a filter. An empty filter matches every row.
+func Parse(input string) (*Filter, error) {
+	p := &parser{input: input}
+	p.skipSpace()
+	if p.eof() {
+		return &Filter{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf(p.pos, "unexpected %q", p.input[p.pos])
+	}
+	return &Filter{root: root}, nil
+}
+
+// SQL returns the filter as a condition on the logs table, with its
+// arguments.
+func (f *Filter) SQL() (string, []any) {
+	if f.root == nil {
+		return "TRUE", nil
+	}
+	var args []any
+	return f.root.sql(&args), args
+}
+
+// Compile parses a filter and returns it as a condition on the logs table,
+// with its arguments.
+func Compile(input string) (string, []any, error) {
+	f, err := Parse(input)
+	if err != nil {
+		return "", nil, err
+	}
+	condition, args := f.SQL()
+	return condition, args, nil
+}
+
+type kind int
+
+const (
+	textColumn kind = iota
+	numberColumn
+	timestampColumn
+	otherColumn
+	jsonField
+)
+
+// columns are the fields of the logs table that are used by name rather
+// than looked up in the log JSON.
+var columns = map[string]kind{
+	"id":            otherColumn,
+	"timestamp":     timestampColumn,
+	"created_at":    timestampColumn,
+	"first_seen":    timestampColumn,
+	"last_seen":     timestampColumn,
+	"level":         textColumn,
+	"trace_id":      textColumn,
+	"message":       textColumn,
+	"raw_log":       textColumn,
+	"log_format":    textColumn,
+	"parse_error":   textColumn,
+	"template_id":   textColumn,
+	"template":      textColumn,
+	"sample_weight": numberColumn,
+	"repeat_count":  numberColumn,
+}
+
+var fieldName = regexp.MustCompile(`^[A-Za-z_@][A-Za-z0-9_@-]*(\.[A-Za-z_@][A-Za-z0-9_@-]*)*$`)
+
+// Field returns the SQL expression for a field as text: the column of that
+// name, or else the field, or dotted path, in the log JSON. A dotted path
+// also matches a key containing the dots.
+func Field(name string) (string, error) {
+	if !fieldName.MatchString(name) {
+		return "", fmt.Errorf("invalid field %q", name)
+	}
+	expr, _ := field(name)
+	return expr, nil
+}
+
+// field returns the SQL expression for a valid field name as text, and what
+// kind of field it is.
+func field(name string) (string, kind) {
+	if name == "template" {
+		// The stored text of a row's template is out of date once the
+		// template has generalized, so look up its current text.
+		return "coalesce((SELECT t.template FROM templates t WHERE t.id = template_id), template)", textColumn
+	}
+	if k, ok := columns[name]; ok {
+		if k == textColumn {
+			return name, k
+		}
+		return name + "::TEXT", k
+	}
+	path := "$"
+	for _, part := range strings.Split(name, ".") {
+		path += `."` + part + `"`
+	}
+	if !strings.Contains(name, ".") {
+		return fmt.Sprintf("json_extract_string(log, '%s')", path), jsonField
+	}
+	// Some inputs, such as syslog structured data, store flat keys that
+	// contain dots.
+	return fmt.Sprintf(`coalesce(json_extract_string(log, '%s'), json_extract_string(log, '$."%s"'))`, path, name), jsonField
+}
+
+type node interface {
+	sql(args *[]any) string
+}
+
+type and []node
+
+func (n and) sql(args *[]any) string {
+	return join(n, " AND ", args)
+}
+
+type or []node
+
+func (n or) sql(args *[]any) string {
+	return join(n, " OR ", args)
+}
+
+func join(nodes []node, sep string, args *[]any) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.sql(args)
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+type not struct {
+	node
+}
+
+// sql treats a term that is NULL, such as a missing field, as not matching,
+// so that negating it matches.
+func (n not) sql(args *[]any) string {
+	return "NOT coalesce(" + n.node.sql(args) + ", FALSE)"
+}
+
+// text searches the message and raw line.
+type text struct {
+	value string
+}
+
+func (n text) sql(args *[]any) string {
+	pattern := "%" + escapeLike(n.value) + "%"
+	*args = append(*args, pattern, pattern)
+	return `(message ILIKE ? ESCAPE '\' OR raw_log ILIKE ? ESCAPE '\')`
+}
+
+// match compares a field with a value.
+type match struct {
+	field  string
+	op     string
+	value  string
+	quoted bool
+	// arg is the value to compare with for ordering operators, and cast
+	// whether the field must be cast to compare with it.
+	arg  any
+	cast string
+}
+
+func (n match) sql(args *[]any) string {
+	expr, _ := field(n.field)
+	switch n.op {
+	case ":":
+		if n.value == "*" && !n.quoted {
+			return expr + " IS NOT NULL"
+		}
+		pattern := escapeLike(n.value)
+		if !n.quoted {
+			pattern = strings.ReplaceAll(pattern, "*", "%")
+		}
+		*args = append(*args, pattern)
+		return expr + ` ILIKE ? ESCAPE '\'`
+	case "=":
+		*args = append(*args, n.value)
+		return expr + " = ?"
+	case "!=":
+		*args = append(*args, n.value)
+		return "NOT coalesce(" + expr + " = ?, FALSE)"
+	}
+
+	*args = append(*args, n.arg)
+	if n.cast == "TIMESTAMP" {
+		return n.field + " " + n.op + " ?"
+	}
+	if n.cast != "" {
+		expr = "TRY_CAST(" + expr + " AS " + n.cast + ")"
+	}
+	return expr + " " + n.op + " ?"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// timeLayouts are the formats accepted for timestamps in comparisons.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) errorf(offset int, format string, args ...any) error {
+	return &SyntaxError{Offset: offset, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// keyword consumes word if it is next in the input as a whole word.
+func (p *parser) keyword(word string) bool {
+	if !p.atKeyword(word) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *parser) atKeyword(word string) bool {
+	if !strings.HasPrefix(p.input[p.pos:], word) {
+		return false
+	}
+	end := p.pos + len(word)
+	return end == len(p.input) || isSpace(p.input[end]) || p.input[end] == '('
+}
+
+func (p *parser) parseOr() (node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := or{first}
+	for {
+		p.skipSpace()
+		if !p.keyword("OR") {
+			break
+		}
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var nodes and
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() == ')' || p.atKeyword("OR") {
+			break
+		}
+		p.keyword("AND")
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, p.errorf(p.pos, "expected a term")
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	p.skipSpace()
+	if p.peek() == '-' {
+		p.pos++
+		if p.eof() || isSpace(p.peek()) {
+			return nil, p.errorf(p.pos, "expected a term after -")
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	}
+	if p.keyword("NOT") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case 0:
+		return nil, p.errorf(p.pos, "expected a term")
+	case '(':
+		open := p.pos
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf(open, "unclosed (")
+		}
+		p.pos++
+		return n, nil
+	case ')':
+		return nil, p.errorf(p.pos, "unexpected )")
+	case '"':
+		value, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return text{value}, nil
+	}
+
+	start := p.pos
+	for !p.eof() && !isSpace(p.peek()) && !strings.ContainsRune(`()":=<>!`, rune(p.peek())) {
+		p.pos++
+	}
+	word := p.input[start:p.pos]
+
+	if p.eof() || !strings.ContainsRune(":=<>!", rune(p.peek())) {
+		if word == "" {
+			return nil, p.errorf(p.pos, "unexpected %q", p.peek())
+		}
+		return text{word}, nil
+	}
+
+	if word == "" {
+		return nil, p.errorf(start, "expected a field name before %q", p.peek())
+	}
+	if !fieldName.MatchString(word) {
+		return nil, p.errorf(start, "invalid field name %q", word)
+	}
+
+	opStart := p.pos
+	var op string
+	for _, candidate := range []string{"!=", "<=", ">=", ":", "=", "<", ">"} {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf(opStart, "expected != after %s", word)
+	}
+	p.pos += len(op)
+
+	m := match{field: word, op: op}
+	valueStart := p.pos
+	if p.peek() == '"' {
+		value, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		m.value, m.quoted = value, true
+	} else {
+		for !p.eof() && !isSpace(p.peek()) && p.peek() != ')' {
+			p.pos++
+		}
+		m.value = p.input[valueStart:p.pos]
+		if m.value == "" {
+			return nil, p.errorf(valueStart, "expected a value after %s%s", word, op)
+		}
+	}
+
+	switch op {
+	case "<", "<=", ">", ">=":
+		if err := m.comparison(); err != nil {
+			return nil, p.errorf(valueStart, "%v", err)
+		}
+	}
+	return m, nil
+}
+
+// comparison decides how a field is ordered against the value: as a
+// timestamp for timestamp columns, as a number if the value is one, or else
+// as text.
+func (m *match) comparison() error {
+	_, k := field(m.field)
+	if k == timestampColumn {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, m.value); err == nil {
+				m.arg, m.cast = t.UTC(), "TIMESTAMP"
+				return nil
+			}
+		}
+		return fmt.Errorf("expected a timestamp such as 2025-01-02T15:04:05Z for %s, got %q", m.field, m.value)
+	}
+	if n, err := strconv.ParseFloat(m.value, 64); err == nil && !m.quoted {
+		m.arg, m.cast = n, "DOUBLE"
+		return nil
+	}
+	m.arg = m.value
+	return nil
+}
+
+// parseQuoted reads a double-quoted string, in which \" and \\ stand for "
+// and \.
+func (p *parser) parseQuoted() (string, error) {
+	open := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.eof() {
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.input):
+			b.WriteByte(p.input[p.pos+1])
+			p.pos += 2
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf(open, "unclosed quote")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
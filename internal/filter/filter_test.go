@@ -0,0 +1,126 @@
+package filter_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input string
+		sql   string
+		args  []any
+	}{
+		{"", "TRUE", nil},
+		{"level:error", `level ILIKE ? ESCAPE '\'`, []any{"error"}},
+		{
+			"service:api",
+			`json_extract_string(log, '$."service"') ILIKE ? ESCAPE '\'`,
+			[]any{"api"},
+		},
+		{
+			"request.method=GET",
+			`coalesce(json_extract_string(log, '$."request"."method"'), json_extract_string(log, '$."request.method"')) = ?`,
+			[]any{"GET"},
+		},
+		{
+			"status>=500",
+			`TRY_CAST(json_extract_string(log, '$."status"') AS DOUBLE) >= ?`,
+			[]any{float64(500)},
+		},
+		{
+			"timestamp<2025-01-02",
+			`timestamp < ?`,
+			[]any{time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{"version>v1.2", `json_extract_string(log, '$."version"') > ?`, []any{"v1.2"}},
+		{"timeout", `(message ILIKE ? ESCAPE '\' OR raw_log ILIKE ? ESCAPE '\')`, []any{"%timeout%", "%timeout%"}},
+		{
+			`"connection reset" 100%`,
+			`((message ILIKE ? ESCAPE '\' OR raw_log ILIKE ? ESCAPE '\') AND (message ILIKE ? ESCAPE '\' OR raw_log ILIKE ? ESCAPE '\'))`,
+			[]any{"%connection reset%", "%connection reset%", `%100\%%`, `%100\%%`},
+		},
+		{"path:/api/*", `json_extract_string(log, '$."path"') ILIKE ? ESCAPE '\'`, []any{"/api/%"}},
+		{`path:"/api/*"`, `json_extract_string(log, '$."path"') ILIKE ? ESCAPE '\'`, []any{"/api/*"}},
+		{"user_id:*", `json_extract_string(log, '$."user_id"') IS NOT NULL`, nil},
+		{
+			"-path:/health",
+			`NOT coalesce(json_extract_string(log, '$."path"') ILIKE ? ESCAPE '\', FALSE)`,
+			[]any{"/health"},
+		},
+		{"level!=debug", `NOT coalesce(level = ?, FALSE)`, []any{"debug"}},
+		{
+			"level:error OR level:warn service:api",
+			`(level ILIKE ? ESCAPE '\' OR (level ILIKE ? ESCAPE '\' AND json_extract_string(log, '$."service"') ILIKE ? ESCAPE '\'))`,
+			[]any{"error", "warn", "api"},
+		},
+		{
+			"(level:error OR level:warn) AND NOT trace_id:*",
+			`((level ILIKE ? ESCAPE '\' OR level ILIKE ? ESCAPE '\') AND NOT coalesce(trace_id IS NOT NULL, FALSE))`,
+			[]any{"error", "warn"},
+		},
+		{"repeat_count>1", `TRY_CAST(repeat_count::TEXT AS DOUBLE) > ?`, []any{float64(1)}},
+		{`message:"say \"hi\""`, `message ILIKE ? ESCAPE '\'`, []any{`say "hi"`}},
+		{"ORDER", `(message ILIKE ? ESCAPE '\' OR raw_log ILIKE ? ESCAPE '\')`, []any{"%ORDER%", "%ORDER%"}},
+	}
+
+	for _, tt := range tests {
+		sql, args, err := filter.Compile(tt.input)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if sql != tt.sql {
+			t.Errorf("Compile(%q) = %s, expected %s", tt.input, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Compile(%q) args = %#v, expected %#v", tt.input, args, tt.args)
+		}
+	}
+}
+
+func TestCompile_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+	}{
+		{"level:", 6},
+		{"(level:error", 0},
+		{"level:error)", 11},
+		{`"unclosed`, 0},
+		{"status>=fast timestamp>yesterday", 23},
+		{":error", 0},
+		{"a OR", 4},
+		{"- level:error", 1},
+		{"level!error", 5},
+		{"9lives:yes", 0},
+	}
+
+	for _, tt := range tests {
+		_, _, err := filter.Compile(tt.input)
+		var syntaxErr *filter.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Compile(%q) = %v, expected a syntax error", tt.input, err)
+			continue
+		}
+		if syntaxErr.Offset != tt.offset {
+			t.Errorf("Compile(%q) error at %d, expected %d: %v", tt.input, syntaxErr.Offset, tt.offset, err)
+		}
+	}
+}
+
+func TestField(t *testing.T) {
+	if expr, err := filter.Field("level"); err != nil || expr != "level" {
+		t.Errorf("Unexpected column expression %q (%v)", expr, err)
+	}
+	if expr, err := filter.Field("sample_weight"); err != nil || expr != "sample_weight::TEXT" {
+		t.Errorf("Unexpected column expression %q (%v)", expr, err)
+	}
+	if _, err := filter.Field("level'; DROP TABLE logs"); err == nil {
+		t.Error("Expected an invalid field to be rejected")
+	}
+}
@@ -0,0 +1,281 @@
+// Package importer ingests log files from disk, transparently decompressing
+// gzip, zstd and bzip2 files and walking tar archives.
+package importer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+// Summary totals the files and lines handled by Import.
+type Summary struct {
+	ingest.Stats
+	Files    int
+	Skipped  int
+	Duration time.Duration
+}
+
+func (s *Summary) add(stats ingest.Stats) {
+	s.Files++
+	s.Stats.Merge(stats)
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d files (%d skipped) in %s, %.0f lines/s: %s",
+		s.Files, s.Skipped, s.Duration.Round(time.Millisecond), s.LinesPerSecond(), s.Stats)
+}
+
+func (s Summary) LinesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Lines) / s.Duration.Seconds()
+}
+
+// Import ingests each path, descending into directories. Archive members are
+// recorded with their path inside the archive as the source and the archive
+// path in an "archive" field. Progress is written to progress if it is not nil.
+func Import(paths []string, pipeline *ingest.Pipeline, progress io.Writer, ctx context.Context) (Summary, error) {
+	imp := &importer{pipeline: pipeline, start: time.Now(), ctx: ctx}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := imp.importFile(path, progress); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("⚠️ Skipping %s: %v", path, err)
+				imp.summary.Skipped++
+			}
+			return nil
+		})
+		if err != nil {
+			imp.summary.Duration = time.Since(imp.start)
+			return imp.summary, err
+		}
+	}
+
+	imp.summary.Duration = time.Since(imp.start)
+	return imp.summary, nil
+}
+
+type importer struct {
+	pipeline *ingest.Pipeline
+	summary  Summary
+	start    time.Time
+	// Bytes read from the current file and lines read across all files.
+	read  atomic.Int64
+	lines atomic.Int64
+	ctx   context.Context
+}
+
+func (imp *importer) importFile(path string, progress io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	imp.read.Store(0)
+	if progress != nil {
+		stop := imp.reportProgress(path, info.Size(), progress)
+		defer stop()
+	}
+
+	return imp.importStream(path, "", &countingReader{r: f, n: &imp.read})
+}
+
+// importStream decompresses r if needed, then either walks it as a tar
+// archive or ingests it as lines. Members are handled recursively so that
+// compressed files inside archives are also expanded.
+func (imp *importer) importStream(name, archive string, r io.Reader) error {
+	rc, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReaderSize(rc, 64*1024)
+	if isTar(br) {
+		if archive == "" {
+			archive = name
+		}
+		return imp.importTar(archive, br)
+	}
+
+	memberPipeline := imp.pipeline.WithSource(name)
+	if archive != "" {
+		memberPipeline = memberPipeline.WithFields(shared.LogEntry{"archive": archive})
+	}
+
+	stats, err := memberPipeline.Ingest(&lineCountingReader{r: br, n: &imp.lines}, imp.ctx)
+	imp.summary.add(stats)
+	return err
+}
+
+func (imp *importer) importTar(archive string, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := imp.importStream(header.Name, archive, tr); err != nil {
+			if imp.ctx.Err() != nil {
+				return imp.ctx.Err()
+			}
+			log.Printf("⚠️ Skipping %s in %s: %v", header.Name, archive, err)
+			imp.summary.Skipped++
+		}
+	}
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// Decompress detects gzip, zstd and bzip2 data by its magic bytes and returns
+// a reader for the decompressed content. Other data is returned unchanged.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// isTar reports whether the stream starts with a POSIX or GNU tar header.
+func isTar(br *bufio.Reader) bool {
+	header, err := br.Peek(512)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(header[257:], []byte("ustar"))
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type lineCountingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *lineCountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(bytes.Count(p[:n], []byte{'\n'})))
+	return n, err
+}
+
+// reportProgress periodically writes how much of a file has been read and
+// the overall ingest rate. The returned function stops reporting and prints
+// the final state.
+func (imp *importer) reportProgress(path string, size int64, w io.Writer) func() {
+	show := func() {
+		percent := 100.0
+		if size > 0 {
+			percent = float64(imp.read.Load()) / float64(size) * 100
+		}
+		lines := imp.lines.Load()
+		rate := float64(lines) / time.Since(imp.start).Seconds()
+		fmt.Fprintf(w, "\r📥 %s: %5.1f%% of %s, %d lines (%.0f lines/s)", path, percent, formatBytes(size), lines, rate)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				show()
+			case <-done:
+				show()
+				fmt.Fprintln(w)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
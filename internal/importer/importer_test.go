@@ -0,0 +1,170 @@
+package importer_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/paul-schwendenman/magic-log-ui/internal/importer"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+// bzip2 of "{\"message\":\"from bzip2\"}\nnot json\n"; the standard library
+// can only decompress bzip2.
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xf6, 0xd4, 0xfc, 0x16, 0x00, 0x00,
+	0x10, 0x59, 0x80, 0x00, 0x10, 0x50, 0x00, 0x10, 0x10, 0x33, 0xb3, 0xdc, 0x1a, 0x20, 0x00, 0x31,
+	0x46, 0x8c, 0x81, 0xa3, 0x4c, 0x8d, 0x0a, 0x00, 0x64, 0x34, 0xd0, 0xda, 0x81, 0x13, 0xd8, 0x20,
+	0x7d, 0xc3, 0x65, 0x4e, 0x68, 0x28, 0xd3, 0x82, 0x82, 0x56, 0x69, 0x0e, 0xdc, 0x11, 0xfc, 0x5d,
+	0xc9, 0x14, 0xe1, 0x42, 0x43, 0xdb, 0x53, 0xf0, 0x58,
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+func tarBytes(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "var/log/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, name := range []string{"var/log/api.log", "var/log/worker.log.gz"} {
+		data := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	plain := write("plain.log", []byte(`{"message":"plain"}`+"\n"))
+	os.MkdirAll(filepath.Join(dir, "rotated"), 0755)
+	write("rotated/app.log.1.gz", gzipBytes(t, []byte(`{"message":"from gzip"}`+"\n")))
+	write("rotated/app.log.2.zst", zstdBytes(t, []byte(`{"message":"from zstd"}`+"\n")))
+	bz := write("old.log.bz2", bzip2Data)
+	bundle := write("bundle.tar.gz", gzipBytes(t, tarBytes(t, map[string][]byte{
+		"var/log/api.log":       []byte(`{"message":"from tar"}` + "\n"),
+		"var/log/worker.log.gz": gzipBytes(t, []byte(`{"message":"nested gzip"}`+"\n")),
+	})))
+
+	summary, err := importer.Import([]string{plain, filepath.Join(dir, "rotated"), bz, bundle}, pipeline, nil, ctx)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if summary.Files != 6 || summary.Lines != 7 || summary.Parsed != 6 || summary.Raw != 1 || summary.Skipped != 0 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	rows, err := db.Query(`
+		SELECT message, json_extract_string(log, '$.source'), coalesce(json_extract_string(log, '$.archive'), '')
+		FROM logs WHERE level != 'raw' ORDER BY message`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var got [][3]string
+	for rows.Next() {
+		var row [3]string
+		if err := rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+
+	want := [][3]string{
+		{"from bzip2", bz, ""},
+		{"from gzip", filepath.Join(dir, "rotated/app.log.1.gz"), ""},
+		{"from tar", "var/log/api.log", bundle},
+		{"from zstd", filepath.Join(dir, "rotated/app.log.2.zst"), ""},
+		{"nested gzip", "var/log/worker.log.gz", bundle},
+		{"plain", plain, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestImport_MissingPath(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+
+	if _, err := importer.Import([]string{filepath.Join(t.TempDir(), "missing.log")}, pipeline, nil, ctx); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
+
+func TestImport_BadCSVHeader(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "csv", "", "", "", true, false)
+
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.csv")
+	good := filepath.Join(dir, "good.csv")
+	os.WriteFile(bad, []byte("\"level,message\nerror,lost\n"), 0644)
+	os.WriteFile(good, []byte("level,message\ninfo,kept\n"), 0644)
+
+	summary, err := importer.Import([]string{bad, good}, pipeline, nil, ctx)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if summary.Skipped != 1 || summary.Lines != 1 {
+		t.Errorf("Expected the bad file to be skipped, got %+v", summary)
+	}
+
+	var message string
+	if err := db.QueryRow(`SELECT message FROM logs`).Scan(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message != "kept" {
+		t.Errorf("Expected the good file to be imported, got %q", message)
+	}
+}
@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+// CRILine is a single line written by a container runtime, as found in
+// /var/log/containers or the output of kubectl logs --timestamps.
+type CRILine struct {
+	Timestamp string
+	Stream    string
+	Partial   bool
+	Content   string
+}
+
+// ParseCRI splits a line in the CRI logging format:
+//
+//	2024-01-01T00:00:00.123456789Z stdout F {"message":"hello"}
+//
+// The tag is F for a full line or P for a partial line that continues on the
+// next line from the same stream.
+func ParseCRI(line string) (CRILine, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return CRILine{}, fmt.Errorf("not a CRI log line")
+	}
+
+	ts, stream, tag := parts[0], parts[1], parts[2]
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		return CRILine{}, fmt.Errorf("invalid CRI timestamp %q", ts)
+	}
+	if stream != "stdout" && stream != "stderr" {
+		return CRILine{}, fmt.Errorf("invalid CRI stream %q", stream)
+	}
+
+	// The tag may carry further flags separated by colons.
+	flag, _, _ := strings.Cut(tag, ":")
+	if flag != "F" && flag != "P" {
+		return CRILine{}, fmt.Errorf("invalid CRI tag %q", tag)
+	}
+
+	content := ""
+	if len(parts) == 4 {
+		content = parts[3]
+	}
+
+	return CRILine{Timestamp: ts, Stream: stream, Partial: flag == "P", Content: content}, nil
+}
+
+func (l CRILine) String() string {
+	tag := "F"
+	if l.Partial {
+		tag = "P"
+	}
+	return l.Timestamp + " " + l.Stream + " " + tag + " " + l.Content
+}
+
+// criAssembler joins partial lines into complete records. Partial lines are
+// tracked per stream since stdout and stderr may be interleaved.
+type criAssembler struct {
+	pending map[string]*CRILine
+}
+
+func newCRIAssembler() *criAssembler {
+	return &criAssembler{pending: map[string]*CRILine{}}
+}
+
+// add returns the line to process once a record is complete. Lines that are
+// not in CRI format are passed through unchanged.
+func (a *criAssembler) add(rawLine string) (string, bool) {
+	line, err := ParseCRI(rawLine)
+	if err != nil {
+		return rawLine, true
+	}
+
+	if pending, ok := a.pending[line.Stream]; ok {
+		pending.Content += line.Content
+		pending.Partial = line.Partial
+		line = *pending
+	}
+
+	if line.Partial {
+		a.pending[line.Stream] = &line
+		return "", false
+	}
+
+	delete(a.pending, line.Stream)
+	return line.String(), true
+}
+
+// flush returns any partial records left when the input ends.
+func (a *criAssembler) flush() []string {
+	var lines []string
+	for _, stream := range []string{"stdout", "stderr"} {
+		if pending, ok := a.pending[stream]; ok {
+			pending.Partial = false
+			lines = append(lines, pending.String())
+		}
+	}
+	a.pending = map[string]*CRILine{}
+	return lines
+}
+
+// parseCRIEntry parses the payload of a CRI line as JSON, falling back to the
+// configured regex. The CRI stream is recorded as the source, and the CRI
+// timestamp is used unless the payload has its own.
+func parseCRIEntry(rawLine string, p parsers) (shared.LogEntry, bool, *ParseError) {
+	line, err := ParseCRI(rawLine)
+	if err != nil {
+		return fallbackEntry(rawLine, p), false, newParseError("cri", err)
+	}
+
+	entry, ok, parseErr := parsePayload(line.Content, p, true)
+
+	if _, exists := entry["timestamp"]; !exists {
+		entry["timestamp"] = line.Timestamp
+	}
+	if _, exists := entry["source"]; !exists {
+		entry["source"] = line.Stream
+	}
+
+	return entry, ok, parseErr
+}
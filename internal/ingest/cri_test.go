@@ -0,0 +1,95 @@
+package ingest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+)
+
+func TestParseCRI(t *testing.T) {
+	line, err := ingest.ParseCRI(`2024-01-01T00:00:00.123456789Z stderr P {"level":"warn",`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if line.Timestamp != "2024-01-01T00:00:00.123456789Z" || line.Stream != "stderr" || !line.Partial {
+		t.Errorf("Unexpected header: %+v", line)
+	}
+	if line.Content != `{"level":"warn",` {
+		t.Errorf("Unexpected content %q", line.Content)
+	}
+
+	for _, bad := range []string{
+		"hello world",
+		"2024-01-01T00:00:00Z stdin F hi",
+		"2024-01-01T00:00:00Z stdout X hi",
+	} {
+		if _, err := ingest.ParseCRI(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestIngest_CRIReassemblesPartialLines(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	input := strings.NewReader(strings.Join([]string{
+		`2024-01-01T00:00:01.5Z stdout P {"trace_id":"cri1","message":"hel`,
+		`2024-01-01T00:00:02Z stderr F boom`,
+		`2024-01-01T00:00:03Z stdout P lo wor`,
+		`2024-01-01T00:00:04Z stdout F ld"}`,
+	}, "\n") + "\n")
+
+	<-ingest.Start(input, stmt, "cri", "", "", "", false, false, ctx)
+
+	var count int
+	db.QueryRow(`SELECT count(*) FROM logs`).Scan(&count)
+	if count != 2 {
+		t.Fatalf("Expected 2 records, got %d", count)
+	}
+
+	var msg, source, ts, raw string
+	err := db.QueryRow(`SELECT message, json_extract_string(log, '$.source'), strftime(timestamp, '%Y-%m-%dT%H:%M:%S'), raw_log FROM logs WHERE trace_id = 'cri1'`).Scan(&msg, &source, &ts, &raw)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if msg != "hello world" {
+		t.Errorf("Expected reassembled message 'hello world', got %q", msg)
+	}
+	if source != "stdout" {
+		t.Errorf("Expected source 'stdout', got %q", source)
+	}
+	if ts != "2024-01-01T00:00:01" {
+		t.Errorf("Expected timestamp of the first partial line, got %s", ts)
+	}
+	if !strings.HasSuffix(raw, ` F {"trace_id":"cri1","message":"hello world"}`) {
+		t.Errorf("Unexpected raw log %q", raw)
+	}
+
+	var level string
+	if err := db.QueryRow(`SELECT message, level, json_extract_string(log, '$.source') FROM logs WHERE message = 'boom'`).Scan(&msg, &level, &source); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if level != "raw" || source != "stderr" {
+		t.Errorf("Expected raw stderr entry, got level %q source %q", level, source)
+	}
+}
+
+func TestIngest_CRIPayloadWithRegex(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	input := strings.NewReader("2024-01-01T00:00:00Z stdout F [WARN] disk almost full\n")
+	regex := `^\[(?P<level>\w+)] (?P<message>.+)$`
+
+	<-ingest.Start(input, stmt, "cri", regex, "", "", false, false, ctx)
+
+	var msg, level string
+	if err := db.QueryRow(`SELECT message, level FROM logs`).Scan(&msg, &level); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if msg != "disk almost full" || level != "WARN" {
+		t.Errorf("Expected regex-parsed payload, got %q/%q", msg, level)
+	}
+}
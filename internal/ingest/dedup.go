@@ -0,0 +1,232 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/handlers"
+)
+
+// Dedup modes decide when two lines are repeats of each other.
+const (
+	// DedupExact collapses lines with the same level, source and message.
+	DedupExact = "exact"
+	// DedupNumbers also collapses messages that differ only in numbers, such
+	// as retry counts or durations.
+	DedupNumbers = "numbers"
+)
+
+var DedupModes = []string{DedupExact, DedupNumbers}
+
+// dedupFlushInterval is how often repeat counts are written to the database
+// and sent to WebSocket clients.
+const dedupFlushInterval = time.Second
+
+var numbers = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// Execer runs a statement against the database. It is satisfied by *sql.DB.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Deduper collapses repeated lines into the row stored for the first of them.
+// Repeats seen within the window are counted rather than stored, and the
+// row's repeat_count and last_seen are brought up to date in the background.
+// It is shared by every pipeline writing to the same database.
+type Deduper struct {
+	db     Execer
+	mode   string
+	window time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*repeatGroup
+	// expired holds groups replaced before their last count was written.
+	expired []*repeatGroup
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// repeatGroup is a stored row and the repeats collapsed into it.
+type repeatGroup struct {
+	id        string
+	firstSeen time.Time
+	lastSeen  time.Time
+	count     int
+	written   int
+	// stored is set once the first row has been inserted, as it cannot be
+	// updated before then.
+	stored bool
+}
+
+// NewDeduper starts collapsing repeats seen within window. Call Close once
+// the pipelines using it have finished, before closing the database.
+func NewDeduper(db Execer, mode string, window time.Duration) (*Deduper, error) {
+	switch mode {
+	case DedupExact, DedupNumbers:
+	default:
+		return nil, fmt.Errorf("unknown dedup mode %q (expected one of %s)", mode, strings.Join(DedupModes, ", "))
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("dedup window must be positive, got %s", window)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	d := &Deduper{
+		db:     db,
+		mode:   mode,
+		window: window,
+		now:    time.Now,
+		groups: map[string]*repeatGroup{},
+		stop:   stop,
+		done:   make(chan struct{}),
+	}
+	go d.run(ctx)
+	return d, nil
+}
+
+// Close writes the outstanding repeat counts and stops the background flush.
+func (d *Deduper) Close() {
+	if d == nil {
+		return
+	}
+	d.stop()
+	<-d.done
+}
+
+func (d *Deduper) run(ctx context.Context) {
+	defer close(d.done)
+
+	ticker := time.NewTicker(dedupFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flush()
+		case <-ctx.Done():
+			d.flush()
+			return
+		}
+	}
+}
+
+// check reports whether line repeats an earlier one. If not, the line starts
+// a new group for later repeats to be counted against.
+func (d *Deduper) check(line prepared) (prepared, bool) {
+	key := d.key(line)
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if g, ok := d.groups[key]; ok {
+		if now.Sub(g.firstSeen) <= d.window {
+			g.count++
+			g.lastSeen = now
+			line.repeat = true
+			return line, true
+		}
+		if g.count > g.written || !g.stored {
+			d.expired = append(d.expired, g)
+		}
+	}
+
+	g := &repeatGroup{id: line.id, firstSeen: now, lastSeen: now, count: 1, written: 1}
+	d.groups[key] = g
+	line.group = g
+	return line, false
+}
+
+// inserted records the outcome of storing a group's first row. If it failed
+// the group is forgotten, so the next repeat is stored in its place.
+func (d *Deduper) inserted(g *repeatGroup, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err != nil {
+		for key, existing := range d.groups {
+			if existing == g {
+				delete(d.groups, key)
+			}
+		}
+		// There is no row to count repeats against.
+		g.written = g.count
+	}
+	g.stored = true
+}
+
+func (d *Deduper) key(line prepared) string {
+	message, ok := safeString(line.transformed, "message")
+	if !ok {
+		message = line.rawLine
+	}
+	if d.mode == DedupNumbers {
+		message = numbers.ReplaceAllString(message, "#")
+	}
+	level, _ := safeString(line.transformed, "level")
+	source, _ := safeString(line.transformed, "source")
+	return level + "\x00" + source + "\x00" + message
+}
+
+type repeatUpdate struct {
+	id       string
+	count    int
+	lastSeen time.Time
+}
+
+// flush writes the counts that changed since the last flush and forgets
+// groups whose window has passed.
+func (d *Deduper) flush() {
+	d.mu.Lock()
+	now := d.now()
+	var updates []repeatUpdate
+	pending := func(g *repeatGroup) bool {
+		if !g.stored {
+			return true
+		}
+		if g.count > g.written {
+			updates = append(updates, repeatUpdate{id: g.id, count: g.count, lastSeen: g.lastSeen})
+			g.written = g.count
+		}
+		return false
+	}
+
+	expired := d.expired[:0]
+	for _, g := range d.expired {
+		if pending(g) {
+			expired = append(expired, g)
+		}
+	}
+	d.expired = expired
+
+	for key, g := range d.groups {
+		if !pending(g) && now.Sub(g.firstSeen) > d.window {
+			delete(d.groups, key)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, u := range updates {
+		_, err := d.db.ExecContext(context.Background(), `UPDATE logs SET repeat_count = ?, last_seen = ? WHERE id = ?`, u.count, u.lastSeen.UTC(), u.id)
+		if err != nil {
+			log.Printf("❌ Failed to update repeat count: %v", err)
+			continue
+		}
+		lastSeen := u.lastSeen.UTC()
+		handlers.Notify(handlers.Event{
+			Event:       "repeated",
+			Message:     fmt.Sprintf("repeated %d times", u.count),
+			ID:          u.id,
+			RepeatCount: u.count,
+			LastSeen:    &lastSeen,
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"io"
@@ -15,50 +16,425 @@ import (
 	"time"
 
 	"github.com/paul-schwendenman/magic-log-ui/internal/jqfilter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server/handlers"
 	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
 )
 
 type parsers struct {
-	logFormat  string
-	parseRegex *regexp.Regexp
-	jqEnabled  bool
-	jqFilter   string
-	csvFields  []string
+	logFormat     string
+	parseRegex    *regexp.Regexp
+	jqEnabled     bool
+	jqFilter      string
+	csvFields     []string
+	fallbackLevel string
 }
 
-func Start(input io.Reader, stmt *sql.Stmt, logFormat, parseRegexStr, jqQuery, csvFieldsStr string, hasCSVHeader bool, echo bool, ctx context.Context) {
+// Inserter stores a row in the logs table. It is satisfied by the statement
+// from logdb.MustPrepareInsert and by logdb.Appender for bulk loads.
+type Inserter interface {
+	ExecContext(ctx context.Context, args ...any) (sql.Result, error)
+}
+
+// Pipeline runs individual log lines through the extract, transform and load
+// stages. It is shared by stdin ingestion and the network listeners.
+type Pipeline struct {
+	stmt         Inserter
+	parsers      parsers
+	hasCSVHeader bool
+	echo         bool
+	noBroadcast  bool
+	source       string
+	fields       shared.LogEntry
+	buffer       BufferOptions
+	redactor     *redact.Redactor
+	sampler      *sampling.Sampler
+	dedup        *Deduper
+	templates    *templates.Miner
+}
+
+func NewPipeline(stmt Inserter, logFormat, parseRegexStr, jqQuery, csvFieldsStr string, hasCSVHeader bool, echo bool) *Pipeline {
+	return &Pipeline{
+		stmt:         stmt,
+		parsers:      buildParsers(logFormat, parseRegexStr, jqQuery, csvFieldsStr, hasCSVHeader),
+		hasCSVHeader: hasCSVHeader,
+		echo:         echo,
+	}
+}
+
+// WithLogFormat returns a copy of the pipeline that parses and records lines
+// using a different log format.
+func (p *Pipeline) WithLogFormat(logFormat string) *Pipeline {
+	clone := *p
+	clone.parsers.logFormat = logFormat
+	return &clone
+}
+
+// WithSource returns a copy of the pipeline that tags every entry with a
+// source field, such as "stdout" or "stderr" for a child process.
+func (p *Pipeline) WithSource(source string) *Pipeline {
+	clone := *p
+	clone.source = source
+	return &clone
+}
+
+// WithFields returns a copy of the pipeline that adds fields to every entry
+// that does not already have them, such as the container a line came from.
+func (p *Pipeline) WithFields(fields shared.LogEntry) *Pipeline {
+	clone := *p
+	clone.fields = fields
+	return &clone
+}
+
+// WithBuffer returns a copy of the pipeline that uses opts for the stages run
+// by Ingest. Options left unset keep their defaults.
+func (p *Pipeline) WithBuffer(opts BufferOptions) *Pipeline {
+	clone := *p
+	clone.buffer = opts
+	return &clone
+}
+
+// WithRedactor returns a copy of the pipeline that removes secrets from every
+// line before it is stored, broadcast or echoed. A nil redactor disables
+// redaction.
+func (p *Pipeline) WithRedactor(r *redact.Redactor) *Pipeline {
+	clone := *p
+	clone.redactor = r
+	return &clone
+}
+
+// WithSampler returns a copy of the pipeline that only stores the entries the
+// sampler keeps. A nil sampler keeps every entry.
+func (p *Pipeline) WithSampler(s *sampling.Sampler) *Pipeline {
+	clone := *p
+	clone.sampler = s
+	return &clone
+}
+
+// WithDedup returns a copy of the pipeline that collapses repeated lines into
+// the row stored for the first of them. A nil deduper stores every line.
+func (p *Pipeline) WithDedup(d *Deduper) *Pipeline {
+	clone := *p
+	clone.dedup = d
+	return &clone
+}
+
+// WithTemplates returns a copy of the pipeline that tags every entry with the
+// template of its message. A nil miner leaves entries untagged.
+func (p *Pipeline) WithTemplates(m *templates.Miner) *Pipeline {
+	clone := *p
+	clone.templates = m
+	return &clone
+}
+
+// WithoutBroadcast returns a copy of the pipeline that does not send entries
+// to WebSocket clients, for bulk loads without a web server.
+func (p *Pipeline) WithoutBroadcast() *Pipeline {
+	clone := *p
+	clone.noBroadcast = true
+	return &clone
+}
+
+// WithFallbackLevel returns a copy of the pipeline that uses level for lines
+// that could not be parsed, instead of "raw", or that carry no level of their
+// own.
+func (p *Pipeline) WithFallbackLevel(level string) *Pipeline {
+	clone := *p
+	clone.parsers.fallbackLevel = level
+	return &clone
+}
+
+// ExpectsCSVHeader reports whether each input starts with a CSV header row.
+func (p *Pipeline) ExpectsCSVHeader() bool {
+	return p.parsers.logFormat == "csv" && p.hasCSVHeader
+}
+
+// WithCSVHeader returns a copy of the pipeline that names CSV columns after
+// a header row, unless the fields were given explicitly.
+func (p *Pipeline) WithCSVHeader(rawLine string) (*Pipeline, error) {
+	clone := *p
+	if err := clone.readCSVHeader(rawLine); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+func (p *Pipeline) readCSVHeader(rawLine string) error {
+	header, err := readCSV(rawLine)
+	if err != nil {
+		return err
+	}
+	if p.parsers.csvFields == nil {
+		p.parsers.csvFields = header
+	}
+	return nil
+}
+
+// Process parses a raw line using the pipeline's log format and stores it.
+func (p *Pipeline) Process(rawLine string, ctx context.Context) error {
+	_, _, err := p.process(rawLine, ctx)
+	return err
+}
+
+// process is Process, also reporting whether the line was parsed rather than
+// stored as a fallback entry, and why parsing failed.
+func (p *Pipeline) process(rawLine string, ctx context.Context) (bool, *ParseError, error) {
+	parsed, ok, parseErr := extract(rawLine, p.parsers)
+	parseErr, err := p.store(rawLine, parsed, ok, parseErr, ctx)
+	return ok, parseErr, err
+}
+
+// ProcessParsed stores an entry that was already parsed by the caller, such as
+// a syslog message read from the network.
+func (p *Pipeline) ProcessParsed(rawLine string, parsed shared.LogEntry, ctx context.Context) error {
+	_, err := p.store(rawLine, parsed, true, nil, ctx)
+	return err
+}
+
+func (p *Pipeline) store(rawLine string, parsed shared.LogEntry, ok bool, parseErr *ParseError, ctx context.Context) (*ParseError, error) {
+	line := p.admit(p.prepare(rawLine, parsed, ok, parseErr))
+	if line.weight == 0 {
+		p.finish(line, nil)
+		return line.parseErr, nil
+	}
+	if p.dedup != nil {
+		var repeat bool
+		if line, repeat = p.dedup.check(line); repeat {
+			p.finish(line, nil)
+			return line.parseErr, nil
+		}
+	}
+
+	// A line that has been read is stored even if ctx is cancelled, so that
+	// shutting down does not lose it.
+	start := time.Now()
+	_, err := p.stmt.ExecContext(context.WithoutCancel(ctx), line.row(p.parsers)...)
+	insertDuration.Observe(time.Since(start).Seconds())
+	if line.group != nil {
+		p.dedup.inserted(line.group, err)
+	}
+	p.finish(line, err)
+
+	broadcast(line, p.echo, !p.noBroadcast)
+
+	return line.parseErr, err
+}
+
+// prepared is a line that has been through the extract and transform stages
+// and is ready to load.
+type prepared struct {
+	// id is the id the line is stored with.
+	id          string
+	rawLine     string
+	parsed      shared.LogEntry
+	transformed shared.LogEntry
+	ok          bool
+	parseErr    *ParseError
+	// weight is the number of lines the entry stands for when sampling, or 0
+	// if it was sampled out and should not be stored.
+	weight int
+	// group is set when deduplicating, for the row later repeats are counted
+	// against. repeat is set instead if the line was collapsed into an
+	// earlier row.
+	group  *repeatGroup
+	repeat bool
+	// templateID and template are set when mining templates.
+	templateID string
+	template   string
+}
+
+// prepare transforms a parsed line and adds the pipeline's own fields.
+func (p *Pipeline) prepare(rawLine string, parsed shared.LogEntry, ok bool, parseErr *ParseError) prepared {
+	transformed, jqErr := transform(parsed, p.parsers)
+	if parseErr == nil {
+		parseErr = jqErr
+	}
+	if p.source != "" {
+		if _, exists := transformed["source"]; !exists {
+			transformed["source"] = p.source
+		}
+	}
+	for k, v := range p.fields {
+		if _, exists := transformed[k]; !exists {
+			transformed[k] = v
+		}
+	}
+	if p.parsers.fallbackLevel != "" {
+		if _, exists := transformed["level"]; !exists {
+			transformed["level"] = p.parsers.fallbackLevel
+		}
+	}
+
+	line := prepared{rawLine: rawLine, parsed: parsed, transformed: transformed, ok: ok, parseErr: parseErr, weight: 1}
+	if p.redactor != nil {
+		line = line.redact(p.redactor)
+	}
+	return line
+}
+
+// admit samples a prepared line and mines its template. Both depend on the
+// lines seen before, so admit is called in the order the lines were read
+// rather than by the extract workers.
+func (p *Pipeline) admit(line prepared) prepared {
+	line.id = uuid.New().String()
+	if p.sampler != nil {
+		if line.weight = p.sampler.Sample(line.transformed, line.id); line.weight == 0 {
+			return line
+		}
+	}
+	if p.templates != nil {
+		// Mined after redaction, so templates never contain secrets.
+		if message, ok := safeString(line.transformed, "message"); ok {
+			line.templateID, line.template = p.templates.Match(message)
+		}
+	}
+	return line
+}
+
+// redact removes secrets from every copy of the line. Values removed from the
+// entries are also removed from the raw line, so a dropped password field does
+// not survive in raw_log.
+func (line prepared) redact(r *redact.Redactor) prepared {
+	secrets := redact.Secrets{}
+	line.parsed = r.Entry(line.parsed, secrets)
+	line.transformed = r.Entry(line.transformed, secrets)
+	line.rawLine = r.Line(line.rawLine, secrets)
+	return line
+}
+
+// finish records the outcome of loading a line.
+func (p *Pipeline) finish(line prepared, err error) {
+	switch {
+	case line.weight == 0:
+		recordSampled(p.parsers.logFormat)
+		return
+	case line.repeat:
+		recordRepeat(p.parsers.logFormat)
+		return
+	}
+	record(p.parsers.logFormat, p.source, line.rawLine, line.ok, line.parseErr, err)
+}
+
+// Start runs a new pipeline over input in the background. The returned channel
+// receives the counts once the input is exhausted and every line is stored.
+func Start(input io.Reader, stmt Inserter, logFormat, parseRegexStr, jqQuery, csvFieldsStr string, hasCSVHeader bool, echo bool, ctx context.Context) <-chan Stats {
+	return NewPipeline(stmt, logFormat, parseRegexStr, jqQuery, csvFieldsStr, hasCSVHeader, echo).Start(input, ctx)
+}
+
+// Start calls Run in the background. The returned channel receives the counts
+// once the input is exhausted and every line is stored.
+func (p *Pipeline) Start(input io.Reader, ctx context.Context) <-chan Stats {
+	done := make(chan Stats, 1)
+	go func() {
+		done <- p.Run(input, ctx)
+		close(done)
+	}()
+	return done
+}
+
+// Run reads lines from input until it is exhausted, processing each one,
+// and logs a summary when the input closes.
+func (p *Pipeline) Run(input io.Reader, ctx context.Context) Stats {
+	stats, err := p.Ingest(input, ctx)
+	handleScannerError(err, p.source)
+	if stats.Lines > 0 {
+		log.Printf("📊 %s: %s\n", sourceName(p.source), stats)
+	}
+	return stats
+}
+
+// Ingest reads lines from input until it is exhausted, processing each one
+// and returning counts of how they were handled. Reading runs ahead of
+// parsing and inserting, bounded by the pipeline's buffer options, and lines
+// are stored in the order they were read.
+//
+// If ctx is cancelled Ingest stops reading, stores the lines it has already
+// read and returns ctx.Err().
+func (p *Pipeline) Ingest(input io.Reader, ctx context.Context) (Stats, error) {
+	// Each input has its own CSV header, and the pipeline may be shared with
+	// the HTTP handlers, so read it into a copy.
+	clone := *p
+	p = &clone
+
+	opts := p.buffer.withDefaults()
+	queue, err := newLineQueue(opts.Size, opts.Policy)
+	if err != nil {
+		return Stats{}, err
+	}
+	stages := p.runStages(queue.out, opts, context.WithoutCancel(ctx))
+
+	read := make(chan error, 1)
+	go func() {
+		read <- p.read(input, queue)
+	}()
+
+	select {
+	case err = <-read:
+		queue.close()
+	case <-ctx.Done():
+		err = ctx.Err()
+		queue.close()
+		// Anything read from now on is refused by the closed queue. Give the
+		// reader a moment to notice so callers can close the input, but
+		// abandon one that is blocked on a quiet input such as stdin.
+		select {
+		case <-read:
+		case <-time.After(readerGrace):
+		}
+	}
+
+	return p.wait(stages, queue), err
+}
+
+// readerGrace is how long a cancelled Ingest waits for its reader to stop.
+const readerGrace = time.Second
+
+// read scans lines from input into the queue.
+func (p *Pipeline) read(input io.Reader, queue *lineQueue) error {
 	scanner := attach(input)
-	parsers := buildParsers(logFormat, parseRegexStr, jqQuery, csvFieldsStr, hasCSVHeader)
 	headerExtracted := false
+	assembler := newCRIAssembler()
 
 	for scanner.Scan() {
 		rawLine := scanner.Text()
 
-		if logFormat == "csv" && hasCSVHeader && !headerExtracted {
-			header, err := readCSV(rawLine)
-			if err != nil {
-				log.Fatalf("❌ Failed to read CSV header: %v", err)
-			}
-			if parsers.csvFields == nil {
-				parsers.csvFields = header
+		if p.ExpectsCSVHeader() && !headerExtracted {
+			if err := p.readCSVHeader(rawLine); err != nil {
+				return fmt.Errorf("failed to read CSV header: %w", err)
 			}
 			headerExtracted = true
 			continue // Skip header row
 		}
 
-		parsed := extract(rawLine, parsers)
-		transformed := transform(parsed, parsers)
+		if p.parsers.logFormat == "cri" {
+			var complete bool
+			if rawLine, complete = assembler.add(rawLine); !complete {
+				continue
+			}
+		}
 
-		err := load(stmt, rawLine, parsed, transformed, parsers, ctx)
-		if err != nil {
-			log.Printf("❌ Failed to insert log: %v", err)
+		if err := queue.push(rawLine); err != nil {
+			return err
 		}
+	}
 
-		broadcast(transformed, echo)
+	for _, rawLine := range assembler.flush() {
+		if err := queue.push(rawLine); err != nil {
+			return err
+		}
 	}
 
-	handleScannerError(scanner)
+	return scanner.Err()
+}
+
+// wait returns the counts once every queued line has been stored.
+func (p *Pipeline) wait(stages <-chan Stats, queue *lineQueue) Stats {
+	stats := <-stages
+	stats.Dropped = queue.dropped
+	stats.Spilled = queue.spilled()
+	return stats
 }
 
 func attach(input io.Reader) *bufio.Scanner {
@@ -91,50 +467,95 @@ func buildParsers(logFormat, parseRegexStr, jqQuery, csvFieldsStr string, hasCSV
 	}
 }
 
-func extract(rawLine string, p parsers) shared.LogEntry {
-	var parsed shared.LogEntry
+// extract parses a raw line with the configured log format. ok is false when
+// the line could not be parsed and a fallback entry was returned instead.
+// parseErr explains any failure, including a JSON line that could only be
+// parsed by the regex fallback.
+func extract(rawLine string, p parsers) (parsed shared.LogEntry, ok bool, parseErr *ParseError) {
 	var err error
 
-	if p.logFormat == "json" {
-		err = json.Unmarshal([]byte(rawLine), &parsed)
+	switch p.logFormat {
+	case "json":
+		return parsePayload(rawLine, p, true)
+	case "cri":
+		return parseCRIEntry(rawLine, p)
+	case "syslog":
+		parsed, err = ParseSyslog(rawLine)
+	case "csv":
+		parsed, err = parseCSV(rawLine, p.csvFields)
+	default:
+		return parsePayload(rawLine, p, false)
 	}
 
-	if err != nil || p.logFormat == "text" {
-		if p.parseRegex != nil {
-			parsed, err = parseWithRegex(rawLine, p.parseRegex)
-			if err == nil {
-				return parsed
-			}
+	if err != nil {
+		return fallbackEntry(rawLine, p), false, newParseError(p.logFormat, err)
+	}
+
+	return parsed, true, nil
+}
+
+// parsePayload parses a line as a JSON object, then with the regex. Lines
+// that match neither become a fallback entry. Without a regex, text lines
+// are expected to fall back and are not treated as errors.
+func parsePayload(line string, p parsers, tryJSON bool) (shared.LogEntry, bool, *ParseError) {
+	var parseErr *ParseError
+
+	if tryJSON {
+		var parsed shared.LogEntry
+		err := json.Unmarshal([]byte(line), &parsed)
+		if err == nil && parsed != nil {
+			return parsed, true, nil
 		}
-		parsed = shared.LogEntry{
-			"message": rawLine,
-			"level":   "raw",
+		if err == nil {
+			err = fmt.Errorf("expected an object, got null")
 		}
+		parseErr = jsonParseError(err)
 	}
 
-	if p.logFormat == "csv" {
-		parsed, err = parseCSV(rawLine, p.csvFields)
-		if err != nil {
-			parsed = shared.LogEntry{
-				"message": rawLine,
-				"level":   "raw",
-			}
+	if p.parseRegex != nil {
+		parsed, err := parseWithRegex(line, p.parseRegex)
+		if err == nil {
+			return parsed, true, parseErr
+		}
+		if parseErr == nil {
+			parseErr = newParseError("regex", err)
+		} else {
+			parseErr.Err = fmt.Errorf("%v; regex: %v", parseErr.Err, err)
 		}
 	}
 
-	return parsed
+	return fallbackEntry(line, p), false, parseErr
 }
 
-func transform(entry shared.LogEntry, p parsers) shared.LogEntry {
+func fallbackEntry(rawLine string, p parsers) shared.LogEntry {
+	level := p.fallbackLevel
+	if level == "" {
+		level = "raw"
+	}
+	return shared.LogEntry{
+		"message": rawLine,
+		"level":   level,
+	}
+}
+
+func transform(entry shared.LogEntry, p parsers) (shared.LogEntry, *ParseError) {
+	var parseErr *ParseError
 	if p.jqEnabled {
-		entry = mapToLogEntry(jqfilter.Apply(logEntryToStringMap(entry)))
+		result, err := jqfilter.Eval(logEntryToStringMap(entry))
+		if err != nil {
+			parseErr = newParseError("jq", err)
+		}
+		entry = mapToLogEntry(result)
 	}
 	ensureTimestamp(entry)
 
-	return entry
+	return entry, parseErr
 }
 
-func load(stmt *sql.Stmt, rawLine string, parsed, transformed shared.LogEntry, p parsers, ctx context.Context) error {
+// row returns the insert arguments for a line, in the order expected by
+// logdb.MustPrepareInsert.
+func (line prepared) row(p parsers) []any {
+	transformed := line.transformed
 	traceID, _ := safeString(transformed, "trace_id")
 	level, _ := safeString(transformed, "level")
 	message, _ := safeString(transformed, "message")
@@ -154,7 +575,7 @@ func load(stmt *sql.Stmt, rawLine string, parsed, transformed shared.LogEntry, p
 		}
 	}
 
-	parsedLogJson := shared.MustJson(parsed)
+	parsedLogJson := shared.MustJson(line.parsed)
 	finalLogJson := shared.MustJson(transformed)
 
 	regexPattern := ""
@@ -162,15 +583,17 @@ func load(stmt *sql.Stmt, rawLine string, parsed, transformed shared.LogEntry, p
 		regexPattern = p.parseRegex.String()
 	}
 
-	id := uuid.New().String()
+	var firstSeen, lastSeen any
+	if line.group != nil {
+		firstSeen, lastSeen = line.group.firstSeen.UTC(), line.group.lastSeen.UTC()
+	}
 
-	_, err := stmt.ExecContext(
-		ctx,
-		id,
+	return []any{
+		line.id,
 		traceID,
 		level,
 		message,
-		rawLine,
+		line.rawLine,
 		string(parsedLogJson),
 		string(finalLogJson),
 		time.Now().UTC(),
@@ -179,13 +602,31 @@ func load(stmt *sql.Stmt, rawLine string, parsed, transformed shared.LogEntry, p
 		nullify(regexPattern),
 		nullify(p.jqFilter),
 		nullify(strings.Join(p.csvFields, ",")),
-	)
-
-	return err
+		nullify(parseErrorString(line.parseErr)),
+		line.weight,
+		1,
+		firstSeen,
+		lastSeen,
+		nullify(line.templateID),
+		nullify(line.template),
+	}
 }
 
-func broadcast(entry shared.LogEntry, echo bool) {
-	handlers.Broadcast(entry)
+func broadcast(line prepared, echo, websocket bool) {
+	entry := line.transformed
+	if websocket {
+		if line.group != nil {
+			// Lets clients find the entry when it is repeated.
+			withID := make(shared.LogEntry, len(entry)+1)
+			for k, v := range entry {
+				withID[k] = v
+			}
+			withID["_repeat_id"] = line.group.id
+			handlers.Broadcast(withID)
+		} else {
+			handlers.Broadcast(entry)
+		}
+	}
 	if echo {
 		out, err := json.Marshal(entry)
 		if err != nil {
@@ -196,11 +637,28 @@ func broadcast(entry shared.LogEntry, echo bool) {
 	}
 }
 
-func handleScannerError(scanner *bufio.Scanner) {
-	if err := scanner.Err(); err != nil {
-		log.Printf("⚠️ Error while scanning input: %v", err)
+func parseErrorString(err *ParseError) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func sourceName(source string) string {
+	if source == "" {
+		return "STDIN"
+	}
+	return source
+}
+
+func handleScannerError(err error, source string) {
+	source = sourceName(source)
+	if errors.Is(err, context.Canceled) {
+		log.Printf("⏹️ Stopped reading %s\n", source)
+	} else if err != nil {
+		log.Printf("⚠️ Error while scanning %s: %v", source, err)
 	} else {
-		log.Println("📬 STDIN closed — no longer receiving logs")
+		log.Printf("📬 %s closed — no longer receiving logs\n", source)
 	}
 }
 
@@ -268,12 +726,12 @@ func ensureTimestamp(entry shared.LogEntry) {
 	if ts, ok := safeString(entry, "timestamp"); ok {
 		parsedTs, err := time.Parse(time.RFC3339, ts)
 		if err == nil {
-			entry["timestamp"] = parsedTs.Format(time.RFC3339)
+			entry["timestamp"] = parsedTs.Format(time.RFC3339Nano)
 			return
 		}
 	}
 
-	entry["timestamp"] = now.Format(time.RFC3339)
+	entry["timestamp"] = now.Format(time.RFC3339Nano)
 }
 
 func safeString(m map[string]any, key string) (string, bool) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -11,6 +12,8 @@ import (
 	_ "github.com/marcboeker/go-duckdb"
 
 	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
 )
 
 func setupTestDB(t *testing.T) (*sql.DB, *sql.Stmt, context.Context) {
@@ -34,6 +37,13 @@ func setupTestDB(t *testing.T) (*sql.DB, *sql.Stmt, context.Context) {
 		regex_pattern TEXT,
 		jq_filter TEXT,
 		csv_headers TEXT,
+		parse_error TEXT,
+		sample_weight INTEGER DEFAULT 1,
+		repeat_count INTEGER DEFAULT 1,
+		first_seen TIMESTAMP,
+		last_seen TIMESTAMP,
+		template_id TEXT,
+		template TEXT,
 	)`)
 
 	stmt, err := db.Prepare(`INSERT INTO logs (
@@ -49,8 +59,15 @@ func setupTestDB(t *testing.T) (*sql.DB, *sql.Stmt, context.Context) {
 		log_format,
 		regex_pattern,
 		jq_filter,
-		csv_headers
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		csv_headers,
+		parse_error,
+		sample_weight,
+		repeat_count,
+		first_seen,
+		last_seen,
+		template_id,
+		template
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -200,6 +217,26 @@ func TestIngest_TimestampExtraction(t *testing.T) {
 	}
 }
 
+func TestIngest_TimestampFallback(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	before := time.Now()
+	ingest.NewPipeline(stmt, "json", "", "", "", false, false).
+		Run(strings.NewReader(`{"trace_id":"now123","message":"no timestamp"}`+"\n"), ctx)
+	after := time.Now()
+
+	var ts time.Time
+	if err := db.QueryRow(`SELECT timestamp FROM logs WHERE trace_id = ?`, "now123").Scan(&ts); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+
+	// The time read is kept below the second, to the precision of the column.
+	if ts.Before(before.Truncate(time.Microsecond)) || ts.After(after) {
+		t.Errorf("Expected a timestamp between %v and %v, got %v", before, after, ts)
+	}
+}
+
 func TestIngest_BadRegexFailsToParse(t *testing.T) {
 	db, stmt, ctx := setupTestDB(t)
 	defer db.Close()
@@ -246,3 +283,163 @@ func TestIngest_NoRegexNoJQ_JSONPassthrough(t *testing.T) {
 		t.Errorf("Expected level 'info', got %s", level)
 	}
 }
+
+func TestPipeline_SourceAndFallbackLevel(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	pipeline := ingest.NewPipeline(stmt, "json", "", "", "", false, false)
+	pipeline.WithSource("stderr").WithFallbackLevel("error").Run(strings.NewReader("panic: oh no\n"), ctx)
+	pipeline.WithSource("stdout").Run(strings.NewReader(`{"level":"info","message":"ready"}`+"\n"), ctx)
+
+	rows, err := db.Query(`SELECT level, message, json_extract_string(log, '$.source') FROM logs ORDER BY message`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var level, msg, source string
+		if err := rows.Scan(&level, &msg, &source); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, level+"|"+msg+"|"+source)
+	}
+
+	want := "[error|panic: oh no|stderr info|ready|stdout]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+}
+
+func TestPipeline_Redaction(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	redactor, err := redact.New(redact.Config{
+		Drop:     []string{"password"},
+		Mask:     []string{"user.email"},
+		Patterns: []string{"bearer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := `{"message":"login with Bearer abc.def","password":"hunter22","user":{"email":"ann@example.com"}}`
+	ingest.NewPipeline(stmt, "json", "", "", "", false, false).
+		WithRedactor(redactor).
+		Run(strings.NewReader(line+"\n"), ctx)
+
+	var message, raw, parsed, final string
+	err = db.QueryRow(`SELECT message, raw_log, parsed_log::TEXT, log::TEXT FROM logs`).Scan(&message, &raw, &parsed, &final)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message != "login with Bearer [REDACTED]" {
+		t.Errorf("Unexpected message %q", message)
+	}
+	for name, stored := range map[string]string{"raw_log": raw, "parsed_log": parsed, "log": final} {
+		for _, secret := range []string{"hunter22", "ann@example.com", "abc.def"} {
+			if strings.Contains(stored, secret) {
+				t.Errorf("%s still contains %q: %s", name, secret, stored)
+			}
+		}
+	}
+	if strings.Contains(final, "password") {
+		t.Errorf("Expected password to be dropped, got %s", final)
+	}
+}
+
+func TestPipeline_Sampling(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	sampler, err := sampling.New(sampling.Config{
+		Rules: []sampling.Rule{{Match: "^GET /health", KeepOneIn: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var input strings.Builder
+	for range 9 {
+		input.WriteString(`{"level":"info","message":"GET /health 200"}` + "\n")
+	}
+	input.WriteString(`{"level":"error","message":"GET /health 500"}` + "\n")
+
+	weights := ingest.NewSampleWeights(db, sampler)
+	stats := ingest.NewPipeline(stmt, "json", "", "", "", false, false).
+		WithSampler(sampler).
+		Run(strings.NewReader(input.String()), ctx)
+	if stats.Lines != 10 || stats.Sampled != 6 {
+		t.Errorf("Expected 10 lines with 6 sampled out, got %+v", stats)
+	}
+	// The two lines sampled out after the last entry kept are added to it.
+	weights.Close()
+
+	var rows, weight int
+	if err := db.QueryRow(`SELECT count(*), sum(sample_weight) FROM logs`).Scan(&rows, &weight); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 4 || weight != 10 {
+		t.Errorf("Expected 4 rows standing for 10 lines, got %d rows and %d", rows, weight)
+	}
+}
+
+func TestPipeline_Dedup(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	dedup, err := ingest.NewDeduper(db, ingest.DedupNumbers, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var input strings.Builder
+	for i := range 5 {
+		fmt.Fprintf(&input, `{"level":"warn","message":"retrying in %dms (attempt %d)"}`+"\n", i*100, i)
+	}
+	input.WriteString(`{"level":"info","message":"connected"}` + "\n")
+
+	stats := ingest.NewPipeline(stmt, "json", "", "", "", false, false).
+		WithDedup(dedup).
+		Run(strings.NewReader(input.String()), ctx)
+	dedup.Close()
+
+	if stats.Lines != 6 || stats.Repeats != 4 {
+		t.Errorf("Expected 6 lines with 4 repeats, got %+v", stats)
+	}
+
+	rows, err := db.Query(`SELECT message, repeat_count, first_seen <= last_seen FROM logs ORDER BY message`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var message string
+		var count int
+		var ordered bool
+		if err := rows.Scan(&message, &count, &ordered); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s|%d|%v", message, count, ordered))
+	}
+
+	want := "[connected|1|true retrying in 0ms (attempt 0)|5|true]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+}
+
+func TestNewDeduper_Invalid(t *testing.T) {
+	if _, err := ingest.NewDeduper(nil, "fuzzy", time.Second); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if _, err := ingest.NewDeduper(nil, ingest.DedupExact, 0); err == nil {
+		t.Error("Expected an error for a zero window")
+	}
+}
@@ -0,0 +1,479 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+)
+
+var (
+	linesDropped     = metrics.NewCounter("magiclog_lines_dropped_total", "Lines discarded because the ingest buffer was full.")
+	linesSpilled     = metrics.NewCounter("magiclog_lines_spilled_total", "Lines written to a spill file because the ingest buffer was full.")
+	broadcastDropped = metrics.NewCounter("magiclog_broadcast_dropped_total", "Entries not sent to WebSocket clients because the broadcaster fell behind.")
+	queuedLines      = metrics.NewGauge("magiclog_ingest_queue_lines", "Lines read but not yet inserted.")
+)
+
+// Buffer policies decide what happens to a new line when the ingest buffer
+// is full.
+const (
+	// PolicyBlock stops reading until there is room, pushing back on the
+	// producer.
+	PolicyBlock = "block"
+	// PolicyDrop discards the newest line.
+	PolicyDrop = "drop"
+	// PolicySpill writes lines to a temporary file until there is room.
+	PolicySpill = "spill"
+)
+
+var BufferPolicies = []string{PolicyBlock, PolicyDrop, PolicySpill}
+
+// BufferOptions configures the stages Ingest runs lines through: reading,
+// parsing and transforming on a pool of workers, inserting in batches, and
+// broadcasting to WebSocket clients.
+type BufferOptions struct {
+	// Size is the number of lines read ahead of the parse workers.
+	Size int
+	// Policy is one of BufferPolicies.
+	Policy string
+	// Workers is the number of lines parsed and transformed concurrently.
+	Workers int
+	// BatchSize is the largest number of rows inserted in one transaction.
+	BatchSize int
+	// FlushInterval is how long a partial batch waits for more rows.
+	FlushInterval time.Duration
+}
+
+func DefaultBufferOptions() BufferOptions {
+	return BufferOptions{
+		Size:          10000,
+		Policy:        PolicyBlock,
+		Workers:       runtime.NumCPU(),
+		BatchSize:     500,
+		FlushInterval: 100 * time.Millisecond,
+	}
+}
+
+// withDefaults fills in any options that were left unset.
+func (o BufferOptions) withDefaults() BufferOptions {
+	defaults := DefaultBufferOptions()
+	if o.Size <= 0 {
+		o.Size = defaults.Size
+	}
+	if o.Policy == "" {
+		o.Policy = defaults.Policy
+	}
+	if o.Workers <= 0 {
+		o.Workers = defaults.Workers
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaults.BatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaults.FlushInterval
+	}
+	return o
+}
+
+// BatchInserter is implemented by inserters that can store several rows at
+// once, such as logdb.BatchStmt.
+type BatchInserter interface {
+	Inserter
+	ExecBatch(ctx context.Context, rows [][]any) error
+}
+
+var errQueueClosed = errors.New("ingest queue closed")
+
+// lineQueue is the bounded buffer between the reader and the parse workers.
+type lineQueue struct {
+	out     chan string
+	policy  string
+	spill   *spillFile
+	dropped int
+
+	// mu is held while pushing so the queue cannot be closed mid-send.
+	mu     sync.Mutex
+	closed bool
+}
+
+func newLineQueue(size int, policy string) (*lineQueue, error) {
+	q := &lineQueue{out: make(chan string, size), policy: policy}
+	switch policy {
+	case PolicyBlock, PolicyDrop:
+	case PolicySpill:
+		q.spill = newSpillFile(q.out)
+	default:
+		return nil, fmt.Errorf("unknown buffer policy %q (expected one of %s)", policy, strings.Join(BufferPolicies, ", "))
+	}
+	return q, nil
+}
+
+func (q *lineQueue) push(rawLine string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+
+	switch q.policy {
+	case PolicyDrop:
+		select {
+		case q.out <- rawLine:
+		default:
+			q.dropped++
+			linesDropped.Inc()
+			return nil
+		}
+	case PolicySpill:
+		if err := q.spill.push(rawLine); err != nil {
+			return err
+		}
+	default:
+		q.out <- rawLine
+	}
+	queuedLines.Inc()
+	return nil
+}
+
+// close is called once the input is exhausted or reading is cancelled.
+// Spilled lines are still delivered before the queue closes.
+func (q *lineQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+
+	if q.spill != nil {
+		q.spill.close()
+		return
+	}
+	close(q.out)
+}
+
+func (q *lineQueue) spilled() int {
+	if q.spill == nil {
+		return 0
+	}
+	q.spill.mu.Lock()
+	defer q.spill.mu.Unlock()
+	return q.spill.spilled
+}
+
+// spillFile holds lines on disk while the queue is full. Once a line has been
+// spilled every following line is too, until the file has been fed back into
+// the queue, so lines stay in the order they were read.
+type spillFile struct {
+	out chan<- string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	file *os.File
+	r    *bufio.Reader
+	src  *spillReader
+	// writeOff is the end of the data in the file.
+	writeOff int64
+	// pending counts lines in the file that have not been read back.
+	pending int
+	// inFlight is set while a line read back from the file is being sent, as
+	// new lines must not overtake it.
+	inFlight bool
+	closed   bool
+	spilled  int
+	done     chan struct{}
+}
+
+func newSpillFile(out chan<- string) *spillFile {
+	s := &spillFile{out: out, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	go s.feed()
+	return s
+}
+
+func (s *spillFile) push(rawLine string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == 0 && !s.inFlight {
+		select {
+		case s.out <- rawLine:
+			return nil
+		default:
+		}
+	}
+
+	if s.file == nil {
+		file, err := os.CreateTemp("", "magic-log-spill-*")
+		if err != nil {
+			return fmt.Errorf("creating spill file: %w", err)
+		}
+		log.Printf("💧 Ingest buffer full, spilling to %s\n", file.Name())
+		s.file = file
+		s.src = &spillReader{f: file}
+		s.r = bufio.NewReader(s.src)
+	}
+
+	n, err := s.file.WriteAt([]byte(rawLine+"\n"), s.writeOff)
+	if err != nil {
+		return fmt.Errorf("writing spill file: %w", err)
+	}
+	s.writeOff += int64(n)
+	s.pending++
+	s.spilled++
+	linesSpilled.Inc()
+	s.cond.Signal()
+	return nil
+}
+
+// feed sends spilled lines to the queue as it drains.
+func (s *spillFile) feed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		for s.pending == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.pending == 0 {
+			close(s.out)
+			s.remove()
+			close(s.done)
+			return
+		}
+
+		rawLine, err := s.r.ReadString('\n')
+		if err != nil {
+			// The line was written completely before pending was counted,
+			// so this only happens if the file is broken.
+			log.Printf("❌ Failed to read spill file: %v", err)
+			s.pending = 0
+			continue
+		}
+		s.pending--
+		s.inFlight = true
+
+		s.mu.Unlock()
+		s.out <- strings.TrimSuffix(rawLine, "\n")
+		s.mu.Lock()
+
+		s.inFlight = false
+		if s.pending == 0 {
+			s.reset()
+		}
+	}
+}
+
+// reset empties the file once everything in it has been fed back.
+func (s *spillFile) reset() {
+	if err := s.file.Truncate(0); err != nil {
+		log.Printf("⚠️ Failed to truncate spill file: %v", err)
+		return
+	}
+	s.writeOff = 0
+	s.src.off = 0
+	s.r.Reset(s.src)
+}
+
+func (s *spillFile) remove() {
+	if s.file == nil {
+		return
+	}
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+func (s *spillFile) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Signal()
+	s.mu.Unlock()
+	<-s.done
+}
+
+// spillReader reads the spill file from its own offset, independently of
+// where lines are being written.
+type spillReader struct {
+	f   *os.File
+	off int64
+}
+
+func (r *spillReader) Read(p []byte) (int, error) {
+	n, err := r.f.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// job is a line for a parse worker. The result is sent on slot, which the
+// writer reads in the order lines were read.
+type job struct {
+	rawLine string
+	slot    chan prepared
+}
+
+// runStages parses, inserts and broadcasts the lines from the queue until it
+// is closed, returning the counts once everything has been stored.
+func (p *Pipeline) runStages(lines <-chan string, opts BufferOptions, ctx context.Context) <-chan Stats {
+	jobs := make(chan job, opts.Workers)
+	ordered := make(chan chan prepared, opts.BatchSize)
+
+	go func() {
+		for rawLine := range lines {
+			slot := make(chan prepared, 1)
+			ordered <- slot
+			jobs <- job{rawLine: rawLine, slot: slot}
+		}
+		close(jobs)
+		close(ordered)
+	}()
+
+	for range opts.Workers {
+		go func() {
+			for j := range jobs {
+				parsed, ok, parseErr := extract(j.rawLine, p.parsers)
+				j.slot <- p.prepare(j.rawLine, parsed, ok, parseErr)
+			}
+		}()
+	}
+
+	broadcasts := make(chan prepared, opts.Size)
+	broadcasted := make(chan struct{})
+	go func() {
+		for line := range broadcasts {
+			broadcast(line, p.echo, !p.noBroadcast)
+		}
+		close(broadcasted)
+	}()
+
+	result := make(chan Stats, 1)
+	go func() {
+		var stats Stats
+		batch := make([]prepared, 0, opts.BatchSize)
+
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			errs := p.insertBatch(batch, ctx)
+			for i, line := range batch {
+				if line.group != nil {
+					p.dedup.inserted(line.group, errs[i])
+				}
+				p.finish(line, errs[i])
+				stats.add(line.ok, line.parseErr, errs[i])
+				if errs[i] != nil {
+					log.Printf("❌ Failed to insert log: %v", errs[i])
+				}
+				p.enqueueBroadcast(broadcasts, line)
+			}
+			queuedLines.Add(-int64(len(batch)))
+			batch = batch[:0]
+		}
+
+		ticker := time.NewTicker(opts.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case slot, open := <-ordered:
+				if !open {
+					flush()
+					close(broadcasts)
+					<-broadcasted
+					result <- stats
+					return
+				}
+				line := p.admit(<-slot)
+				if line.weight == 0 {
+					p.finish(line, nil)
+					stats.addSampled()
+					queuedLines.Add(-1)
+					continue
+				}
+				if p.dedup != nil {
+					var repeat bool
+					if line, repeat = p.dedup.check(line); repeat {
+						p.finish(line, nil)
+						stats.addRepeat()
+						queuedLines.Add(-1)
+						continue
+					}
+				}
+				batch = append(batch, line)
+				if len(batch) >= opts.BatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+
+	return result
+}
+
+// insertBatch stores a batch of lines, returning the error for each. If the
+// batch cannot be inserted as a whole, lines are retried one at a time so
+// that only the failing ones are lost.
+func (p *Pipeline) insertBatch(batch []prepared, ctx context.Context) []error {
+	rows := make([][]any, len(batch))
+	for i, line := range batch {
+		rows[i] = line.row(p.parsers)
+	}
+	errs := make([]error, len(batch))
+
+	start := time.Now()
+	if b, ok := p.stmt.(BatchInserter); ok && len(rows) > 1 {
+		if err := b.ExecBatch(ctx, rows); err == nil {
+			observeInserts(start, len(rows))
+			return errs
+		}
+		start = time.Now()
+	}
+
+	for i, row := range rows {
+		_, errs[i] = p.stmt.ExecContext(ctx, row...)
+	}
+	observeInserts(start, len(rows))
+	return errs
+}
+
+// observeInserts records the average time taken to insert each row.
+func observeInserts(start time.Time, rows int) {
+	perRow := time.Since(start).Seconds() / float64(rows)
+	for range rows {
+		insertDuration.Observe(perRow)
+	}
+}
+
+// enqueueBroadcast hands a stored entry to the broadcaster. WebSocket
+// delivery is best effort, so entries are dropped rather than holding up
+// inserts, but echoed output waits as it is the user's copy of the stream.
+func (p *Pipeline) enqueueBroadcast(broadcasts chan<- prepared, line prepared) {
+	if p.noBroadcast && !p.echo {
+		return
+	}
+	if p.echo {
+		broadcasts <- line
+		return
+	}
+	select {
+	case broadcasts <- line:
+	default:
+		broadcastDropped.Inc()
+	}
+}
@@ -0,0 +1,210 @@
+package ingest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
+)
+
+// recordingInserter keeps the raw lines it is given. If release is set,
+// inserts wait for it to be closed.
+type recordingInserter struct {
+	mu      sync.Mutex
+	lines   []string
+	batches int
+	release chan struct{}
+}
+
+func (r *recordingInserter) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	if r.release != nil {
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, args[4].(string))
+	return nil, nil
+}
+
+type batchingInserter struct {
+	recordingInserter
+}
+
+func (b *batchingInserter) ExecBatch(ctx context.Context, rows [][]any) error {
+	b.mu.Lock()
+	b.batches++
+	b.mu.Unlock()
+	for _, row := range rows {
+		b.ExecContext(ctx, row...)
+	}
+	return nil
+}
+
+// releasingReader closes release once the input has been read, so that a
+// blocked inserter holds up the stages until the reader is done.
+type releasingReader struct {
+	r       io.Reader
+	release chan struct{}
+}
+
+func (r *releasingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		close(r.release)
+	}
+	return n, err
+}
+
+func numberedLines(n int) ([]string, string) {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"message":"line %d"}`, i)
+	}
+	return lines, strings.Join(lines, "\n") + "\n"
+}
+
+func assertInOrder(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d lines, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Line %d out of order: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestIngest_StagesPreserveOrder(t *testing.T) {
+	lines, input := numberedLines(2000)
+	inserter := &batchingInserter{}
+
+	pipeline := ingest.NewPipeline(inserter, "json", "", "", "", false, false).
+		WithoutBroadcast().
+		WithBuffer(ingest.BufferOptions{Size: 16, Workers: 8, BatchSize: 100})
+	stats, err := pipeline.Ingest(strings.NewReader(input), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Lines != 2000 || stats.Parsed != 2000 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	assertInOrder(t, inserter.lines, lines)
+	if inserter.batches == 0 {
+		t.Error("Expected rows to be inserted in batches")
+	}
+}
+
+func TestIngest_StagesSampleInOrder(t *testing.T) {
+	lines, input := numberedLines(2000)
+	sampler, err := sampling.New(sampling.Config{Rules: []sampling.Rule{{KeepOneIn: 10}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserter := &batchingInserter{}
+
+	pipeline := ingest.NewPipeline(inserter, "json", "", "", "", false, false).
+		WithoutBroadcast().
+		WithSampler(sampler).
+		WithBuffer(ingest.BufferOptions{Size: 16, Workers: 8, BatchSize: 100})
+	stats, err := pipeline.Ingest(strings.NewReader(input), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Lines != 2000 || stats.Sampled != 1800 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	var kept []string
+	for i := 0; i < len(lines); i += 10 {
+		kept = append(kept, lines[i])
+	}
+	assertInOrder(t, inserter.lines, kept)
+}
+
+func TestIngest_DropPolicy(t *testing.T) {
+	_, input := numberedLines(500)
+	release := make(chan struct{})
+	inserter := &recordingInserter{release: release}
+
+	pipeline := ingest.NewPipeline(inserter, "json", "", "", "", false, false).
+		WithoutBroadcast().
+		WithBuffer(ingest.BufferOptions{Size: 4, Workers: 1, BatchSize: 1, Policy: ingest.PolicyDrop})
+	stats, err := pipeline.Ingest(&releasingReader{r: strings.NewReader(input), release: release}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Dropped == 0 || stats.Lines+stats.Dropped != 500 || len(inserter.lines) != stats.Lines {
+		t.Errorf("Unexpected stats %+v with %d lines stored", stats, len(inserter.lines))
+	}
+}
+
+func TestIngest_SpillPolicy(t *testing.T) {
+	lines, input := numberedLines(500)
+	release := make(chan struct{})
+	inserter := &recordingInserter{release: release}
+
+	pipeline := ingest.NewPipeline(inserter, "json", "", "", "", false, false).
+		WithoutBroadcast().
+		WithBuffer(ingest.BufferOptions{Size: 4, Workers: 2, BatchSize: 1, Policy: ingest.PolicySpill})
+	stats, err := pipeline.Ingest(&releasingReader{r: strings.NewReader(input), release: release}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Lines != 500 || stats.Spilled == 0 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	assertInOrder(t, inserter.lines, lines)
+}
+
+func TestIngest_UnknownPolicy(t *testing.T) {
+	pipeline := ingest.NewPipeline(&recordingInserter{}, "json", "", "", "", false, false).
+		WithBuffer(ingest.BufferOptions{Policy: "overflow"})
+	if _, err := pipeline.Ingest(strings.NewReader("{}\n"), context.Background()); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestIngest_CancelStoresLinesAlreadyRead(t *testing.T) {
+	inserter := &recordingInserter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+
+	type result struct {
+		stats ingest.Stats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := ingest.NewPipeline(inserter, "json", "", "", "", false, false).
+			WithoutBroadcast().
+			Ingest(pr, ctx)
+		done <- result{stats, err}
+	}()
+
+	lines, input := numberedLines(3)
+	pw.Write([]byte(input))
+	// The scanner only reads again once the first three lines are queued.
+	pw.Write([]byte(`{"message":"unread"}` + "\n"))
+	cancel()
+
+	res := <-done
+	if !errors.Is(res.err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", res.err)
+	}
+	if res.stats.Lines < 3 || len(inserter.lines) < 3 {
+		t.Fatalf("Expected the queued lines to be stored, got %+v", res.stats)
+	}
+	assertInOrder(t, inserter.lines[:3], lines)
+	pw.Close()
+}
@@ -0,0 +1,286 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+)
+
+var (
+	linesRead      = metrics.NewCounterVec("magiclog_lines_read_total", "Lines read by the ingest pipeline, by log format.", "format")
+	linesInserted  = metrics.NewCounter("magiclog_lines_inserted_total", "Log entries inserted into the database.")
+	insertFailures = metrics.NewCounter("magiclog_insert_failures_total", "Log entries that failed to insert.")
+	parseFallbacks = metrics.NewCounterVec("magiclog_parse_fallbacks_total", "Lines stored as fallback entries because they could not be parsed, by log format.", "format")
+	parseErrors    = metrics.NewCounterVec("magiclog_parse_errors_total", "Parse failures, by the parser that failed.", "stage")
+	jqErrors       = metrics.NewCounter("magiclog_jq_errors_total", "jq filter runtime errors.")
+	linesSampled   = metrics.NewCounter("magiclog_lines_sampled_total", "Lines not stored because a sampling rule left them out.")
+	linesRepeated  = metrics.NewCounter("magiclog_lines_deduplicated_total", "Repeated lines collapsed into an earlier entry.")
+	insertDuration = metrics.NewHistogram("magiclog_insert_duration_seconds", "Time taken to insert a log entry.", metrics.DefaultLatencyBuckets)
+)
+
+// ParseError records why a line could not be parsed. Stage is the parser
+// that failed: json, regex, csv, syslog, cri or jq.
+type ParseError struct {
+	Stage string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func newParseError(stage string, err error) *ParseError {
+	return &ParseError{Stage: stage, Err: err}
+}
+
+// jsonParseError describes a JSON failure including the byte offset of
+// syntax errors.
+func jsonParseError(err error) *ParseError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		err = fmt.Errorf("%v at offset %d", syntaxErr, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		err = fmt.Errorf("expected an object, got %s", typeErr.Value)
+	}
+	return newParseError("json", err)
+}
+
+// Stats counts the lines read by Ingest.
+type Stats struct {
+	Lines       int
+	Parsed      int
+	Raw         int
+	Failed      int
+	ParseErrors map[string]int
+	// Dropped and Spilled count lines that arrived while the buffer was full.
+	// Dropped lines are not included in Lines.
+	Dropped int
+	Spilled int
+	// Sampled counts lines left out by sampling rules, and Repeats lines
+	// collapsed into an earlier entry. They are included in Lines but not in
+	// Parsed or Raw.
+	Sampled int
+	Repeats int
+}
+
+func (s *Stats) add(parsed bool, parseErr *ParseError, err error) {
+	s.Lines++
+	if parsed {
+		s.Parsed++
+	} else {
+		s.Raw++
+	}
+	if parseErr != nil {
+		if s.ParseErrors == nil {
+			s.ParseErrors = map[string]int{}
+		}
+		s.ParseErrors[parseErr.Stage]++
+	}
+	if err != nil {
+		s.Failed++
+	}
+}
+
+func (s *Stats) addSampled() {
+	s.Lines++
+	s.Sampled++
+}
+
+func (s *Stats) addRepeat() {
+	s.Lines++
+	s.Repeats++
+}
+
+// Merge adds the counts from other.
+func (s *Stats) Merge(other Stats) {
+	s.Lines += other.Lines
+	s.Parsed += other.Parsed
+	s.Raw += other.Raw
+	s.Failed += other.Failed
+	s.Dropped += other.Dropped
+	s.Spilled += other.Spilled
+	s.Sampled += other.Sampled
+	s.Repeats += other.Repeats
+	for stage, n := range other.ParseErrors {
+		if s.ParseErrors == nil {
+			s.ParseErrors = map[string]int{}
+		}
+		s.ParseErrors[stage] += n
+	}
+}
+
+func (s Stats) String() string {
+	summary := fmt.Sprintf("%d lines, %d parsed, %d raw", s.Lines, s.Parsed, s.Raw)
+	if s.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed to insert", s.Failed)
+	}
+	if s.Dropped > 0 {
+		summary += fmt.Sprintf(", %d dropped", s.Dropped)
+	}
+	if s.Spilled > 0 {
+		summary += fmt.Sprintf(", %d spilled", s.Spilled)
+	}
+	if s.Sampled > 0 {
+		summary += fmt.Sprintf(", %d sampled out", s.Sampled)
+	}
+	if s.Repeats > 0 {
+		summary += fmt.Sprintf(", %d repeats collapsed", s.Repeats)
+	}
+	if len(s.ParseErrors) > 0 {
+		summary += ", parse errors: " + formatCounts(s.ParseErrors)
+	}
+	return summary
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, counts[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+const recentParseErrors = 20
+
+// RecentParseError is a parse failure kept for the stats API.
+type RecentParseError struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source,omitempty"`
+	Stage   string    `json:"stage"`
+	Reason  string    `json:"reason"`
+	RawLine string    `json:"raw_line"`
+}
+
+// Counters is a snapshot of ingest activity across every pipeline since
+// startup.
+type Counters struct {
+	Lines        int64              `json:"lines"`
+	Parsed       int64              `json:"parsed"`
+	Raw          int64              `json:"raw"`
+	InsertErrors int64              `json:"insert_errors"`
+	Sampled      int64              `json:"sampled"`
+	Repeats      int64              `json:"repeats"`
+	ParseErrors  map[string]int64   `json:"parse_errors"`
+	Recent       []RecentParseError `json:"recent_parse_errors"`
+}
+
+var counters = struct {
+	sync.Mutex
+	Counters
+}{Counters: Counters{ParseErrors: map[string]int64{}}}
+
+func record(format, source, rawLine string, parsed bool, parseErr *ParseError, err error) {
+	linesRead.With(format).Inc()
+	if !parsed {
+		parseFallbacks.With(format).Inc()
+	}
+	if err != nil {
+		insertFailures.Inc()
+	} else {
+		linesInserted.Inc()
+	}
+	if parseErr != nil {
+		parseErrors.With(parseErr.Stage).Inc()
+		if parseErr.Stage == "jq" {
+			jqErrors.Inc()
+		}
+	}
+
+	counters.Lock()
+	defer counters.Unlock()
+
+	counters.Lines++
+	if parsed {
+		counters.Parsed++
+	} else {
+		counters.Raw++
+	}
+	if err != nil {
+		counters.InsertErrors++
+	}
+	if parseErr == nil {
+		return
+	}
+
+	counters.ParseErrors[parseErr.Stage]++
+	rawLine = truncate(rawLine, maxRecentLineSize)
+	counters.Recent = append(counters.Recent, RecentParseError{
+		Time:    time.Now().UTC(),
+		Source:  source,
+		Stage:   parseErr.Stage,
+		Reason:  parseErr.Err.Error(),
+		RawLine: rawLine,
+	})
+	if len(counters.Recent) > recentParseErrors {
+		counters.Recent = counters.Recent[len(counters.Recent)-recentParseErrors:]
+	}
+}
+
+// maxRecentLineSize is the most of a line kept with a recent parse error.
+const maxRecentLineSize = 500
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// recordSampled counts a line left out by a sampling rule.
+func recordSampled(format string) {
+	linesRead.With(format).Inc()
+	linesSampled.Inc()
+
+	counters.Lock()
+	defer counters.Unlock()
+	counters.Lines++
+	counters.Sampled++
+}
+
+// recordRepeat counts a line collapsed into an earlier entry.
+func recordRepeat(format string) {
+	linesRead.With(format).Inc()
+	linesRepeated.Inc()
+
+	counters.Lock()
+	defer counters.Unlock()
+	counters.Lines++
+	counters.Repeats++
+}
+
+// Snapshot returns the ingest counters, with the most recent parse errors
+// first.
+func Snapshot() Counters {
+	counters.Lock()
+	defer counters.Unlock()
+
+	snapshot := counters.Counters
+	snapshot.ParseErrors = make(map[string]int64, len(counters.ParseErrors))
+	for k, v := range counters.ParseErrors {
+		snapshot.ParseErrors[k] = v
+	}
+	snapshot.Recent = make([]RecentParseError, len(counters.Recent))
+	for i, e := range counters.Recent {
+		snapshot.Recent[len(counters.Recent)-1-i] = e
+	}
+	return snapshot
+}
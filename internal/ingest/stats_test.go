@@ -0,0 +1,108 @@
+package ingest_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+)
+
+func parseErrorFor(t *testing.T, db *sql.DB, raw string) string {
+	t.Helper()
+	var parseErr sql.NullString
+	if err := db.QueryRow(`SELECT parse_error FROM logs WHERE raw_log = ?`, raw).Scan(&parseErr); err != nil {
+		t.Fatalf("Failed to query %q: %v", raw, err)
+	}
+	return parseErr.String
+}
+
+func TestPipeline_ParseErrorReasons(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	before := ingest.Snapshot()
+
+	input := strings.NewReader(strings.Join([]string{
+		`{"message":"ok"}`,
+		`{"message": oops}`,
+		`[1, 2]`,
+	}, "\n") + "\n")
+	stats := ingest.NewPipeline(stmt, "json", "", "", "", false, false).Run(input, ctx)
+
+	if stats.Lines != 3 || stats.Parsed != 1 || stats.Raw != 2 || stats.ParseErrors["json"] != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if got := parseErrorFor(t, db, `{"message":"ok"}`); got != "" {
+		t.Errorf("Expected no parse error, got %q", got)
+	}
+	if got := parseErrorFor(t, db, `{"message": oops}`); got != "json: invalid character 'o' looking for beginning of value at offset 13" {
+		t.Errorf("Unexpected JSON syntax reason: %q", got)
+	}
+	if got := parseErrorFor(t, db, `[1, 2]`); got != "json: expected an object, got array" {
+		t.Errorf("Unexpected JSON type reason: %q", got)
+	}
+
+	after := ingest.Snapshot()
+	if after.Lines-before.Lines != 3 || after.ParseErrors["json"]-before.ParseErrors["json"] != 2 {
+		t.Errorf("Expected counters to increase, before %+v after %+v", before, after)
+	}
+	if len(after.Recent) == 0 || after.Recent[0].RawLine != `[1, 2]` {
+		t.Errorf("Expected the latest failure first, got %+v", after.Recent)
+	}
+}
+
+func TestPipeline_ParseErrorTruncatesUTF8(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	// The 500 byte limit falls in the middle of a two byte character.
+	line := "{" + strings.Repeat("a", 498) + strings.Repeat("é", 10)
+	ingest.NewPipeline(stmt, "json", "", "", "", false, false).Run(strings.NewReader(line+"\n"), ctx)
+
+	recent := ingest.Snapshot().Recent
+	if len(recent) == 0 || recent[0].RawLine != "{"+strings.Repeat("a", 498) {
+		t.Fatalf("Expected the line cut before the split character, got %+v", recent)
+	}
+	if !utf8.ValidString(recent[0].RawLine) {
+		t.Errorf("Expected valid UTF-8, got %q", recent[0].RawLine)
+	}
+}
+
+func TestPipeline_ParseErrorRegexAndCSV(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	// A JSON failure is recorded even when the regex fallback parses the line.
+	regex := `^(?P<level>[A-Z]+) (?P<message>.*)$`
+	stats := ingest.NewPipeline(stmt, "json", regex, "", "", false, false).Run(strings.NewReader("WARN low disk\nlowercase line\n"), ctx)
+	if stats.Parsed != 1 || stats.Raw != 1 || stats.ParseErrors["json"] != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if got := parseErrorFor(t, db, "WARN low disk"); !strings.HasPrefix(got, "json: invalid character") || strings.Contains(got, "regex") {
+		t.Errorf("Unexpected reason for regex-parsed line: %q", got)
+	}
+	if got := parseErrorFor(t, db, "lowercase line"); !strings.HasSuffix(got, "; regex: no match") {
+		t.Errorf("Unexpected reason for unparsed line: %q", got)
+	}
+
+	ingest.NewPipeline(stmt, "csv", "", "", "a,b", false, false).Run(strings.NewReader("1,2,3\n"), ctx)
+	if got := parseErrorFor(t, db, "1,2,3"); got != "csv: CSV field count mismatch: expected 2, got 3" {
+		t.Errorf("Unexpected CSV reason: %q", got)
+	}
+}
+
+func TestPipeline_ParseErrorJQ(t *testing.T) {
+	db, stmt, ctx := setupTestDB(t)
+	defer db.Close()
+
+	stats := ingest.NewPipeline(stmt, "json", "", `error("bad entry")`, "", false, false).Run(strings.NewReader(`{"message":"hi"}`+"\n"), ctx)
+	if stats.ParseErrors["jq"] != 1 {
+		t.Errorf("Expected a jq error, got %+v", stats)
+	}
+	if got := parseErrorFor(t, db, `{"message":"hi"}`); !strings.HasPrefix(got, "jq: ") {
+		t.Errorf("Unexpected jq reason: %q", got)
+	}
+}
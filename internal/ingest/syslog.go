@@ -0,0 +1,348 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+const maxSyslogMessageSize = 64 * 1024
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogLevels = []string{
+	"emergency", "alert", "critical", "error", "warn", "notice", "info", "debug",
+}
+
+// ParseSyslog parses an RFC 5424 or RFC 3164 message into a log entry. The
+// PRI value is mapped to a facility name and a level.
+func ParseSyslog(line string) (shared.LogEntry, error) {
+	line = strings.TrimRight(line, "\r\n\x00")
+
+	pri, rest, err := parseSyslogPri(line)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry shared.LogEntry
+	if strings.HasPrefix(rest, "1 ") {
+		entry, err = parseRFC5424(rest[2:])
+	} else {
+		entry, err = parseRFC3164(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry["priority"] = pri
+	entry["facility"] = syslogFacilities[pri/8]
+	entry["severity"] = pri % 8
+	entry["level"] = syslogLevels[pri%8]
+
+	return entry, nil
+}
+
+func parseSyslogPri(line string) (int, string, error) {
+	if !strings.HasPrefix(line, "<") {
+		return 0, "", fmt.Errorf("missing PRI")
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("invalid PRI")
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", fmt.Errorf("invalid PRI %q", line[1:end])
+	}
+	return pri, line[end+1:], nil
+}
+
+func parseRFC5424(rest string) (shared.LogEntry, error) {
+	// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+	fields := make([]string, 0, 5)
+	for range 5 {
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			return nil, fmt.Errorf("truncated RFC 5424 header")
+		}
+		fields = append(fields, rest[:sp])
+		rest = rest[sp+1:]
+	}
+
+	entry := shared.LogEntry{}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		entry["timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	}
+	setNilable(entry, "hostname", fields[1])
+	setNilable(entry, "app_name", fields[2])
+	setNilable(entry, "proc_id", fields[3])
+	setNilable(entry, "msg_id", fields[4])
+
+	sd, msg, err := parseStructuredData(rest)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range sd {
+		entry[name] = value
+	}
+
+	entry["message"] = strings.TrimPrefix(msg, "\ufeff")
+	return entry, nil
+}
+
+// parseStructuredData returns the SD-PARAMs keyed by "sd-id.param-name", so
+// that they can be queried like any other field, and the rest of the message.
+func parseStructuredData(s string) (map[string]string, string, error) {
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		return nil, strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	sd := map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated structured data")
+		}
+		id := s[1:end]
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+				return nil, "", fmt.Errorf("invalid structured data param in %q", id)
+			}
+			name := s[:eq]
+			value, n, err := readSDValue(s[eq+2:])
+			if err != nil {
+				return nil, "", err
+			}
+			sd[id+"."+name] = value
+			s = s[eq+2+n:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data element %q", id)
+		}
+		s = s[1:]
+	}
+
+	return sd, strings.TrimPrefix(s, " "), nil
+}
+
+// readSDValue reads an escaped PARAM-VALUE up to its closing quote, returning
+// the unescaped value and the number of bytes consumed including the quote.
+func readSDValue(s string) (string, int, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+			}
+			sb.WriteByte(s[i])
+		case '"':
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated structured data value")
+}
+
+func parseRFC3164(rest string) (shared.LogEntry, error) {
+	// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+	entry := shared.LogEntry{}
+
+	if len(rest) >= 16 && rest[15] == ' ' {
+		ts, err := time.ParseInLocation(time.Stamp, rest[:15], time.Local)
+		if err == nil {
+			now := time.Now()
+			ts = ts.AddDate(now.Year(), 0, 0)
+			// A December message read in January belongs to last year.
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			entry["timestamp"] = ts.UTC().Format(time.RFC3339)
+			rest = rest[16:]
+
+			if sp := strings.IndexByte(rest, ' '); sp > 0 {
+				entry["hostname"] = rest[:sp]
+				rest = rest[sp+1:]
+			}
+		}
+	}
+
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.ContainsAny(rest[:colon], " ") {
+		tag := rest[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			entry["proc_id"] = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		entry["app_name"] = tag
+		rest = rest[colon+2:]
+	}
+
+	entry["message"] = rest
+	return entry, nil
+}
+
+func setNilable(entry shared.LogEntry, key, value string) {
+	if value != "-" {
+		entry[key] = value
+	}
+}
+
+// ListenSyslogUDP receives one syslog message per datagram on addr until ctx
+// is cancelled.
+func ListenSyslogUDP(addr string, pipeline *Pipeline, ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("📨 Listening for syslog on udp://%s\n", conn.LocalAddr())
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		processSyslog(string(buf[:n]), pipeline, ctx)
+	}
+}
+
+// ListenSyslogTCP accepts syslog connections on addr until ctx is cancelled.
+// Each connection may use octet-counting or newline framing (RFC 6587). Open
+// connections are closed when ctx is cancelled, and ListenSyslogTCP returns
+// once the messages already read from them have been stored.
+func ListenSyslogTCP(addr string, pipeline *Pipeline, ctx context.Context) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("📨 Listening for syslog on tcp://%s\n", ln.Addr())
+
+	var mu sync.Mutex
+	conns := map[net.Conn]bool{}
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		mu.Lock()
+		if ctx.Err() != nil {
+			mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		conns[conn] = true
+		mu.Unlock()
+
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			handleSyslogConn(conn, pipeline, ctx)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+func handleSyslogConn(conn net.Conn, pipeline *Pipeline, ctx context.Context) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := readSyslogFrame(reader)
+		if msg != "" {
+			processSyslog(msg, pipeline, ctx)
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Printf("⚠️ Syslog connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads the next message from a TCP stream. Octet-counted
+// frames start with a length prefix; anything else is newline delimited.
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil || length > maxSyslogMessageSize {
+			return "", fmt.Errorf("invalid octet count %q", prefix)
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func processSyslog(msg string, pipeline *Pipeline, ctx context.Context) {
+	if strings.TrimSpace(msg) == "" {
+		return
+	}
+	if err := pipeline.Process(msg, ctx); err != nil {
+		log.Printf("❌ Failed to insert log: %v", err)
+	}
+}
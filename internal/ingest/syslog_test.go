@@ -0,0 +1,216 @@
+package ingest_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+)
+
+func TestParseSyslog_RFC5424(t *testing.T) {
+	line := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event`
+
+	entry, err := ingest.ParseSyslog(line)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if entry["level"] != "notice" {
+		t.Errorf("Expected level 'notice', got %v", entry["level"])
+	}
+	if entry["facility"] != "local4" {
+		t.Errorf("Expected facility 'local4', got %v", entry["facility"])
+	}
+	if entry["hostname"] != "mymachine.example.com" || entry["app_name"] != "evntslog" || entry["msg_id"] != "ID47" {
+		t.Errorf("Unexpected header fields: %v", entry)
+	}
+	if _, ok := entry["proc_id"]; ok {
+		t.Errorf("Expected nil proc_id to be omitted, got %v", entry["proc_id"])
+	}
+	if entry["message"] != "An application event" {
+		t.Errorf("Expected message 'An application event', got %v", entry["message"])
+	}
+	if entry["timestamp"] != "2003-10-11T22:14:15.003Z" {
+		t.Errorf("Unexpected timestamp %v", entry["timestamp"])
+	}
+
+	if entry["exampleSDID@32473.eventID"] != "1011" || entry["exampleSDID@32473.eventSource"] != "Application" {
+		t.Errorf("Unexpected structured data params: %v", entry)
+	}
+}
+
+func TestParseSyslog_RFC5424EscapedStructuredData(t *testing.T) {
+	line := `<14>1 - host app 42 - [meta note="a \"quoted\] value"] msg`
+
+	entry, err := ingest.ParseSyslog(line)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if entry["meta.note"] != `a "quoted] value` {
+		t.Errorf("Unexpected unescaped value: %q", entry["meta.note"])
+	}
+	if entry["proc_id"] != "42" || entry["message"] != "msg" {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestParseSyslog_RFC3164(t *testing.T) {
+	line := `<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`
+
+	entry, err := ingest.ParseSyslog(line)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if entry["level"] != "critical" || entry["facility"] != "auth" {
+		t.Errorf("Unexpected level/facility: %v/%v", entry["level"], entry["facility"])
+	}
+	if entry["hostname"] != "mymachine" || entry["app_name"] != "su" || entry["proc_id"] != "123" {
+		t.Errorf("Unexpected header fields: %v", entry)
+	}
+	if entry["message"] != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Errorf("Unexpected message: %v", entry["message"])
+	}
+	if _, ok := entry["timestamp"]; !ok {
+		t.Errorf("Expected timestamp to be set")
+	}
+}
+
+func TestParseSyslog_MissingPri(t *testing.T) {
+	if _, err := ingest.ParseSyslog("just some text"); err == nil {
+		t.Errorf("Expected error for message without PRI")
+	}
+}
+
+func TestIngest_SyslogTCPOctetCounting(t *testing.T) {
+	db, stmt, _ := setupTestDB(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pipeline := ingest.NewPipeline(stmt, "syslog", "", "", "", false, false)
+	go ingest.ListenSyslogTCP(addr, pipeline, ctx)
+
+	var conn net.Conn
+	for range 20 {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	first := "<11>1 - host app - - - first\nline"
+	second := "<14>1 - host app - - [origin ip=\"10.0.0.1\"] second"
+	fmt.Fprintf(conn, "%d %s%d %s", len(first), first, len(second), second)
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var count int
+	for time.Now().Before(deadline) {
+		db.QueryRow("SELECT count(*) FROM logs").Scan(&count)
+		if count == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Structured data params can be filtered on like any other field.
+	ip, _ := filter.Field("origin.ip")
+	rows, err := db.Query(`SELECT level, message, log_format, ` + ip + ` FROM logs ORDER BY message`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var level, msg, format string
+		var origin sql.NullString
+		if err := rows.Scan(&level, &msg, &format, &origin); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s|%s|%s|%s", level, msg, format, origin.String))
+	}
+
+	want := []string{"error|first\nline|syslog|", "info|second|syslog|10.0.0.1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestIngest_SyslogTCPClosesConnectionsOnShutdown(t *testing.T) {
+	db, stmt, _ := setupTestDB(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pipeline := ingest.NewPipeline(stmt, "syslog", "", "", "", false, false)
+	done := make(chan error, 1)
+	go func() {
+		done <- ingest.ListenSyslogTCP(addr, pipeline, ctx)
+	}()
+
+	var conn net.Conn
+	for range 20 {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "<14>1 - host app - - - still connected\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	var count int
+	for time.Now().Before(deadline) {
+		db.QueryRow("SELECT count(*) FROM logs").Scan(&count)
+		if count == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if count != 1 {
+		t.Fatalf("Expected 1 log, got %d", count)
+	}
+
+	// The client keeps its connection open, which must not hold up shutdown.
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the listener to return once its connections were closed")
+	}
+}
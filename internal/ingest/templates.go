@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
+)
+
+// templateFlushInterval is how often changed templates are stored.
+const templateFlushInterval = time.Second
+
+// TemplateWriter keeps the templates table up to date with the current text
+// of each template a miner has created or generalized, so that rows can be
+// grouped under their template's latest text by template_id. It is shared by
+// every pipeline using the miner.
+type TemplateWriter struct {
+	db    *sql.DB
+	miner *templates.Miner
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewTemplateWriter loads the templates already stored into miner, so that
+// they carry on generalizing, and starts storing its changes. It returns nil
+// if there is no miner. Call Close once the pipelines using it have finished,
+// before closing the database.
+func NewTemplateWriter(db *sql.DB, miner *templates.Miner, ctx context.Context) (*TemplateWriter, error) {
+	if miner == nil {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT id, template FROM templates`)
+	if err != nil {
+		return nil, fmt.Errorf("load templates: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, template string
+		if err := rows.Scan(&id, &template); err != nil {
+			return nil, fmt.Errorf("load templates: %w", err)
+		}
+		miner.Load(id, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load templates: %w", err)
+	}
+
+	runCtx, stop := context.WithCancel(context.Background())
+	w := &TemplateWriter{db: db, miner: miner, stop: stop, done: make(chan struct{})}
+	go w.run(runCtx)
+	return w, nil
+}
+
+// Close stores any outstanding changes and stops the background flush.
+func (w *TemplateWriter) Close() {
+	if w == nil {
+		return
+	}
+	w.stop()
+	<-w.done
+}
+
+func (w *TemplateWriter) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(templateFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-ctx.Done():
+			w.flush()
+			return
+		}
+	}
+}
+
+func (w *TemplateWriter) flush() {
+	for id, template := range w.miner.Changes() {
+		_, err := w.db.ExecContext(context.Background(), `INSERT OR REPLACE INTO templates (id, template) VALUES (?, ?)`, id, template)
+		if err != nil {
+			log.Printf("❌ Failed to store template: %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/sampling"
+)
+
+// sampleWeightFlushInterval is how often lines sampled out after the last
+// entry kept for a key are added to that entry's weight.
+const sampleWeightFlushInterval = time.Second
+
+// SampleWeights adds the lines a sampler left out after the last entry it
+// kept for a key to that entry's sample_weight once the key goes quiet, so
+// that sum(sample_weight) counts every line read. It is shared by every
+// pipeline using the sampler.
+type SampleWeights struct {
+	db      Execer
+	sampler *sampling.Sampler
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewSampleWeights starts updating the weights of the entries kept by
+// sampler, returning nil if there is no sampler. Call Close once the
+// pipelines using it have finished, before closing the database.
+func NewSampleWeights(db Execer, sampler *sampling.Sampler) *SampleWeights {
+	if sampler == nil {
+		return nil
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	w := &SampleWeights{db: db, sampler: sampler, stop: stop, done: make(chan struct{})}
+	go w.run(ctx)
+	return w
+}
+
+// Close adds every outstanding leftover line and stops the background flush.
+func (w *SampleWeights) Close() {
+	if w == nil {
+		return
+	}
+	w.stop()
+	<-w.done
+}
+
+func (w *SampleWeights) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(sampleWeightFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush(false)
+		case <-ctx.Done():
+			w.flush(true)
+			return
+		}
+	}
+}
+
+// flush adds the leftover lines to their entries. An entry that has not been
+// inserted yet is tried again on the next flush, unless this is the last.
+func (w *SampleWeights) flush(all bool) {
+	for _, l := range w.sampler.Leftovers(all) {
+		result, err := w.db.ExecContext(context.Background(), `UPDATE logs SET sample_weight = coalesce(sample_weight, 1) + ? WHERE id = ?`, l.Lines, l.ID)
+		if err != nil {
+			log.Printf("❌ Failed to update sample weight: %v", err)
+			continue
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 && !all {
+			w.sampler.Restore(l)
+		}
+	}
+}
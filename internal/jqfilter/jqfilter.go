@@ -26,8 +26,18 @@ func Init(query string) {
 }
 
 func Apply(entry map[string]string) map[string]string {
+	result, err := Eval(entry)
+	if err != nil {
+		log.Printf("❌ %v", err)
+	}
+	return result
+}
+
+// Eval applies the query like Apply, returning the error instead of logging
+// it. On error the entry is returned unchanged.
+func Eval(entry map[string]string) (map[string]string, error) {
 	if compiled == nil {
-		return entry
+		return entry, nil
 	}
 
 	generic := make(map[string]interface{}, len(entry))
@@ -38,12 +48,10 @@ func Apply(entry map[string]string) map[string]string {
 	iter := compiled.Run(generic)
 	v, ok := iter.Next()
 	if !ok {
-		log.Printf("❌ jq query returned no result")
-		return entry
+		return entry, fmt.Errorf("jq query returned no result")
 	}
 	if err, ok := v.(error); ok {
-		log.Printf("❌ jq query error: %v", err)
-		return entry
+		return entry, fmt.Errorf("jq query error: %v", err)
 	}
 
 	mapped, ok := v.(map[string]interface{})
@@ -56,5 +64,5 @@ func Apply(entry map[string]string) map[string]string {
 		newEntry[k] = fmt.Sprintf("%v", v)
 	}
 
-	return newEntry
+	return newEntry, nil
 }
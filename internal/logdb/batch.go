@@ -0,0 +1,54 @@
+package logdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// batchChunk is the most rows inserted by a single statement. Each row binds
+// one parameter per column.
+const batchChunk = 100
+
+// BatchStmt is the insert statement from MustPrepareInsert, able to insert a
+// batch of rows in a single transaction. Each statement execution carries a
+// fixed overhead, so batches are inserted with multi-row statements, which is
+// much faster than inserting the rows one at a time.
+type BatchStmt struct {
+	*sql.Stmt
+	db *sql.DB
+}
+
+func MustPrepareBatchInsert(db *sql.DB, ctx context.Context) *BatchStmt {
+	return &BatchStmt{Stmt: MustPrepareInsert(db, ctx), db: db}
+}
+
+// ExecBatch inserts every row or, if any of them fails, none of them.
+func (b *BatchStmt) ExecBatch(ctx context.Context, rows [][]any) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(rows); start += batchChunk {
+		chunk := rows[start:min(start+batchChunk, len(rows))]
+		args := make([]any, 0, len(chunk)*len(insertColumns))
+		for _, row := range chunk {
+			args = append(args, row...)
+		}
+		if _, err := tx.ExecContext(ctx, multiRowInsert(len(chunk)), args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func multiRowInsert(rows int) string {
+	placeholders := "(?" + strings.Repeat(", ?", len(insertColumns)-1) + ")"
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = placeholders
+	}
+	return "INSERT INTO logs (" + strings.Join(insertColumns, ", ") + ") VALUES " + strings.Join(values, ", ")
+}
@@ -0,0 +1,52 @@
+package logdb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func batchRow(id, message string) []any {
+	now := time.Now().UTC()
+	return []any{
+		id, "batch", "info", message, message,
+		`{}`, fmt.Sprintf(`{"message":%q}`, message),
+		now, now, "json", nil, nil, nil, nil, 1, 1, nil, nil, nil, nil,
+	}
+}
+
+func TestBatchStmt_ExecBatch(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	stmt := logdb.MustPrepareBatchInsert(db, ctx)
+
+	rows := make([][]any, 250)
+	for i := range rows {
+		rows[i] = batchRow(uuid.New().String(), fmt.Sprintf("line %d", i))
+	}
+	if err := stmt.ExecBatch(ctx, rows); err != nil {
+		t.Fatalf("ExecBatch failed: %v", err)
+	}
+
+	var count int
+	db.QueryRow(`SELECT count(*) FROM logs WHERE trace_id = 'batch'`).Scan(&count)
+	if count != 250 {
+		t.Errorf("Expected 250 rows, got %d", count)
+	}
+
+	// A failing row rolls back the whole batch.
+	id := uuid.New().String()
+	err := stmt.ExecBatch(ctx, [][]any{batchRow(id, "first"), batchRow(id, "duplicate")})
+	if err == nil {
+		t.Fatal("Expected a duplicate key error")
+	}
+	db.QueryRow(`SELECT count(*) FROM logs WHERE id = ?`, id).Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected the batch to be rolled back, got %d rows", count)
+	}
+}
@@ -0,0 +1,162 @@
+package logdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// insertColumns lists the columns in the order MustPrepareInsert binds them.
+var insertColumns = []string{
+	"id",
+	"trace_id",
+	"level",
+	"message",
+	"raw_log",
+	"parsed_log",
+	"log",
+	"created_at",
+	"timestamp",
+	"log_format",
+	"regex_pattern",
+	"jq_filter",
+	"csv_headers",
+	"parse_error",
+	"sample_weight",
+	"repeat_count",
+	"first_seen",
+	"last_seen",
+	"template_id",
+	"template",
+}
+
+// Appender writes rows with DuckDB's appender API, which is much faster than
+// individual INSERTs. It accepts the same arguments as the statement from
+// MustPrepareInsert so it can be used in its place by the ingest pipeline.
+// It is not safe for concurrent use.
+type Appender struct {
+	conn     driver.Conn
+	appender *duckdb.Appender
+	// For each table column, the index of its value in the insert arguments,
+	// or -1 if it is not inserted.
+	positions []int
+	types     []string
+	row       []driver.Value
+}
+
+// MustInitBulk opens a database for bulk loading. The logs table is created
+// without its secondary indexes; call MustCreateIndexes once loading is done.
+func MustInitBulk(path string, ctx context.Context) (*sql.DB, *Appender) {
+	connector, err := duckdb.NewConnector(path, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	mustCreateTable(db, ctx)
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	appender, err := newAppender(db, conn, ctx)
+	if err != nil {
+		log.Fatalf("❌ Failed to create appender: %v", err)
+	}
+	return db, appender
+}
+
+func newAppender(db *sql.DB, conn driver.Conn, ctx context.Context) (*Appender, error) {
+	rows, err := db.QueryContext(ctx, `SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'logs' ORDER BY ordinal_position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	argIndex := map[string]int{}
+	for i, name := range insertColumns {
+		argIndex[name] = i
+	}
+
+	a := &Appender{conn: conn}
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			return nil, err
+		}
+		pos, ok := argIndex[name]
+		if !ok {
+			pos = -1
+		}
+		a.positions = append(a.positions, pos)
+		a.types = append(a.types, dataType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	a.row = make([]driver.Value, len(a.positions))
+
+	a.appender, err = duckdb.NewAppenderFromConn(conn, "", "logs")
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ExecContext appends a row, taking arguments in the order of MustPrepareInsert.
+func (a *Appender) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	if len(args) != len(insertColumns) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(insertColumns), len(args))
+	}
+
+	for i, pos := range a.positions {
+		if pos < 0 {
+			a.row[i] = nil
+			continue
+		}
+		a.row[i] = appenderValue(args[pos], a.types[i])
+	}
+
+	if err := a.appender.AppendRow(a.row...); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// appenderValue converts values bound for INSERT into the types the appender
+// expects: UUIDs as bytes, JSON as raw messages rather than strings, and
+// integers at the column's width.
+func appenderValue(v any, dataType string) driver.Value {
+	if n, ok := v.(int); ok && dataType == "INTEGER" {
+		return int32(n)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch dataType {
+	case "JSON":
+		return json.RawMessage(s)
+	case "UUID":
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return s
+		}
+		return duckdb.UUID(id)
+	}
+	return s
+}
+
+// Close flushes any buffered rows and releases the connection.
+func (a *Appender) Close() error {
+	err := a.appender.Close()
+	if closeErr := a.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
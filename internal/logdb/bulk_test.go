@@ -0,0 +1,59 @@
+package logdb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func TestMustInitBulk(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bulk.duckdb")
+
+	db, appender := logdb.MustInitBulk(path, ctx)
+
+	var indexes int
+	db.QueryRow(`SELECT count(*) FROM duckdb_indexes() WHERE table_name = 'logs'`).Scan(&indexes)
+	if indexes != 0 {
+		t.Errorf("Expected no secondary indexes before loading, got %d", indexes)
+	}
+
+	now := time.Now().UTC()
+	id := uuid.New().String()
+	_, err := appender.ExecContext(ctx,
+		id, "trace-1", "info", "hello", `{"message":"hello"}`,
+		`{"message":"hello"}`, `{"message":"hello","n":1}`,
+		now, now, "json", nil, nil, nil, nil, 1, 1, nil, nil, nil, nil,
+	)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := appender.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	logdb.MustCreateIndexes(db, ctx)
+	db.Close()
+
+	// Reopen the file the way the server does.
+	db = logdb.MustInit(path, ctx)
+	defer db.Close()
+
+	var gotID, message, n string
+	err = db.QueryRow(`SELECT id::TEXT, message, json_extract_string(log, '$.n') FROM logs WHERE trace_id = 'trace-1'`).Scan(&gotID, &message, &n)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if gotID != id || message != "hello" || n != "1" {
+		t.Errorf("Unexpected row: id=%s message=%s n=%s", gotID, message, n)
+	}
+
+	db.QueryRow(`SELECT count(*) FROM duckdb_indexes() WHERE table_name = 'logs'`).Scan(&indexes)
+	if indexes != 5 {
+		t.Errorf("Expected 5 indexes after loading, got %d", indexes)
+	}
+}
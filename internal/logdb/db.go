@@ -3,7 +3,9 @@ package logdb
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"os"
 	"time"
 
 	_ "github.com/marcboeker/go-duckdb"
@@ -15,7 +17,46 @@ func MustInit(path string, ctx context.Context) *sql.DB {
 		log.Fatal(err)
 	}
 
-	_, err = db.ExecContext(ctx, `
+	mustCreateTable(db, ctx)
+	MustCreateIndexes(db, ctx)
+
+	return db
+}
+
+// OpenReadOnly opens an existing database file for reading, such as to search
+// it from the command line. DuckDB does not allow this while another process
+// has the file open for writing.
+func OpenReadOnly(path string, ctx context.Context) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("duckdb", path+"?access_mode=read_only")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close checkpoints the database, so that a database file is complete without
+// its write-ahead log, and closes it.
+func Close(db *sql.DB, ctx context.Context) error {
+	refreshMu.Lock()
+	delete(indexedUpTo, db)
+	refreshMu.Unlock()
+
+	if _, err := db.ExecContext(ctx, `CHECKPOINT`); err != nil {
+		db.Close()
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	return db.Close()
+}
+
+func mustCreateTable(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS logs (
 			id UUID PRIMARY KEY DEFAULT uuid(),
 			timestamp TIMESTAMP,
@@ -30,23 +71,135 @@ func MustInit(path string, ctx context.Context) *sql.DB {
 			regex_pattern TEXT,
 			jq_filter TEXT,
 			csv_headers TEXT,
+			parse_error TEXT,
+			sample_weight INTEGER DEFAULT 1,
+			repeat_count INTEGER DEFAULT 1,
+			first_seen TIMESTAMP,
+			last_seen TIMESTAMP,
+			template_id TEXT,
+			template TEXT,
 		);
 	`)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Databases created by older versions are missing newer columns.
 	_, err = db.ExecContext(ctx, `
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS parse_error TEXT;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS sample_weight INTEGER DEFAULT 1;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS repeat_count INTEGER DEFAULT 1;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS first_seen TIMESTAMP;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS template_id TEXT;
+		ALTER TABLE logs ADD COLUMN IF NOT EXISTS template TEXT;
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mustCreateTemplateTable(db, ctx)
+	mustCreateSearchTables(db, ctx)
+	mustCreateSavedTables(db, ctx)
+	mustCreateAlertTables(db, ctx)
+}
+
+// mustCreateTemplateTable creates the table holding the current text of each
+// message template. The template column of logs holds the text as it was when
+// the row was stored, which becomes out of date as the template generalizes.
+func mustCreateTemplateTable(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS templates (
+			id TEXT PRIMARY KEY,
+			template TEXT NOT NULL
+		);
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// mustCreateSavedTables creates the tables for the saved queries and
+// dashboards managed by the saved package.
+func mustCreateSavedTables(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS saved_queries (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			sql TEXT,
+			filter TEXT,
+			time_range JSON,
+			visualization TEXT,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS dashboards (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			panels JSON,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP
+		);
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// mustCreateAlertTables creates the tables for the alert rules managed by the
+// alerts package, with the state of each rule and the history of its alerts.
+func mustCreateAlertTables(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS alert_rules (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			where_sql TEXT,
+			filter TEXT,
+			time_window TEXT,
+			threshold INTEGER,
+			notify JSON,
+			disabled BOOLEAN,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP,
+			state TEXT,
+			state_since TIMESTAMP,
+			last_evaluated_at TIMESTAMP,
+			last_count BIGINT,
+			last_error TEXT
+		);
+		CREATE TABLE IF NOT EXISTS alert_events (
+			id UUID PRIMARY KEY DEFAULT uuid(),
+			rule_id TEXT,
+			rule_name TEXT,
+			state TEXT,
+			count BIGINT,
+			threshold INTEGER,
+			time_window TEXT,
+			message TEXT,
+			samples JSON,
+			notify_errors JSON,
+			created_at TIMESTAMP
+		);
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// MustCreateIndexes creates the secondary indexes on the logs table. Bulk
+// imports call it after loading, since maintaining indexes slows inserts.
+func MustCreateIndexes(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
 		CREATE INDEX IF NOT EXISTS idx_created_at ON logs(created_at);
 		CREATE INDEX IF NOT EXISTS idx_timestamp ON logs(timestamp);
 		CREATE INDEX IF NOT EXISTS idx_trace_id ON logs(trace_id);
 		CREATE INDEX IF NOT EXISTS idx_level ON logs(level);
+		CREATE INDEX IF NOT EXISTS idx_template_id ON logs(template_id);
 	`)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	return db
 }
 
 func MustPrepareInsert(db *sql.DB, ctx context.Context) *sql.Stmt {
@@ -64,8 +217,15 @@ func MustPrepareInsert(db *sql.DB, ctx context.Context) *sql.Stmt {
 	  log_format,
 	  regex_pattern,
 	  jq_filter,
-	  csv_headers
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	  csv_headers,
+	  parse_error,
+	  sample_weight,
+	  repeat_count,
+	  first_seen,
+	  last_seen,
+	  template_id,
+	  template
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
   `)
 	if err != nil {
 		log.Fatal(err)
@@ -89,6 +249,13 @@ func StartAutoAnalyze(db *sql.DB, ctx context.Context) {
 				} else {
 					log.Println("🧠 Refreshed statistics on logs table")
 				}
+
+				indexed, err := RefreshSearchIndex(db, ctx)
+				if err != nil {
+					log.Printf("⚠️ Failed to refresh search index: %v", err)
+				} else if indexed > 0 {
+					log.Printf("🔎 Indexed %d entries for search", indexed)
+				}
 			case <-ctx.Done():
 				log.Println("🛑 Stopping auto-analyze")
 				return
@@ -1,10 +1,15 @@
 package logdb_test
 
 import (
+	"context"
 	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/uuid"
 	_ "github.com/marcboeker/go-duckdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
 )
 
 func TestQueryLogs(t *testing.T) {
@@ -33,3 +38,30 @@ func TestQueryLogs(t *testing.T) {
 		t.Errorf("Expected level=info, got %v", level)
 	}
 }
+
+func TestClose_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "logs.duckdb")
+
+	db := logdb.MustInit(path, ctx)
+	stmt := logdb.MustPrepareInsert(db, ctx)
+	if _, err := stmt.ExecContext(ctx, batchRow(uuid.New().String(), "kept")...); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+	if err := logdb.Close(db, ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".wal"); !os.IsNotExist(err) {
+		t.Errorf("Expected the write-ahead log to be checkpointed, got %v", err)
+	}
+
+	db = logdb.MustInit(path, ctx)
+	defer db.Close()
+	var count int
+	db.QueryRow(`SELECT count(*) FROM logs WHERE message = 'kept'`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected the row to survive, got %d", count)
+	}
+}
@@ -0,0 +1,42 @@
+package logdb
+
+import (
+	"database/sql"
+	"os"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+)
+
+// RegisterMetrics exposes the size of the database. For a database file this
+// is the size on disk including the write-ahead log; in-memory databases
+// report their memory usage.
+func RegisterMetrics(db *sql.DB, path string) {
+	metrics.NewGaugeFunc("magiclog_database_size_bytes", "Size of the DuckDB database.", func() float64 {
+		if path == "" {
+			return memoryUsage(db)
+		}
+		var size int64
+		for _, f := range []string{path, path + ".wal"} {
+			if info, err := os.Stat(f); err == nil {
+				size += info.Size()
+			}
+		}
+		return float64(size)
+	})
+
+	metrics.NewGaugeFunc("magiclog_database_memory_bytes", "Memory used by DuckDB.", func() float64 {
+		return memoryUsage(db)
+	})
+
+	metrics.NewGaugeFunc("magiclog_database_rows", "Rows in the logs table.", func() float64 {
+		var n int64
+		db.QueryRow(`SELECT count(*) FROM logs`).Scan(&n)
+		return float64(n)
+	})
+}
+
+func memoryUsage(db *sql.DB) float64 {
+	var bytes sql.NullInt64
+	db.QueryRow(`SELECT sum(memory_usage_bytes) FROM duckdb_memory()`).Scan(&bytes)
+	return float64(bytes.Int64)
+}
@@ -0,0 +1,313 @@
+package logdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The search index is an inverted index over the message and raw_log of each
+// entry, kept in tables beside the logs table. DuckDB's fts extension would
+// need downloading and rebuilds its index from scratch, whereas these tables
+// are brought up to date incrementally: by RefreshRecentSearchIndex before
+// each search, and by RefreshSearchIndex from the auto-analyze job.
+//
+// search_terms holds how often each word appears in an entry, and
+// search_docs the number of words in each indexed entry, which BM25 uses to
+// favour matches in shorter entries, and when the entry was received.
+
+// BM25 parameters: k1 limits how much repeating a word raises the score, and
+// b how much an entry's length lowers it.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchTokens splits text into words the same way as isSearchSeparator.
+const searchTokens = `regexp_split_to_array(lower(coalesce(l.message, '') || ' ' || coalesce(l.raw_log, '')), '[^\pL\pN_]+')`
+
+// searchIndexLag is how long before the newest indexed entry
+// RefreshRecentSearchIndex looks for entries to index. Entries are stamped
+// with created_at when they are read but inserted in batches, so one can be
+// stored after newer ones have been indexed.
+const searchIndexLag = time.Minute
+
+var (
+	// refreshMu stops concurrent refreshes from indexing the same entries
+	// twice, and guards indexedUpTo.
+	refreshMu sync.Mutex
+	// indexedUpTo holds the created_at of the newest entry indexed in each
+	// database.
+	indexedUpTo = map[*sql.DB]time.Time{}
+)
+
+func mustCreateSearchTables(db *sql.DB, ctx context.Context) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS search_terms (
+			log_id UUID,
+			term TEXT,
+			tf INTEGER
+		);
+		CREATE TABLE IF NOT EXISTS search_docs (
+			log_id UUID PRIMARY KEY,
+			length INTEGER,
+			created_at TIMESTAMP
+		);
+		ALTER TABLE search_docs ADD COLUMN IF NOT EXISTS created_at TIMESTAMP;
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// RefreshSearchIndex indexes every entry that has not been indexed yet and
+// returns how many there were. It compares the whole logs table with the
+// index, so it is run by the auto-analyze job to catch entries that
+// RefreshRecentSearchIndex missed.
+func RefreshSearchIndex(db *sql.DB, ctx context.Context) (int64, error) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	return refreshSearchIndex(db, time.Time{}, ctx)
+}
+
+// RefreshRecentSearchIndex indexes the entries received since the last
+// refresh and returns how many there were. Only entries received shortly
+// before the newest indexed entry or later are considered, so it is cheap
+// enough to run before each search.
+func RefreshRecentSearchIndex(db *sql.DB, ctx context.Context) (int64, error) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	newest, ok := indexedUpTo[db]
+	if !ok {
+		var stored sql.NullTime
+		if err := db.QueryRowContext(ctx, `SELECT max(created_at) FROM search_docs`).Scan(&stored); err != nil {
+			return 0, err
+		}
+		newest = stored.Time
+		indexedUpTo[db] = newest
+	}
+
+	var since time.Time
+	if !newest.IsZero() {
+		since = newest.Add(-searchIndexLag)
+	}
+	return refreshSearchIndex(db, since, ctx)
+}
+
+// refreshSearchIndex indexes the entries received since since, or all of
+// them if it is zero, that have not been indexed yet. The new entries are
+// staged in a temporary table, so the index is only read to skip entries
+// already in it. refreshMu must be held.
+func refreshSearchIndex(db *sql.DB, since time.Time, ctx context.Context) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	indexed, where := "search_docs", ""
+	var args []any
+	if !since.IsZero() {
+		// Entries indexed before search_docs recorded created_at have none.
+		indexed = "(SELECT log_id FROM search_docs WHERE created_at IS NULL OR created_at >= ?)"
+		where = "WHERE l.created_at >= ?"
+		args = []any{since, since}
+	}
+
+	// Entries without any words are indexed too, so they are not looked at
+	// again on every refresh.
+	_, err = tx.ExecContext(ctx, `
+		CREATE OR REPLACE TEMP TABLE search_new AS
+		SELECT l.id, l.created_at, list_filter(`+searchTokens+`, term -> term <> '') AS terms
+		FROM logs l ANTI JOIN `+indexed+` d ON d.log_id = l.id
+		`+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO search_terms (log_id, term, tf)
+		SELECT id, term, count(*)
+		FROM (SELECT id, unnest(terms) AS term FROM search_new)
+		GROUP BY id, term
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO search_docs (log_id, length, created_at)
+		SELECT id, len(terms), created_at FROM search_new
+	`)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	var newest sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT max(created_at) FROM search_new`).Scan(&newest); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE search_new`); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if newest.Valid && newest.Time.After(indexedUpTo[db]) {
+		indexedUpTo[db] = newest.Time
+	}
+	return count, nil
+}
+
+// SearchTerms returns the distinct words in a search, lower-cased, in the
+// order they first appear.
+func SearchTerms(text string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isSearchSeparator) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func isSearchSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+}
+
+// SearchScores returns a query for the id and BM25 score of every indexed
+// entry that contains any of terms, with its arguments. Entries containing
+// more of the terms, and rarer ones, score higher.
+func SearchScores(terms []string) (string, []any) {
+	values := make([]string, len(terms))
+	args := make([]any, len(terms))
+	for i, term := range terms {
+		values[i] = "(?)"
+		args[i] = term
+	}
+
+	query := fmt.Sprintf(`
+		WITH
+			stats AS (SELECT count(*) AS n, coalesce(avg(length), 0) AS avg_length FROM search_docs),
+			query_terms AS (SELECT * FROM (VALUES %s) v(term)),
+			df AS (
+				SELECT t.term, count(*) AS df
+				FROM search_terms t JOIN query_terms q ON q.term = t.term
+				GROUP BY t.term
+			)
+		SELECT t.log_id, sum(
+			ln(1 + (stats.n - df.df + 0.5) / (df.df + 0.5))
+			* t.tf * (%[2]g + 1)
+			/ (t.tf + %[2]g * (1 - %[3]g + %[3]g * d.length / greatest(stats.avg_length, 1)))
+		) AS score
+		FROM search_terms t
+		JOIN df ON df.term = t.term
+		JOIN search_docs d ON d.log_id = t.log_id
+		CROSS JOIN stats
+		GROUP BY t.log_id
+	`, strings.Join(values, ", "), bm25K1, bm25B)
+	return query, args
+}
+
+// Highlight returns an excerpt of text of about width characters around the
+// first of terms it contains, with each matching word wrapped in <mark> tags
+// and the rest HTML-escaped. It returns "" if text contains none of terms.
+func Highlight(text string, terms []string, width int) string {
+	match := map[string]bool{}
+	for _, term := range terms {
+		match[term] = true
+	}
+
+	// Byte offsets of the matching words.
+	type span struct{ start, end int }
+	var spans []span
+	start := -1
+	for i, r := range text + " " {
+		if !isSearchSeparator(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && match[strings.ToLower(text[start:i])] {
+			spans = append(spans, span{start, i})
+		}
+		start = -1
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	// Centre the excerpt on the first match, moving it to the nearest word
+	// boundaries.
+	from, to := 0, len(text)
+	if utf8.RuneCountInString(text) > width {
+		from = max(0, runeOffset(text, spans[0].start, -width/3))
+		to = min(len(text), runeOffset(text, from, width))
+		if to == len(text) {
+			from = max(0, runeOffset(text, to, -width))
+		}
+		if from > 0 {
+			if i := strings.IndexFunc(text[from:spans[0].start], isSearchSeparator); i >= 0 {
+				from += i
+			}
+		}
+		if to < len(text) {
+			if i := strings.LastIndexFunc(text[from:to], isSearchSeparator); i >= 0 && from+i > spans[0].end {
+				to = from + i
+			}
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, s := range spans {
+		if s.start < from {
+			continue
+		}
+		if s.end > to {
+			break
+		}
+		b.WriteString(html.EscapeString(text[pos:s.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[s.start:s.end]) + "</mark>")
+		pos = s.end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// runeOffset returns the byte offset n runes after (or, for negative n,
+// before) offset in s.
+func runeOffset(s string, offset, n int) int {
+	for ; n > 0 && offset < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	for ; n < 0 && offset > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(s[:offset])
+		offset -= size
+	}
+	return offset
+}
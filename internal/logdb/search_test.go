@@ -0,0 +1,154 @@
+package logdb_test
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+func TestSearchTerms(t *testing.T) {
+	terms := logdb.SearchTerms(`Connection TIMEOUT: "db-1" timeout après 30s`)
+	expected := []string{"connection", "timeout", "db", "1", "après", "30s"}
+	if !slices.Equal(terms, expected) {
+		t.Errorf("Expected %v, got %v", expected, terms)
+	}
+}
+
+func TestRefreshSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	stmt := logdb.MustPrepareBatchInsert(db, ctx)
+
+	messages := map[string]string{
+		"short":    "timeout",
+		"long":     "request timeout while waiting for the upstream server to respond",
+		"repeated": "timeout after timeout",
+		"both":     "database connection timeout",
+		"other":    "connection refused",
+	}
+	ids := map[string]string{}
+	var rows [][]any
+	for name, message := range messages {
+		ids[name] = uuid.New().String()
+		rows = append(rows, batchRow(ids[name], message))
+	}
+	if err := stmt.ExecBatch(ctx, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	indexed, err := logdb.RefreshSearchIndex(db, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 5 {
+		t.Errorf("Expected 5 entries indexed, got %d", indexed)
+	}
+
+	// Entries already indexed are skipped.
+	indexed, err = logdb.RefreshSearchIndex(db, ctx)
+	if err != nil || indexed != 0 {
+		t.Errorf("Expected nothing to index, got %d, %v", indexed, err)
+	}
+
+	search := func(text string) []string {
+		t.Helper()
+		scores, args := logdb.SearchScores(logdb.SearchTerms(text))
+		result, err := db.QueryContext(ctx, "SELECT log_id::TEXT FROM ("+scores+") ORDER BY score DESC", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Close()
+
+		var names []string
+		for result.Next() {
+			var id string
+			result.Scan(&id)
+			for name := range ids {
+				if ids[name] == id {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	}
+
+	// Repeats and shorter entries rank higher.
+	if got := search("timeout"); !slices.Equal(got, []string{"repeated", "short", "both", "long"}) {
+		t.Errorf("Unexpected ranking %v", got)
+	}
+	// Entries with more of the words rank higher.
+	if got := search("connection timeout"); len(got) != 5 || got[0] != "both" {
+		t.Errorf("Unexpected ranking %v", got)
+	}
+	if got := search("missing"); len(got) != 0 {
+		t.Errorf("Expected no matches, got %v", got)
+	}
+}
+
+func TestRefreshRecentSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	stmt := logdb.MustPrepareBatchInsert(db, ctx)
+
+	insert := func(message string, age time.Duration) {
+		t.Helper()
+		row := batchRow(uuid.New().String(), message)
+		row[7] = time.Now().UTC().Add(-age)
+		if err := stmt.ExecBatch(ctx, [][]any{row}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refresh := func(refresh func(*sql.DB, context.Context) (int64, error), want int64) {
+		t.Helper()
+		if indexed, err := refresh(db, ctx); err != nil || indexed != want {
+			t.Errorf("Expected %d entries indexed, got %d, %v", want, indexed, err)
+		}
+	}
+
+	insert("first timeout", 0)
+	refresh(logdb.RefreshRecentSearchIndex, 1)
+
+	// An entry received long before the newest indexed one is left for the
+	// full refresh, while later ones are indexed straight away.
+	insert("late timeout", time.Hour)
+	insert("second timeout", 0)
+	refresh(logdb.RefreshRecentSearchIndex, 1)
+	refresh(logdb.RefreshSearchIndex, 1)
+	refresh(logdb.RefreshRecentSearchIndex, 0)
+
+	var lengths int
+	if err := db.QueryRow(`SELECT sum(length) FROM search_docs`).Scan(&lengths); err != nil {
+		t.Fatal(err)
+	}
+	// Each entry's message and raw line are both indexed.
+	if lengths != 12 {
+		t.Errorf("Expected 12 words indexed, got %d", lengths)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	terms := []string{"timeout", "db"}
+
+	tests := []struct {
+		text, expected string
+	}{
+		{"Timeout talking to <db>", "<mark>Timeout</mark> talking to &lt;<mark>db</mark>&gt;"},
+		{"no match in timeouts", ""},
+		{
+			"a very long line that goes on and on before it finally mentions the timeout and then carries on for a while afterwards",
+			"… mentions the <mark>timeout</mark> and then carries on for a while…",
+		},
+	}
+	for _, tt := range tests {
+		if got := logdb.Highlight(tt.text, terms, 60); got != tt.expected {
+			t.Errorf("Highlight(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package loki decodes Loki push API requests (/loki/api/v1/push) into log
+// entries, so shippers configured for Loki can send logs to magic-log.
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Entry is a single pushed line and the fields parsed from it. Stream labels
+// and structured metadata are merged into the fields.
+type Entry struct {
+	Line   string
+	Fields shared.LogEntry
+}
+
+func newEntry(labels map[string]string, ts time.Time, line string, metadata map[string]string) Entry {
+	entry := shared.LogEntry{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry == nil {
+		entry = shared.LogEntry{"message": line}
+	}
+
+	// Fields from the line win over labels and metadata of the same name.
+	for _, fields := range []map[string]string{metadata, labels} {
+		for k, v := range fields {
+			if _, exists := entry[k]; !exists {
+				entry[k] = v
+			}
+		}
+	}
+	if _, exists := entry["timestamp"]; !exists {
+		entry["timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	}
+
+	return Entry{Line: line, Fields: entry}
+}
+
+type jsonPush struct {
+	Streams []struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	} `json:"streams"`
+}
+
+// DecodeJSON decodes the JSON push format, where each value is a tuple of a
+// nanosecond timestamp string, the line and optional structured metadata.
+func DecodeJSON(data []byte) ([]Entry, error) {
+	var req jsonPush
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("expected [timestamp, line] tuple, got %d elements", len(value))
+			}
+
+			var tsStr, line string
+			if err := json.Unmarshal(value[0], &tsStr); err != nil {
+				return nil, fmt.Errorf("invalid timestamp %s", value[0])
+			}
+			ns, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q", tsStr)
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("invalid line %s", value[1])
+			}
+
+			var metadata map[string]string
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &metadata); err != nil {
+					return nil, fmt.Errorf("invalid structured metadata %s", value[2])
+				}
+			}
+
+			entries = append(entries, newEntry(stream.Stream, time.Unix(0, ns), line, metadata))
+		}
+	}
+	return entries, nil
+}
+
+// DecodeProtobuf decodes a snappy compressed logproto.PushRequest, the default
+// encoding used by Promtail and other Loki clients.
+func DecodeProtobuf(data []byte) ([]Entry, error) {
+	decoded, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("snappy: %w", err)
+	}
+
+	var entries []Entry
+	err = eachBytesField(decoded, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		stream, err := decodeStream(v)
+		entries = append(entries, stream...)
+		return err
+	})
+	return entries, err
+}
+
+func decodeStream(data []byte) ([]Entry, error) {
+	var labels map[string]string
+	var raw [][]byte
+
+	err := eachBytesField(data, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			var err error
+			labels, err = ParseLabels(string(v))
+			return err
+		case 2:
+			raw = append(raw, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(raw))
+	for _, r := range raw {
+		var ts time.Time
+		var line string
+		var metadata map[string]string
+
+		err := eachBytesField(r, func(num protowire.Number, v []byte) error {
+			switch num {
+			case 1:
+				ts = decodeTimestamp(v)
+			case 2:
+				line = string(v)
+			case 3:
+				if metadata == nil {
+					metadata = map[string]string{}
+				}
+				var name, value string
+				err := eachBytesField(v, func(num protowire.Number, v []byte) error {
+					if num == 1 {
+						name = string(v)
+					} else if num == 2 {
+						value = string(v)
+					}
+					return nil
+				})
+				metadata[name] = value
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, newEntry(labels, ts, line, metadata))
+	}
+	return entries, nil
+}
+
+// decodeTimestamp reads a google.protobuf.Timestamp.
+func decodeTimestamp(data []byte) time.Time {
+	var seconds, nanos int64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || typ != protowire.VarintType {
+			break
+		}
+		data = data[n:]
+		v, m := protowire.ConsumeVarint(data)
+		if m < 0 {
+			break
+		}
+		data = data[m:]
+		switch num {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(v)
+		}
+	}
+	return time.Unix(seconds, nanos)
+}
+
+// eachBytesField walks a protobuf message, passing length-delimited fields to
+// fn and skipping scalar fields.
+func eachBytesField(data []byte, fn func(num protowire.Number, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, m := protowire.ConsumeBytes(data)
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		data = data[m:]
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseLabels parses a Prometheus style label set such as
+// {app="api", env="dev"}.
+func ParseLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid label set %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, fmt.Errorf("invalid label near %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+
+		quoted, err := strconv.QuotedPrefix(s[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %q", name)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %q", name)
+		}
+
+		labels[name] = value
+		s = s[eq+1+len(quoted):]
+	}
+}
@@ -0,0 +1,88 @@
+package loki_test
+
+import (
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/paul-schwendenman/magic-log-ui/internal/loki"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := loki.ParseLabels(`{app="api", env="dev",note="say \"hi\""}`)
+	if err != nil {
+		t.Fatalf("Failed to parse labels: %v", err)
+	}
+	if labels["app"] != "api" || labels["env"] != "dev" || labels["note"] != `say "hi"` {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+
+	if _, err := loki.ParseLabels(`app="api"`); err == nil {
+		t.Errorf("Expected error for labels without braces")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	body := `{"streams":[{"stream":{"app":"web","level":"warn"},"values":[
+		["1700000000000000000","plain line"],
+		["1700000000500000000","{\"message\":\"json line\",\"level\":\"error\"}",{"trace_id":"abc"}]
+	]}]}`
+
+	entries, err := loki.DecodeJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	first := entries[0].Fields
+	if first["message"] != "plain line" || first["app"] != "web" || first["level"] != "warn" {
+		t.Errorf("Unexpected first entry: %v", first)
+	}
+	if first["timestamp"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("Unexpected timestamp: %v", first["timestamp"])
+	}
+
+	second := entries[1].Fields
+	if second["message"] != "json line" || second["level"] != "error" || second["trace_id"] != "abc" {
+		t.Errorf("Unexpected second entry: %v", second)
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 1700000000)
+
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, ts)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, "hello from promtail")
+
+	var stream []byte
+	stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+	stream = protowire.AppendString(stream, `{job="varlogs"}`)
+	stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+	stream = protowire.AppendBytes(stream, entry)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, stream)
+
+	entries, err := loki.DecodeProtobuf(snappy.Encode(nil, req))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	fields := entries[0].Fields
+	if fields["message"] != "hello from promtail" || fields["job"] != "varlogs" {
+		t.Errorf("Unexpected entry: %v", fields)
+	}
+	if fields["timestamp"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("Unexpected timestamp: %v", fields["timestamp"])
+	}
+}
@@ -0,0 +1,217 @@
+// Package metrics implements the small subset of Prometheus metric types
+// magic-log needs and serves them in the text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+type entry struct {
+	name   string
+	help   string
+	typ    string
+	metric metric
+}
+
+var registry = struct {
+	sync.Mutex
+	entries []*entry
+}{}
+
+// register adds a metric, replacing any existing metric of the same name so
+// that components can be set up again (for example in tests).
+func register(name, help, typ string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, e := range registry.entries {
+		if e.name == name {
+			e.help, e.typ, e.metric = help, typ, m
+			return
+		}
+	}
+	registry.entries = append(registry.entries, &entry{name: name, help: help, typ: typ, metric: m})
+}
+
+// WriteText writes every registered metric in the Prometheus text format.
+func WriteText(w io.Writer) {
+	registry.Lock()
+	entries := append([]*entry(nil), registry.entries...)
+	registry.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	for _, e := range entries {
+		fmt.Fprintf(w, "# HELP %s %s\n", e.name, e.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", e.name, e.typ)
+		e.metric.write(w, e.name)
+	}
+}
+
+// Handler serves the registered metrics for Prometheus to scrape.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteText(w)
+}
+
+// Counter is a value that only increases.
+type Counter struct {
+	v atomic.Uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(name, help, "counter", c)
+	return c
+}
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+
+// CounterVec is a set of counters partitioned by the value of one label.
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: map[string]*Counter{}}
+	register(name, help, "counter", v)
+	return v
+}
+
+// With returns the counter for a label value, creating it if needed.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.counters))
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, v.label, quote(value), v.With(value).Value())
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v atomic.Int64
+}
+
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	register(name, help, "gauge", g)
+	return g
+}
+
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+func (g *Gauge) Add(n int64) { g.v.Add(n) }
+func (g *Gauge) Inc()        { g.v.Add(1) }
+func (g *Gauge) Dec()        { g.v.Add(-1) }
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, g.Value())
+}
+
+type gaugeFunc func() float64
+
+// NewGaugeFunc registers a gauge whose value is computed when scraped.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(name, help, "gauge", gaugeFunc(fn))
+}
+
+func (fn gaugeFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(fn()))
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// DefaultLatencyBuckets suits operations from tens of microseconds to seconds.
+var DefaultLatencyBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	register(name, help, "histogram", h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%s} %d\n", name, quote(formatFloat(upper)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
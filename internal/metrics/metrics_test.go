@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	c := metrics.NewCounter("test_events_total", "Events seen.")
+	c.Inc()
+	c.Add(2)
+
+	v := metrics.NewCounterVec("test_lines_total", "Lines by format.", "format")
+	v.With("json").Inc()
+	v.With(`we"ird`).Add(4)
+
+	g := metrics.NewGauge("test_clients", "Clients connected.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	metrics.NewGaugeFunc("test_size_bytes", "Size.", func() float64 { return 1536 })
+
+	h := metrics.NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	var buf bytes.Buffer
+	metrics.WriteText(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP test_events_total Events seen.\n# TYPE test_events_total counter\ntest_events_total 3\n",
+		`test_lines_total{format="json"} 1`,
+		`test_lines_total{format="we\"ird"} 4`,
+		"# TYPE test_clients gauge\ntest_clients 1\n",
+		"test_size_bytes 1536\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{le="0.1"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		"test_duration_seconds_sum 3.55\n",
+		"test_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegisterReplacesExisting(t *testing.T) {
+	metrics.NewGaugeFunc("test_replaced", "First.", func() float64 { return 1 })
+	metrics.NewGaugeFunc("test_replaced", "Second.", func() float64 { return 2 })
+
+	w := httptest.NewRecorder()
+	metrics.Handler(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	out := w.Body.String()
+	if strings.Count(out, "# TYPE test_replaced gauge") != 1 || !strings.Contains(out, "test_replaced 2\n") {
+		t.Errorf("Expected a single replaced metric, got:\n%s", out)
+	}
+}
@@ -0,0 +1,552 @@
+// Package otlp decodes OpenTelemetry ExportLogsServiceRequest payloads into log
+// entries. Both the protobuf and JSON encodings of OTLP/HTTP are supported.
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// record mirrors the parts of an OTLP LogRecord that are stored.
+type record struct {
+	timeUnixNano     uint64
+	observedUnixNano uint64
+	severityNumber   int64
+	severityText     string
+	body             any
+	attributes       map[string]any
+	traceID          []byte
+	spanID           []byte
+	eventName        string
+}
+
+type scope struct {
+	name    string
+	version string
+}
+
+// toEntry converts the record, together with its resource and scope, into
+// the flat shape stored in the logs table.
+func (r record) toEntry(resource map[string]any, s scope) shared.LogEntry {
+	entry := shared.LogEntry{
+		"level":   severityLevel(r.severityNumber, r.severityText),
+		"message": bodyMessage(r.body),
+	}
+
+	ts := r.timeUnixNano
+	if ts == 0 {
+		ts = r.observedUnixNano
+	}
+	if ts != 0 {
+		entry["timestamp"] = time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano)
+	}
+	if r.severityNumber != 0 {
+		entry["severity_number"] = r.severityNumber
+	}
+	if r.severityText != "" {
+		entry["severity_text"] = r.severityText
+	}
+	if _, ok := r.body.(string); !ok && r.body != nil {
+		entry["body"] = r.body
+	}
+	if len(r.attributes) > 0 {
+		entry["attributes"] = r.attributes
+	}
+	if len(resource) > 0 {
+		entry["resource"] = resource
+	}
+	if s.name != "" {
+		entry["scope"] = s.name
+	}
+	if s.version != "" {
+		entry["scope_version"] = s.version
+	}
+	if len(r.traceID) > 0 && !allZero(r.traceID) {
+		entry["trace_id"] = hex.EncodeToString(r.traceID)
+	}
+	if len(r.spanID) > 0 && !allZero(r.spanID) {
+		entry["span_id"] = hex.EncodeToString(r.spanID)
+	}
+	if r.eventName != "" {
+		entry["event_name"] = r.eventName
+	}
+
+	return entry
+}
+
+// severityLevel prefers the emitted severity text and falls back to the
+// ranges defined for SeverityNumber.
+func severityLevel(number int64, text string) string {
+	if text != "" {
+		return strings.ToLower(text)
+	}
+	switch {
+	case number >= 21:
+		return "fatal"
+	case number >= 17:
+		return "error"
+	case number >= 13:
+		return "warn"
+	case number >= 9:
+		return "info"
+	case number >= 5:
+		return "debug"
+	case number >= 1:
+		return "trace"
+	default:
+		return "info"
+	}
+}
+
+func bodyMessage(body any) string {
+	switch v := body.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]any:
+		if msg, ok := v["message"].(string); ok {
+			return msg
+		}
+	}
+	return string(shared.MustJson(body))
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeProtobuf decodes a protobuf encoded ExportLogsServiceRequest.
+func DecodeProtobuf(data []byte) ([]shared.LogEntry, error) {
+	var entries []shared.LogEntry
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		decoded, err := decodeResourceLogs(v)
+		if err != nil {
+			return fmt.Errorf("resource_logs: %w", err)
+		}
+		entries = append(entries, decoded...)
+		return nil
+	})
+
+	return entries, err
+}
+
+func decodeResourceLogs(data []byte) ([]shared.LogEntry, error) {
+	var resource map[string]any
+	var scopes [][]byte
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var err error
+			resource, err = decodeResource(v)
+			return err
+		case num == 2 && typ == protowire.BytesType:
+			scopes = append(scopes, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The resource may be encoded after its scope logs, so records are only
+	// converted once the whole message has been read.
+	var entries []shared.LogEntry
+	for _, s := range scopes {
+		decoded, err := decodeScopeLogs(s, resource)
+		if err != nil {
+			return nil, fmt.Errorf("scope_logs: %w", err)
+		}
+		entries = append(entries, decoded...)
+	}
+	return entries, nil
+}
+
+func decodeResource(data []byte) (map[string]any, error) {
+	attrs := map[string]any{}
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num == 1 && typ == protowire.BytesType {
+			return decodeKeyValue(v, attrs)
+		}
+		return nil
+	})
+	return attrs, err
+}
+
+func decodeScopeLogs(data []byte, resource map[string]any) ([]shared.LogEntry, error) {
+	var s scope
+	var records []record
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return eachField(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					s.name = string(v)
+				case num == 2 && typ == protowire.BytesType:
+					s.version = string(v)
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType:
+			r, err := decodeLogRecord(v)
+			if err != nil {
+				return fmt.Errorf("log_records: %w", err)
+			}
+			records = append(records, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]shared.LogEntry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, r.toEntry(resource, s))
+	}
+	return entries, nil
+}
+
+func decodeLogRecord(data []byte) (record, error) {
+	r := record{attributes: map[string]any{}}
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			r.timeUnixNano = fixed64(typ, v)
+		case 11:
+			r.observedUnixNano = fixed64(typ, v)
+		case 2:
+			n, _ := varint(typ, v)
+			r.severityNumber = int64(n)
+		}
+
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 3:
+			r.severityText = string(v)
+		case 5:
+			body, err := decodeAnyValue(v)
+			if err != nil {
+				return fmt.Errorf("body: %w", err)
+			}
+			r.body = body
+		case 6:
+			return decodeKeyValue(v, r.attributes)
+		case 9:
+			r.traceID = v
+		case 10:
+			r.spanID = v
+		case 12:
+			r.eventName = string(v)
+		}
+		return nil
+	})
+
+	return r, err
+}
+
+func decodeKeyValue(data []byte, into map[string]any) error {
+	var key string
+	var value any
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			key = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			var err error
+			value, err = decodeAnyValue(v)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	into[key] = value
+	return nil
+}
+
+func decodeAnyValue(data []byte) (any, error) {
+	var value any
+
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			value = string(v)
+		case 2:
+			n, _ := varint(typ, v)
+			value = n != 0
+		case 3:
+			n, _ := varint(typ, v)
+			value = int64(n)
+		case 4:
+			value = math.Float64frombits(fixed64(typ, v))
+		case 5:
+			values := []any{}
+			err := eachField(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num != 1 {
+					return nil
+				}
+				item, err := decodeAnyValue(v)
+				values = append(values, item)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = values
+		case 6:
+			kv := map[string]any{}
+			err := eachField(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num != 1 {
+					return nil
+				}
+				return decodeKeyValue(v, kv)
+			})
+			if err != nil {
+				return err
+			}
+			value = kv
+		case 7:
+			value = base64.StdEncoding.EncodeToString(v)
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+// eachField walks the top-level fields of a protobuf message. Length-delimited
+// values are passed as their contents; scalar values as their raw encoding.
+func eachField(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			b, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			v, n = b, m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			v = data[:n]
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func varint(typ protowire.Type, v []byte) (uint64, bool) {
+	if typ != protowire.VarintType {
+		return 0, false
+	}
+	n, m := protowire.ConsumeVarint(v)
+	return n, m > 0
+}
+
+func fixed64(typ protowire.Type, v []byte) uint64 {
+	if typ != protowire.Fixed64Type {
+		return 0
+	}
+	n, _ := protowire.ConsumeFixed64(v)
+	return n
+}
+
+type jsonRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []jsonKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"scope"`
+			LogRecords []jsonLogRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type jsonLogRecord struct {
+	TimeUnixNano         jsonUint64      `json:"timeUnixNano"`
+	ObservedTimeUnixNano jsonUint64      `json:"observedTimeUnixNano"`
+	SeverityNumber       json.RawMessage `json:"severityNumber"`
+	SeverityText         string          `json:"severityText"`
+	Body                 *jsonAnyValue   `json:"body"`
+	Attributes           []jsonKeyValue  `json:"attributes"`
+	TraceID              string          `json:"traceId"`
+	SpanID               string          `json:"spanId"`
+	EventName            string          `json:"eventName"`
+}
+
+type jsonKeyValue struct {
+	Key   string        `json:"key"`
+	Value *jsonAnyValue `json:"value"`
+}
+
+type jsonAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *jsonUint64 `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	BytesValue  *string     `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []*jsonAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []jsonKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+// jsonUint64 accepts 64-bit integers encoded either as JSON numbers or, as
+// the OTLP/JSON mapping requires, as decimal strings.
+type jsonUint64 uint64
+
+func (u *jsonUint64) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", b)
+	}
+	*u = jsonUint64(n)
+	return nil
+}
+
+func (v *jsonAnyValue) value() any {
+	switch {
+	case v == nil:
+		return nil
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		values := make([]any, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return keyValues(v.KvlistValue.Values)
+	}
+	return nil
+}
+
+func keyValues(kvs []jsonKeyValue) map[string]any {
+	m := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.value()
+	}
+	return m
+}
+
+// severityNumbers maps the enum names allowed by the OTLP/JSON mapping.
+var severityNumbers = map[string]int64{
+	"SEVERITY_NUMBER_TRACE": 1, "SEVERITY_NUMBER_DEBUG": 5, "SEVERITY_NUMBER_INFO": 9,
+	"SEVERITY_NUMBER_WARN": 13, "SEVERITY_NUMBER_ERROR": 17, "SEVERITY_NUMBER_FATAL": 21,
+}
+
+func parseSeverityNumber(raw json.RawMessage) int64 {
+	if len(raw) == 0 {
+		return 0
+	}
+	var n int64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return severityNumbers[name]
+	}
+	return 0
+}
+
+// DecodeJSON decodes the OTLP/JSON encoding of an ExportLogsServiceRequest.
+// Trace and span IDs are hex encoded in this mapping.
+func DecodeJSON(data []byte) ([]shared.LogEntry, error) {
+	var req jsonRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	var entries []shared.LogEntry
+	for _, rl := range req.ResourceLogs {
+		resource := keyValues(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			s := scope{name: sl.Scope.Name, version: sl.Scope.Version}
+			for _, lr := range sl.LogRecords {
+				traceID, err := hex.DecodeString(lr.TraceID)
+				if err != nil {
+					return nil, fmt.Errorf("invalid traceId %q", lr.TraceID)
+				}
+				spanID, err := hex.DecodeString(lr.SpanID)
+				if err != nil {
+					return nil, fmt.Errorf("invalid spanId %q", lr.SpanID)
+				}
+
+				r := record{
+					timeUnixNano:     uint64(lr.TimeUnixNano),
+					observedUnixNano: uint64(lr.ObservedTimeUnixNano),
+					severityNumber:   parseSeverityNumber(lr.SeverityNumber),
+					severityText:     lr.SeverityText,
+					body:             lr.Body.value(),
+					attributes:       keyValues(lr.Attributes),
+					traceID:          traceID,
+					spanID:           spanID,
+					eventName:        lr.EventName,
+				}
+				entries = append(entries, r.toEntry(resource, s))
+			}
+		}
+	}
+	return entries, nil
+}
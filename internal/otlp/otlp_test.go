@@ -0,0 +1,143 @@
+package otlp_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/otlp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func message(fields ...[]byte) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = append(b, f...)
+	}
+	return b
+}
+
+func bytesField(num protowire.Number, v []byte) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func stringField(num protowire.Number, v string) []byte {
+	return bytesField(num, []byte(v))
+}
+
+func varintField(num protowire.Number, v uint64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func fixed64Field(num protowire.Number, v uint64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func keyValue(key string, value []byte) []byte {
+	return message(stringField(1, key), bytesField(2, value))
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	traceID := []byte{0x5b, 0x8e, 0xfd, 0xf1, 0x2a, 0x3c, 0x4d, 0x5e, 0x6f, 0x70, 0x81, 0x92, 0xa3, 0xb4, 0xc5, 0xd6}
+	spanID := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+	logRecord := message(
+		fixed64Field(1, 1700000000123000000),
+		varintField(2, 17),
+		bytesField(5, stringField(1, "payment failed")),
+		bytesField(6, keyValue("http.status_code", varintField(3, 502))),
+		bytesField(6, keyValue("retry", varintField(2, 1))),
+		bytesField(6, keyValue("ratio", fixed64Field(4, math.Float64bits(0.5)))),
+		bytesField(9, traceID),
+		bytesField(10, spanID),
+	)
+	scopeLogs := message(
+		bytesField(1, message(stringField(1, "checkout"), stringField(2, "1.2.0"))),
+		bytesField(2, logRecord),
+	)
+	resource := bytesField(1, keyValue("service.name", stringField(1, "payments")))
+	// Scope logs before the resource to check ordering does not matter.
+	resourceLogs := message(bytesField(2, scopeLogs), bytesField(1, resource))
+	req := bytesField(1, resourceLogs)
+
+	entries, err := otlp.DecodeProtobuf(req)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e["level"] != "error" || e["message"] != "payment failed" {
+		t.Errorf("Unexpected level/message: %v/%v", e["level"], e["message"])
+	}
+	if e["trace_id"] != "5b8efdf12a3c4d5e6f708192a3b4c5d6" || e["span_id"] != "0102030405060708" {
+		t.Errorf("Unexpected ids: %v/%v", e["trace_id"], e["span_id"])
+	}
+	if e["timestamp"] != "2023-11-14T22:13:20.123Z" {
+		t.Errorf("Unexpected timestamp: %v", e["timestamp"])
+	}
+	if e["scope"] != "checkout" || e["scope_version"] != "1.2.0" {
+		t.Errorf("Unexpected scope: %v %v", e["scope"], e["scope_version"])
+	}
+
+	attrs := e["attributes"].(map[string]any)
+	if attrs["http.status_code"] != int64(502) || attrs["retry"] != true || attrs["ratio"] != 0.5 {
+		t.Errorf("Unexpected attributes: %v", attrs)
+	}
+	res := e["resource"].(map[string]any)
+	if res["service.name"] != "payments" {
+		t.Errorf("Unexpected resource: %v", res)
+	}
+}
+
+func TestDecodeProtobuf_Truncated(t *testing.T) {
+	req := bytesField(1, []byte{0x12, 0x05, 0x01})
+	if _, err := otlp.DecodeProtobuf(req); err == nil {
+		t.Errorf("Expected error for truncated message")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	body := `{
+		"resourceLogs": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+			"scopeLogs": [{
+				"scope": {"name": "http"},
+				"logRecords": [{
+					"timeUnixNano": "1700000000000000000",
+					"severityNumber": "SEVERITY_NUMBER_WARN",
+					"body": {"kvlistValue": {"values": [{"key": "message", "value": {"stringValue": "slow request"}}]}},
+					"attributes": [{"key": "duration_ms", "value": {"intValue": "1234"}}],
+					"traceId": "5B8EFDF12A3C4D5E6F708192A3B4C5D6",
+					"spanId": "0102030405060708"
+				}]
+			}]
+		}]
+	}`
+
+	entries, err := otlp.DecodeJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e["level"] != "warn" || e["message"] != "slow request" {
+		t.Errorf("Unexpected level/message: %v/%v", e["level"], e["message"])
+	}
+	if e["trace_id"] != "5b8efdf12a3c4d5e6f708192a3b4c5d6" {
+		t.Errorf("Unexpected trace id: %v", e["trace_id"])
+	}
+	if e["attributes"].(map[string]any)["duration_ms"] != int64(1234) {
+		t.Errorf("Unexpected attributes: %v", e["attributes"])
+	}
+	if e["resource"].(map[string]any)["service.name"] != "api" {
+		t.Errorf("Unexpected resource: %v", e["resource"])
+	}
+}
@@ -0,0 +1,341 @@
+// Package redact removes secrets and personal data from log entries before
+// they are stored or shown.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+const (
+	defaultMask = "[REDACTED]"
+	// Hash replaces a value with a short digest so that equal values can
+	// still be matched up without revealing them.
+	Hash = "hash"
+	// Values shorter than this are not searched for in the raw line, as they
+	// would match unrelated text.
+	minSecretLength = 4
+)
+
+// Config is the [redact] section of .magiclogrc.
+type Config struct {
+	// Drop lists fields removed from entries. A name matches a field at any
+	// depth; a dotted path such as request.headers.authorization matches
+	// from the top level. Names are not case sensitive.
+	Drop []string `toml:"drop" json:"drop,omitempty"`
+	// Mask lists fields whose values are replaced, matched like Drop.
+	Mask []string `toml:"mask" json:"mask,omitempty"`
+	// Replace is what masked fields are replaced with: a fixed string or
+	// "hash". Defaults to [REDACTED].
+	Replace string `toml:"replace" json:"replace,omitempty"`
+	// Salt is mixed into hashes so they cannot be reversed by hashing
+	// guesses.
+	Salt string `toml:"salt" json:"salt,omitempty"`
+	// Patterns enables built-in rules by name: email, jwt, credit_card and
+	// bearer.
+	Patterns []string `toml:"patterns" json:"patterns,omitempty"`
+	// Rules are patterns applied to every string value and the raw line.
+	Rules []Rule `toml:"rules" json:"rules,omitempty"`
+}
+
+// Rule replaces text matching a regex. If the pattern has a capture group
+// only the first group is replaced, so context such as "Bearer " is kept.
+type Rule struct {
+	Name string `toml:"name" json:"name"`
+	// Pattern may be left empty to use the built-in rule of the same name
+	// with a different replacement.
+	Pattern string `toml:"pattern" json:"pattern,omitempty"`
+	// Replace is a fixed string or "hash". Defaults to the rule name in
+	// capitals, such as [EMAIL].
+	Replace string `toml:"replace" json:"replace,omitempty"`
+}
+
+type builtin struct {
+	pattern  string
+	validate func(string) bool
+}
+
+var builtins = map[string]builtin{
+	"email":       {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"jwt":         {pattern: `eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	"credit_card": {pattern: `\b\d(?:[ -]?\d){12,18}\b`, validate: luhn},
+	"bearer":      {pattern: `(?i)\bbearer\s+([A-Za-z0-9._~+/=-]+)`},
+}
+
+// Builtins returns the names of the built-in rules.
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled reports whether the config redacts anything.
+func (c Config) Enabled() bool {
+	return len(c.Drop) > 0 || len(c.Mask) > 0 || len(c.Patterns) > 0 || len(c.Rules) > 0
+}
+
+type rule struct {
+	re       *regexp.Regexp
+	replace  string
+	validate func(string) bool
+}
+
+// Redactor applies a Config. It is safe for concurrent use.
+type Redactor struct {
+	drop    []string
+	mask    []string
+	replace string
+	salt    string
+	rules   []rule
+}
+
+// New compiles a config, returning nil if it does not redact anything.
+func New(cfg Config) (*Redactor, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	r := &Redactor{
+		drop:    lower(cfg.Drop),
+		mask:    lower(cfg.Mask),
+		replace: cfg.Replace,
+		salt:    cfg.Salt,
+	}
+	if r.replace == "" {
+		r.replace = defaultMask
+	}
+
+	rules := make([]Rule, 0, len(cfg.Patterns)+len(cfg.Rules))
+	for _, name := range cfg.Patterns {
+		rules = append(rules, Rule{Name: name})
+	}
+	rules = append(rules, cfg.Rules...)
+
+	for _, def := range rules {
+		compiled, err := compile(def)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func compile(def Rule) (rule, error) {
+	pattern := def.Pattern
+	var validate func(string) bool
+	if pattern == "" {
+		b, ok := builtins[def.Name]
+		if !ok {
+			return rule{}, fmt.Errorf("unknown redaction pattern %q (built-in patterns: %s)", def.Name, strings.Join(Builtins(), ", "))
+		}
+		pattern, validate = b.pattern, b.validate
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return rule{}, fmt.Errorf("redaction rule %q: %v", def.Name, err)
+	}
+
+	replace := def.Replace
+	if replace == "" {
+		if def.Name == "" || re.NumSubexp() > 0 {
+			replace = defaultMask
+		} else {
+			replace = "[" + strings.ToUpper(def.Name) + "]"
+		}
+	}
+	return rule{re: re, replace: replace, validate: validate}, nil
+}
+
+// Secrets maps values removed from an entry to their replacements, so they
+// can also be removed from the raw line.
+type Secrets map[string]string
+
+// Entry returns a redacted copy of entry, recording the values it removed.
+func (r *Redactor) Entry(entry shared.LogEntry, secrets Secrets) shared.LogEntry {
+	if entry == nil {
+		return nil
+	}
+	return shared.LogEntry(r.object(entry, "", secrets))
+}
+
+func (r *Redactor) object(m map[string]any, path string, secrets Secrets) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		switch {
+		case matches(r.drop, k, p):
+			r.collect(v, secrets)
+		case matches(r.mask, k, p):
+			out[k] = r.maskValue(v, secrets)
+		default:
+			out[k] = r.value(v, p, secrets)
+		}
+	}
+	return out
+}
+
+func (r *Redactor) value(v any, path string, secrets Secrets) any {
+	switch v := v.(type) {
+	case shared.LogEntry:
+		return r.object(v, path, secrets)
+	case map[string]any:
+		return r.object(v, path, secrets)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = r.value(e, path, secrets)
+		}
+		return out
+	case string:
+		return r.String(v)
+	}
+	return v
+}
+
+func (r *Redactor) maskValue(v any, secrets Secrets) any {
+	if s, ok := scalar(v); ok {
+		replacement := r.replacement(s, r.replace)
+		if len(s) >= minSecretLength {
+			secrets[s] = replacement
+		}
+		return replacement
+	}
+	r.collect(v, secrets)
+	return r.replacement(string(shared.MustJson(v)), r.replace)
+}
+
+// collect records every scalar inside a removed value.
+func (r *Redactor) collect(v any, secrets Secrets) {
+	switch v := v.(type) {
+	case shared.LogEntry:
+		for _, e := range v {
+			r.collect(e, secrets)
+		}
+	case map[string]any:
+		for _, e := range v {
+			r.collect(e, secrets)
+		}
+	case []any:
+		for _, e := range v {
+			r.collect(e, secrets)
+		}
+	default:
+		if s, ok := scalar(v); ok && len(s) >= minSecretLength {
+			secrets[s] = r.replacement(s, r.replace)
+		}
+	}
+}
+
+// String applies the pattern rules to s.
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.validate != nil && !rule.validate(match) {
+				return match
+			}
+			if rule.re.NumSubexp() > 0 {
+				loc := rule.re.FindStringSubmatchIndex(match)
+				if loc != nil && loc[2] >= 0 {
+					return match[:loc[2]] + r.replacement(match[loc[2]:loc[3]], rule.replace) + match[loc[3]:]
+				}
+			}
+			return r.replacement(match, rule.replace)
+		})
+	}
+	return s
+}
+
+// Line redacts a raw line: values removed from its entry are replaced
+// wherever they appear, then the pattern rules are applied.
+func (r *Redactor) Line(raw string, secrets Secrets) string {
+	values := make([]string, 0, len(secrets))
+	for v := range secrets {
+		values = append(values, v)
+	}
+	// Replace longer values first so a value containing another is not
+	// left half replaced.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		raw = strings.ReplaceAll(raw, v, secrets[v])
+	}
+	return r.String(raw)
+}
+
+func (r *Redactor) replacement(value, replace string) string {
+	if replace != Hash {
+		return replace
+	}
+	sum := sha256.Sum256([]byte(r.salt + value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func matches(names []string, key, path string) bool {
+	key, path = strings.ToLower(key), strings.ToLower(path)
+	for _, name := range names {
+		if name == path || (!strings.Contains(name, ".") && name == key) {
+			return true
+		}
+	}
+	return false
+}
+
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func lower(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = strings.ToLower(name)
+	}
+	return out
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by card
+// numbers, which rules out most other long numbers.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,117 @@
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/redact"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+func mustNew(t *testing.T, cfg redact.Config) *redact.Redactor {
+	t.Helper()
+	r, err := redact.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestNew_Disabled(t *testing.T) {
+	r, err := redact.New(redact.Config{})
+	if err != nil || r != nil {
+		t.Errorf("Expected no redactor for an empty config, got %v, %v", r, err)
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	for _, cfg := range []redact.Config{
+		{Patterns: []string{"ssn"}},
+		{Rules: []redact.Rule{{Name: "broken", Pattern: "("}}},
+	} {
+		if _, err := redact.New(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestEntry_DropAndMask(t *testing.T) {
+	r := mustNew(t, redact.Config{
+		Drop: []string{"Password", "request.headers.cookie"},
+		Mask: []string{"token"},
+	})
+
+	entry := shared.LogEntry{
+		"message":  "ok",
+		"password": "hunter22",
+		"request": map[string]any{
+			"headers": map[string]any{"cookie": "session=1234", "token": "abcd"},
+		},
+		"items":  []any{map[string]any{"token": 12345.0}},
+		"cookie": "kept",
+	}
+	secrets := redact.Secrets{}
+	got := r.Entry(entry, secrets)
+
+	want := `{"cookie":"kept","items":[{"token":"[REDACTED]"}],"message":"ok","request":{"headers":{"token":"[REDACTED]"}}}`
+	if string(shared.MustJson(got)) != want {
+		t.Errorf("Expected %s, got %s", want, shared.MustJson(got))
+	}
+	if _, ok := entry["password"]; !ok {
+		t.Error("Expected the original entry to be left alone")
+	}
+	for _, secret := range []string{"hunter22", "session=1234", "abcd", "12345"} {
+		if _, ok := secrets[secret]; !ok {
+			t.Errorf("Expected %q to be recorded as a secret", secret)
+		}
+	}
+}
+
+func TestEntry_Hash(t *testing.T) {
+	r := mustNew(t, redact.Config{Mask: []string{"user"}, Replace: redact.Hash, Salt: "pepper"})
+
+	a := r.Entry(shared.LogEntry{"user": "ann"}, redact.Secrets{})
+	b := r.Entry(shared.LogEntry{"user": "ann"}, redact.Secrets{})
+	c := r.Entry(shared.LogEntry{"user": "bob"}, redact.Secrets{})
+
+	if a["user"] != b["user"] || a["user"] == c["user"] {
+		t.Errorf("Expected equal values to hash alike, got %v %v %v", a["user"], b["user"], c["user"])
+	}
+	if !strings.HasPrefix(a["user"].(string), "sha256:") {
+		t.Errorf("Unexpected hash %v", a["user"])
+	}
+}
+
+func TestString_Patterns(t *testing.T) {
+	r := mustNew(t, redact.Config{
+		Patterns: []string{"email", "jwt", "credit_card", "bearer"},
+		Rules:    []redact.Rule{{Name: "api_key", Pattern: `key=(\w+)`}},
+	})
+
+	tests := []struct{ in, want string }{
+		{"mail ann@example.com now", "mail [EMAIL] now"},
+		{"token eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl", "token [JWT]"},
+		{"card 4111 1111 1111 1111 ok", "card [CREDIT_CARD] ok"},
+		{"order 1234567890123 ok", "order 1234567890123 ok"},
+		{"Authorization: Bearer s3cr3t", "Authorization: Bearer [REDACTED]"},
+		{"GET /?key=abc123&x=1", "GET /?key=[REDACTED]&x=1"},
+	}
+	for _, tt := range tests {
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLine_RemovesSecrets(t *testing.T) {
+	r := mustNew(t, redact.Config{Drop: []string{"password"}})
+
+	raw := `{"user":"ann","password":"hunter22"}`
+	secrets := redact.Secrets{}
+	r.Entry(shared.LogEntry{"user": "ann", "password": "hunter22"}, secrets)
+
+	want := `{"user":"ann","password":"[REDACTED]"}`
+	if got := r.Line(raw, secrets); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,277 @@
+// Package sampling decides which log entries to keep when a source is too
+// noisy to store every line.
+package sampling
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+// maxKeys bounds the number of keys tracked for each rate limit. Keys that
+// have not been seen in the current second are forgotten once it is reached.
+const maxKeys = 10000
+
+// Config is a sampling preset from the [sampling_presets] section of
+// .magiclogrc.
+type Config struct {
+	// AlwaysKeep is the lowest level that is never sampled out. Defaults to
+	// "error".
+	AlwaysKeep string `toml:"always_keep" json:"always_keep,omitempty"`
+	// Rules are tried in order and the first that matches an entry decides
+	// whether it is kept. Entries matching no rule are always kept.
+	Rules []Rule `toml:"rules" json:"rules"`
+}
+
+// Rule samples the entries whose Field matches Match.
+type Rule struct {
+	Name string `toml:"name" json:"name,omitempty"`
+	// Field is the field Match is applied to. Defaults to "message".
+	Field string `toml:"field" json:"field,omitempty"`
+	// Match is a regex selecting entries. An empty Match selects every entry.
+	Match string `toml:"match" json:"match,omitempty"`
+	// KeepOneIn keeps one entry in every N.
+	KeepOneIn int `toml:"keep_one_in" json:"keep_one_in,omitempty"`
+	// PerSecond keeps at most this many entries each second for each key.
+	PerSecond int `toml:"per_second" json:"per_second,omitempty"`
+	// Key is the field entries are grouped by, such as message or trace_id.
+	// Without a key every entry the rule matches shares one count.
+	Key string `toml:"key" json:"key,omitempty"`
+}
+
+// levels ranks level names so that AlwaysKeep can match more severe levels
+// too. Unknown levels rank with info.
+var levels = map[string]int{
+	"trace":     0,
+	"debug":     1,
+	"info":      2,
+	"notice":    3,
+	"warn":      4,
+	"warning":   4,
+	"error":     5,
+	"err":       5,
+	"critical":  6,
+	"crit":      6,
+	"fatal":     6,
+	"panic":     6,
+	"alert":     7,
+	"emergency": 8,
+	"emerg":     8,
+}
+
+func rank(level string) int {
+	if r, ok := levels[strings.ToLower(level)]; ok {
+		return r
+	}
+	// pino and bunyan log numeric levels.
+	if n, err := strconv.ParseFloat(level, 64); err == nil {
+		switch {
+		case n >= 60:
+			return levels["fatal"]
+		case n >= 50:
+			return levels["error"]
+		case n >= 40:
+			return levels["warn"]
+		case n >= 30:
+			return levels["info"]
+		case n >= 20:
+			return levels["debug"]
+		default:
+			return levels["trace"]
+		}
+	}
+	return levels["info"]
+}
+
+type rule struct {
+	Rule
+	match *regexp.Regexp
+
+	// counts tracks each key the rule has seen.
+	counts map[string]*count
+}
+
+type count struct {
+	seen     int
+	lastSeen int64
+	// second is the unix second that inSecond counts entries for.
+	second   int64
+	inSecond int
+	// skipped counts the entries sampled out since the last one kept.
+	skipped int
+	// lastKept is the id of the last entry kept, which the entries skipped
+	// after it are counted against once the key goes quiet.
+	lastKept string
+}
+
+// Sampler applies a Config. It is safe for concurrent use.
+type Sampler struct {
+	mu         sync.Mutex
+	rules      []*rule
+	alwaysKeep int
+	now        func() time.Time
+}
+
+// New compiles a preset, returning nil if it has no rules.
+func New(cfg Config) (*Sampler, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	alwaysKeep := cfg.AlwaysKeep
+	if alwaysKeep == "" {
+		alwaysKeep = "error"
+	}
+	if _, ok := levels[strings.ToLower(alwaysKeep)]; !ok {
+		return nil, fmt.Errorf("unknown always_keep level %q", cfg.AlwaysKeep)
+	}
+
+	s := &Sampler{alwaysKeep: rank(alwaysKeep), now: time.Now}
+	for i, def := range cfg.Rules {
+		name := def.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if def.KeepOneIn < 0 || def.PerSecond < 0 {
+			return nil, fmt.Errorf("sampling rule %s: keep_one_in and per_second must not be negative", name)
+		}
+		if def.KeepOneIn == 0 && def.PerSecond == 0 {
+			return nil, fmt.Errorf("sampling rule %s: set keep_one_in or per_second", name)
+		}
+		if def.Field == "" {
+			def.Field = "message"
+		}
+
+		r := &rule{Rule: def, counts: map[string]*count{}}
+		if def.Match != "" {
+			re, err := regexp.Compile(def.Match)
+			if err != nil {
+				return nil, fmt.Errorf("sampling rule %s: %v", name, err)
+			}
+			r.match = re
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Sample decides whether to keep the entry that will be stored with id. A
+// kept entry's weight is the number of lines it stands for: itself plus those
+// sampled out since the last entry kept by the same rule and key. Dropped
+// entries have a weight of 0. Lines sampled out after the last entry kept are
+// returned by Leftovers.
+//
+// Which entries are kept depends on the order they are sampled in.
+func (s *Sampler) Sample(entry shared.LogEntry, id string) int {
+	if rank(field(entry, "level")) >= s.alwaysKeep {
+		return 1
+	}
+
+	for _, r := range s.rules {
+		if r.match == nil || r.match.MatchString(field(entry, r.Field)) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return r.sample(field(entry, r.Key), id, s.now().Unix())
+		}
+	}
+	return 1
+}
+
+// Leftover is a number of lines sampled out after the entry stored with ID
+// was kept, which should be added to its weight.
+type Leftover struct {
+	ID    string
+	Lines int
+	count *count
+}
+
+// Leftovers returns the lines sampled out since the last entry kept for each
+// key that has not been seen in the current second, or for every key if all
+// is set. They no longer count towards the weight of the next entry kept.
+func (s *Sampler) Leftovers(all bool) []Leftover {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().Unix()
+	var leftovers []Leftover
+	for _, r := range s.rules {
+		for _, c := range r.counts {
+			if c.skipped == 0 || c.lastKept == "" || (!all && c.lastSeen == now) {
+				continue
+			}
+			leftovers = append(leftovers, Leftover{ID: c.lastKept, Lines: c.skipped, count: c})
+			c.skipped = 0
+		}
+	}
+	return leftovers
+}
+
+// Restore counts leftover lines towards the next entry kept again, for when
+// they could not be added to their entry.
+func (s *Sampler) Restore(l Leftover) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.count.skipped += l.Lines
+}
+
+func (r *rule) sample(key, id string, now int64) int {
+	c, ok := r.counts[key]
+	if !ok {
+		if len(r.counts) >= maxKeys {
+			r.forget(now)
+		}
+		c = &count{}
+		r.counts[key] = c
+	}
+
+	c.seen++
+	c.lastSeen = now
+	keep := r.KeepOneIn <= 1 || (c.seen-1)%r.KeepOneIn == 0
+	if keep && r.PerSecond > 0 {
+		if c.second != now {
+			c.second, c.inSecond = now, 0
+		}
+		keep = c.inSecond < r.PerSecond
+		if keep {
+			c.inSecond++
+		}
+	}
+
+	if !keep {
+		c.skipped++
+		return 0
+	}
+	weight := c.skipped + 1
+	c.skipped = 0
+	c.lastKept = id
+	return weight
+}
+
+// forget drops keys not seen in the current second, unless they have
+// leftover lines still to be counted.
+func (r *rule) forget(now int64) {
+	for key, c := range r.counts {
+		if c.lastSeen != now && c.skipped == 0 {
+			delete(r.counts, key)
+		}
+	}
+}
+
+func field(entry shared.LogEntry, name string) string {
+	if name == "" {
+		return ""
+	}
+	switch v := entry[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,141 @@
+package sampling
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+func mustNew(t *testing.T, cfg Config) *Sampler {
+	t.Helper()
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Rules: []Rule{{Match: "health"}}},
+		{Rules: []Rule{{Match: "(", KeepOneIn: 2}}},
+		{Rules: []Rule{{KeepOneIn: -1}}},
+		{AlwaysKeep: "loud", Rules: []Rule{{KeepOneIn: 2}}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+
+	if s, err := New(Config{}); s != nil || err != nil {
+		t.Errorf("Expected no sampler without rules, got %v, %v", s, err)
+	}
+}
+
+func TestSample_KeepOneIn(t *testing.T) {
+	s := mustNew(t, Config{Rules: []Rule{{Match: "^GET /health", KeepOneIn: 10}}})
+
+	var weights []int
+	for range 25 {
+		if w := s.Sample(shared.LogEntry{"message": "GET /health 200"}, ""); w > 0 {
+			weights = append(weights, w)
+		}
+	}
+	if len(weights) != 3 || weights[0] != 1 || weights[1] != 10 || weights[2] != 10 {
+		t.Errorf("Expected weights [1 10 10], got %v", weights)
+	}
+
+	if w := s.Sample(shared.LogEntry{"message": "GET /orders 200"}, ""); w != 1 {
+		t.Errorf("Expected unmatched entries to be kept, got weight %d", w)
+	}
+}
+
+func TestSample_AlwaysKeepsErrors(t *testing.T) {
+	s := mustNew(t, Config{Rules: []Rule{{KeepOneIn: 1000}}})
+
+	s.Sample(shared.LogEntry{"level": "info"}, "")
+	for _, level := range []string{"error", "ERROR", "fatal", "critical"} {
+		if w := s.Sample(shared.LogEntry{"level": level}, ""); w != 1 {
+			t.Errorf("Expected %s to be kept, got weight %d", level, w)
+		}
+	}
+	if w := s.Sample(shared.LogEntry{"level": "warn"}, ""); w != 0 {
+		t.Errorf("Expected warn to be sampled, got weight %d", w)
+	}
+}
+
+func TestSample_AlwaysKeepsNumericErrors(t *testing.T) {
+	s := mustNew(t, Config{Rules: []Rule{{KeepOneIn: 1000}}})
+
+	s.Sample(shared.LogEntry{"level": float64(30)}, "")
+	for _, level := range []any{float64(50), float64(60), "50"} {
+		if w := s.Sample(shared.LogEntry{"level": level}, ""); w != 1 {
+			t.Errorf("Expected level %v to be kept, got weight %d", level, w)
+		}
+	}
+	if w := s.Sample(shared.LogEntry{"level": float64(40)}, ""); w != 0 {
+		t.Errorf("Expected level 40 to be sampled, got weight %d", w)
+	}
+}
+
+func TestSample_PerSecondByKey(t *testing.T) {
+	s := mustNew(t, Config{Rules: []Rule{{PerSecond: 2, Key: "trace_id"}}})
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	kept := map[string]int{}
+	for range 5 {
+		for _, trace := range []string{"a", "b"} {
+			if s.Sample(shared.LogEntry{"trace_id": trace}, "") > 0 {
+				kept[trace]++
+			}
+		}
+	}
+	if kept["a"] != 2 || kept["b"] != 2 {
+		t.Errorf("Expected 2 entries kept per trace, got %v", kept)
+	}
+
+	now = now.Add(time.Second)
+	if w := s.Sample(shared.LogEntry{"trace_id": "a"}, ""); w != 4 {
+		t.Errorf("Expected the next second's first entry to stand for 4 lines, got %d", w)
+	}
+}
+
+func TestSample_Leftovers(t *testing.T) {
+	s := mustNew(t, Config{Rules: []Rule{{KeepOneIn: 3, Key: "message"}}})
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	total := 0
+	for i, message := range []string{"a", "a", "a", "a", "a", "b", "b"} {
+		total += s.Sample(shared.LogEntry{"message": message}, fmt.Sprintf("%s%d", message, i))
+	}
+	if total != 5 {
+		t.Errorf("Expected kept entries to stand for 5 of the 7 lines, got %d", total)
+	}
+
+	// Keys seen in the current second may still have entries kept.
+	if leftovers := s.Leftovers(false); len(leftovers) != 0 {
+		t.Errorf("Expected no leftovers yet, got %+v", leftovers)
+	}
+
+	now = now.Add(time.Second)
+	leftovers := s.Leftovers(false)
+	sort.Slice(leftovers, func(i, j int) bool { return leftovers[i].ID < leftovers[j].ID })
+	if len(leftovers) != 2 || leftovers[0].ID != "a3" || leftovers[0].Lines != 1 || leftovers[1].ID != "b5" || leftovers[1].Lines != 1 {
+		t.Fatalf("Expected a line left over after a3 and b5, got %+v", leftovers)
+	}
+	if again := s.Leftovers(true); len(again) != 0 {
+		t.Errorf("Expected leftovers to be returned once, got %+v", again)
+	}
+
+	// Leftovers that could not be stored count towards the next entry kept.
+	s.Restore(leftovers[0])
+	s.Sample(shared.LogEntry{"message": "a"}, "a7")
+	if w := s.Sample(shared.LogEntry{"message": "a"}, "a8"); w != 3 {
+		t.Errorf("Expected the restored line in the next weight, got %d", w)
+	}
+}
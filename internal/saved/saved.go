@@ -0,0 +1,471 @@
+// Package saved stores named queries and dashboards of them in the database,
+// so they can be shared between browsers and exported to a file.
+package saved
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+)
+
+// GridColumns is the width of the dashboard grid.
+const GridColumns = 12
+
+// Visualizations lists how a query's results can be shown.
+var Visualizations = []string{"table", "json", "line", "bar", "number"}
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrInUse is returned when deleting a query that a dashboard shows.
+	ErrInUse = errors.New("query is used by a dashboard")
+)
+
+type Query struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// SQL runs over the logs table like the q param of /query, narrowed by
+	// Filter. At least one of them is set.
+	SQL           string    `json:"sql,omitempty"`
+	Filter        string    `json:"filter,omitempty"`
+	TimeRange     TimeRange `json:"time_range"`
+	Visualization string    `json:"visualization"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TimeRange is either relative, such as the last 15m, or between fixed
+// times. The zero value covers all time.
+type TimeRange struct {
+	Last string     `json:"last,omitempty"`
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+type Dashboard struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Panels      []Panel   `json:"panels"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Panel places a saved query on a dashboard's grid, GridColumns wide, with
+// X and W counted in columns and Y and H in rows.
+type Panel struct {
+	QueryID string `json:"query_id"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	W       int    `json:"w"`
+	H       int    `json:"h"`
+}
+
+// Bundle holds every saved query and dashboard, as written by Export.
+type Bundle struct {
+	Version    int         `json:"version"`
+	Queries    []Query     `json:"queries"`
+	Dashboards []Dashboard `json:"dashboards"`
+}
+
+const bundleVersion = 1
+
+func (q *Query) Validate() []error {
+	var errs []error
+	if strings.TrimSpace(q.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if strings.TrimSpace(q.SQL) == "" && strings.TrimSpace(q.Filter) == "" {
+		errs = append(errs, errors.New("sql or filter is required"))
+	}
+	if q.Filter != "" {
+		if _, err := filter.Parse(q.Filter); err != nil {
+			errs = append(errs, fmt.Errorf("filter: %v", err))
+		}
+	}
+	if err := q.TimeRange.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if q.Visualization != "" && !slices.Contains(Visualizations, q.Visualization) {
+		errs = append(errs, fmt.Errorf("visualization %q is not one of %s", q.Visualization, strings.Join(Visualizations, ", ")))
+	}
+	return errs
+}
+
+func (q *Query) setDefaults() {
+	if q.Visualization == "" {
+		q.Visualization = Visualizations[0]
+	}
+}
+
+// now returns the current time at the precision of a DuckDB TIMESTAMP, so
+// that times read back compare equal.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (t TimeRange) validate() error {
+	if t.Last != "" {
+		if t.From != nil || t.To != nil {
+			return errors.New("time_range: last cannot be combined with from or to")
+		}
+		d, err := time.ParseDuration(t.Last)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("time_range: invalid last %q", t.Last)
+		}
+	}
+	if t.From != nil && t.To != nil && t.From.After(*t.To) {
+		return errors.New("time_range: from is after to")
+	}
+	return nil
+}
+
+// Validate checks a dashboard on its own; Store also checks that its panels
+// show saved queries.
+func (d *Dashboard) Validate() []error {
+	var errs []error
+	if strings.TrimSpace(d.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	for i, p := range d.Panels {
+		if p.QueryID == "" {
+			errs = append(errs, fmt.Errorf("panel %d: query_id is required", i+1))
+		}
+		if p.X < 0 || p.Y < 0 || p.W <= 0 || p.H <= 0 || p.X+p.W > GridColumns {
+			errs = append(errs, fmt.Errorf("panel %d: does not fit the %d column grid", i+1, GridColumns))
+		}
+	}
+	return errs
+}
+
+// ValidationError reports everything wrong with a query or dashboard.
+type ValidationError struct {
+	Errs []error
+}
+
+func (e *ValidationError) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store for the saved_queries and dashboards tables
+// created by logdb.MustInit.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+const queryColumns = `id, name, sql, filter, time_range::TEXT, visualization, created_at, updated_at`
+
+// ListQueries returns every saved query, ordered by name.
+func (s *Store) ListQueries(ctx context.Context) ([]Query, error) {
+	return listQueries(s.db, `ORDER BY lower(name), id`, nil, ctx)
+}
+
+func (s *Store) GetQuery(id string, ctx context.Context) (Query, error) {
+	queries, err := listQueries(s.db, `WHERE id = ?`, []any{id}, ctx)
+	if err != nil {
+		return Query{}, err
+	}
+	if len(queries) == 0 {
+		return Query{}, ErrNotFound
+	}
+	return queries[0], nil
+}
+
+// CreateQuery saves a new query, giving it an id.
+func (s *Store) CreateQuery(q Query, ctx context.Context) (Query, error) {
+	if errs := q.Validate(); len(errs) > 0 {
+		return Query{}, &ValidationError{errs}
+	}
+	q.ID = uuid.New().String()
+	q.CreatedAt = now()
+	q.UpdatedAt = q.CreatedAt
+	q.setDefaults()
+	return q, putQuery(s.db, q, ctx)
+}
+
+// UpdateQuery replaces the saved query with q's id.
+func (s *Store) UpdateQuery(q Query, ctx context.Context) (Query, error) {
+	existing, err := s.GetQuery(q.ID, ctx)
+	if err != nil {
+		return Query{}, err
+	}
+	if errs := q.Validate(); len(errs) > 0 {
+		return Query{}, &ValidationError{errs}
+	}
+	q.CreatedAt = existing.CreatedAt
+	q.UpdatedAt = now()
+	q.setDefaults()
+	return q, putQuery(s.db, q, ctx)
+}
+
+// DeleteQuery deletes a saved query, unless a dashboard shows it.
+func (s *Store) DeleteQuery(id string, ctx context.Context) error {
+	if _, err := s.GetQuery(id, ctx); err != nil {
+		return err
+	}
+	dashboards, err := s.ListDashboards(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range dashboards {
+		for _, p := range d.Panels {
+			if p.QueryID == id {
+				return fmt.Errorf("%w %q", ErrInUse, d.Name)
+			}
+		}
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM saved_queries WHERE id = ?`, id)
+	return err
+}
+
+func listQueries(db queryer, clause string, args []any, ctx context.Context) ([]Query, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+queryColumns+` FROM saved_queries `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queries := []Query{}
+	for rows.Next() {
+		var q Query
+		var sqlText, filterText, timeRange, visualization sql.NullString
+		if err := rows.Scan(&q.ID, &q.Name, &sqlText, &filterText, &timeRange, &visualization, &q.CreatedAt, &q.UpdatedAt); err != nil {
+			return nil, err
+		}
+		q.SQL, q.Filter, q.Visualization = sqlText.String, filterText.String, visualization.String
+		if timeRange.Valid {
+			if err := json.Unmarshal([]byte(timeRange.String), &q.TimeRange); err != nil {
+				return nil, fmt.Errorf("query %s: time_range: %w", q.ID, err)
+			}
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+func putQuery(db queryer, q Query, ctx context.Context) error {
+	timeRange, err := json.Marshal(q.TimeRange)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO saved_queries (id, name, sql, filter, time_range, visualization, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, q.ID, q.Name, q.SQL, q.Filter, string(timeRange), q.Visualization, q.CreatedAt.UTC(), q.UpdatedAt.UTC())
+	return err
+}
+
+const dashboardColumns = `id, name, description, panels::TEXT, created_at, updated_at`
+
+// ListDashboards returns every dashboard, ordered by name.
+func (s *Store) ListDashboards(ctx context.Context) ([]Dashboard, error) {
+	return listDashboards(s.db, `ORDER BY lower(name), id`, nil, ctx)
+}
+
+func (s *Store) GetDashboard(id string, ctx context.Context) (Dashboard, error) {
+	dashboards, err := listDashboards(s.db, `WHERE id = ?`, []any{id}, ctx)
+	if err != nil {
+		return Dashboard{}, err
+	}
+	if len(dashboards) == 0 {
+		return Dashboard{}, ErrNotFound
+	}
+	return dashboards[0], nil
+}
+
+// CreateDashboard saves a new dashboard, giving it an id.
+func (s *Store) CreateDashboard(d Dashboard, ctx context.Context) (Dashboard, error) {
+	if err := s.validateDashboard(d, nil, ctx); err != nil {
+		return Dashboard{}, err
+	}
+	d.ID = uuid.New().String()
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	return d, putDashboard(s.db, d, ctx)
+}
+
+// UpdateDashboard replaces the dashboard with d's id.
+func (s *Store) UpdateDashboard(d Dashboard, ctx context.Context) (Dashboard, error) {
+	existing, err := s.GetDashboard(d.ID, ctx)
+	if err != nil {
+		return Dashboard{}, err
+	}
+	if err := s.validateDashboard(d, nil, ctx); err != nil {
+		return Dashboard{}, err
+	}
+	d.CreatedAt = existing.CreatedAt
+	d.UpdatedAt = now()
+	return d, putDashboard(s.db, d, ctx)
+}
+
+func (s *Store) DeleteDashboard(id string, ctx context.Context) error {
+	if _, err := s.GetDashboard(id, ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM dashboards WHERE id = ?`, id)
+	return err
+}
+
+// validateDashboard checks d, and that its panels show saved queries or
+// queries in extra.
+func (s *Store) validateDashboard(d Dashboard, extra []Query, ctx context.Context) error {
+	errs := d.Validate()
+	queries, err := s.ListQueries(ctx)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, q := range slices.Concat(queries, extra) {
+		known[q.ID] = true
+	}
+	for i, p := range d.Panels {
+		if p.QueryID != "" && !known[p.QueryID] {
+			errs = append(errs, fmt.Errorf("panel %d: no saved query %q", i+1, p.QueryID))
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{errs}
+	}
+	return nil
+}
+
+func listDashboards(db queryer, clause string, args []any, ctx context.Context) ([]Dashboard, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+dashboardColumns+` FROM dashboards `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dashboards := []Dashboard{}
+	for rows.Next() {
+		var d Dashboard
+		var description, panels sql.NullString
+		if err := rows.Scan(&d.ID, &d.Name, &description, &panels, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.Description = description.String
+		d.Panels = []Panel{}
+		if panels.Valid {
+			if err := json.Unmarshal([]byte(panels.String), &d.Panels); err != nil {
+				return nil, fmt.Errorf("dashboard %s: panels: %w", d.ID, err)
+			}
+		}
+		dashboards = append(dashboards, d)
+	}
+	return dashboards, rows.Err()
+}
+
+func putDashboard(db queryer, d Dashboard, ctx context.Context) error {
+	if d.Panels == nil {
+		d.Panels = []Panel{}
+	}
+	panels, err := json.Marshal(d.Panels)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO dashboards (id, name, description, panels, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, d.ID, d.Name, d.Description, string(panels), d.CreatedAt.UTC(), d.UpdatedAt.UTC())
+	return err
+}
+
+// Export returns every saved query and dashboard.
+func (s *Store) Export(ctx context.Context) (Bundle, error) {
+	queries, err := s.ListQueries(ctx)
+	if err != nil {
+		return Bundle{}, err
+	}
+	dashboards, err := s.ListDashboards(ctx)
+	if err != nil {
+		return Bundle{}, err
+	}
+	return Bundle{Version: bundleVersion, Queries: queries, Dashboards: dashboards}, nil
+}
+
+// Import saves the queries and dashboards in b, replacing those with the
+// same ids and keeping the rest. Entries without an id are given one. Either
+// everything is imported or, if anything is invalid, nothing is.
+func (s *Store) Import(b Bundle, ctx context.Context) error {
+	if b.Version != bundleVersion {
+		return &ValidationError{[]error{fmt.Errorf("unsupported version %d", b.Version)}}
+	}
+
+	importedAt := now()
+	var errs []error
+	for i := range b.Queries {
+		q := &b.Queries[i]
+		for _, err := range q.Validate() {
+			errs = append(errs, fmt.Errorf("query %q: %v", q.Name, err))
+		}
+		if q.ID == "" {
+			q.ID = uuid.New().String()
+		}
+		q.setDefaults()
+		if q.CreatedAt.IsZero() {
+			q.CreatedAt = importedAt
+		}
+		if q.UpdatedAt.IsZero() {
+			q.UpdatedAt = importedAt
+		}
+	}
+	for i := range b.Dashboards {
+		d := &b.Dashboards[i]
+		if err := s.validateDashboard(*d, b.Queries, ctx); err != nil {
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				return err
+			}
+			for _, err := range invalid.Errs {
+				errs = append(errs, fmt.Errorf("dashboard %q: %v", d.Name, err))
+			}
+		}
+		if d.ID == "" {
+			d.ID = uuid.New().String()
+		}
+		if d.CreatedAt.IsZero() {
+			d.CreatedAt = importedAt
+		}
+		if d.UpdatedAt.IsZero() {
+			d.UpdatedAt = importedAt
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{errs}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, q := range b.Queries {
+		if err := putQuery(tx, q, ctx); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.Dashboards {
+		if err := putDashboard(tx, d, ctx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
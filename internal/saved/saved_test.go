@@ -0,0 +1,156 @@
+package saved_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/saved"
+)
+
+func setupStore(t *testing.T) *saved.Store {
+	t.Helper()
+	db := logdb.MustInit("", context.Background())
+	t.Cleanup(func() { db.Close() })
+	return saved.NewStore(db)
+}
+
+func TestStore_Queries(t *testing.T) {
+	ctx := context.Background()
+	store := setupStore(t)
+
+	q, err := store.CreateQuery(saved.Query{
+		Name:      "Errors",
+		Filter:    "level:error",
+		TimeRange: saved.TimeRange{Last: "15m"},
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.ID == "" || q.Visualization != "table" || q.CreatedAt.IsZero() {
+		t.Errorf("Unexpected query %+v", q)
+	}
+
+	q.SQL = "SELECT level, count(*) FROM logs GROUP BY level"
+	q.Visualization = "bar"
+	if _, err := store.UpdateQuery(q, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetQuery(q.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SQL != q.SQL || got.Visualization != "bar" || got.TimeRange.Last != "15m" || !got.CreatedAt.Equal(q.CreatedAt) {
+		t.Errorf("Unexpected query %+v", got)
+	}
+
+	if err := store.DeleteQuery(q.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetQuery(q.ID, ctx); !errors.Is(err, saved.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_Validation(t *testing.T) {
+	ctx := context.Background()
+	store := setupStore(t)
+
+	_, err := store.CreateQuery(saved.Query{
+		Filter:        "(level:error",
+		TimeRange:     saved.TimeRange{Last: "soon"},
+		Visualization: "pie",
+	}, ctx)
+	var invalid *saved.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Errs) != 4 {
+		t.Errorf("Expected 4 validation errors, got %v", err)
+	}
+
+	_, err = store.CreateDashboard(saved.Dashboard{
+		Name:   "Overview",
+		Panels: []saved.Panel{{QueryID: "missing", X: 6, W: 7, H: 1}},
+	}, ctx)
+	if !errors.As(err, &invalid) || len(invalid.Errs) != 2 {
+		t.Errorf("Expected 2 validation errors, got %v", err)
+	}
+}
+
+func TestStore_Dashboards(t *testing.T) {
+	ctx := context.Background()
+	store := setupStore(t)
+
+	q, err := store.CreateQuery(saved.Query{Name: "Errors", Filter: "level:error"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := store.CreateDashboard(saved.Dashboard{
+		Name:   "Overview",
+		Panels: []saved.Panel{{QueryID: q.ID, W: 6, H: 4}},
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queries on a dashboard cannot be deleted.
+	if err := store.DeleteQuery(q.ID, ctx); !errors.Is(err, saved.ErrInUse) {
+		t.Errorf("Expected ErrInUse, got %v", err)
+	}
+
+	if err := store.DeleteDashboard(d.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteQuery(q.ID, ctx); err != nil {
+		t.Errorf("Expected the query to be deleted, got %v", err)
+	}
+}
+
+func TestStore_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := setupStore(t)
+
+	q, _ := source.CreateQuery(saved.Query{Name: "Errors", Filter: "level:error"}, ctx)
+	source.CreateQuery(saved.Query{Name: "all", SQL: "SELECT * FROM logs"}, ctx)
+	source.CreateDashboard(saved.Dashboard{Name: "Overview", Panels: []saved.Panel{{QueryID: q.ID, W: 12, H: 4}}}, ctx)
+
+	bundle, err := source.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Version != 1 || len(bundle.Queries) != 2 || len(bundle.Dashboards) != 1 {
+		t.Fatalf("Unexpected bundle %+v", bundle)
+	}
+	// Sorted by name, ignoring case, so exports diff cleanly.
+	if bundle.Queries[0].Name != "all" {
+		t.Errorf("Expected queries sorted by name, got %+v", bundle.Queries)
+	}
+
+	target := setupStore(t)
+	if err := target.Import(bundle, ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Importing again replaces rather than duplicates.
+	if err := target.Import(bundle, ctx); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := target.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Queries) != 2 || len(imported.Dashboards) != 1 || imported.Dashboards[0].Panels[0].QueryID != q.ID {
+		t.Errorf("Unexpected import %+v", imported)
+	}
+
+	// Nothing is imported if anything is invalid.
+	bundle.Queries = append(bundle.Queries, saved.Query{Name: "new", SQL: "SELECT 1"})
+	bundle.Dashboards[0].Panels[0].QueryID = "missing"
+	var invalid *saved.ValidationError
+	if err := target.Import(bundle, ctx); !errors.As(err, &invalid) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	queries, _ := target.ListQueries(ctx)
+	if len(queries) != 2 {
+		t.Errorf("Expected the import to be rejected, got %d queries", len(queries))
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
+)
+
+const defaultAlertHistoryLimit = 100
+const maxAlertHistoryLimit = 1000
+
+// AlertRulesHandler lists alert rules with their state and creates new ones.
+func AlertRulesHandler(store *alerts.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			rules, err := store.ListRules(ctx)
+			if err != nil {
+				writeAlertError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"rules": rules})
+		case http.MethodPost:
+			var rule alerts.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			rule, err := store.CreateRule(rule, ctx)
+			if err != nil {
+				writeAlertError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(rule)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// AlertRuleHandler gets, replaces or deletes the alert rule in the path.
+func AlertRuleHandler(store *alerts.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var rule alerts.Rule
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			rule, err = store.GetRule(id, ctx)
+		case http.MethodPut:
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			rule.ID = id
+			rule, err = store.UpdateRule(rule, ctx)
+		case http.MethodDelete:
+			if err := store.DeleteRule(id, ctx); err != nil {
+				writeAlertError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			writeAlertError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+// AlertHistoryHandler lists the most recent alerts, newest first, for the
+// rule in the optional rule_id parameter.
+func AlertHistoryHandler(store *alerts.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit, err := limitParam(r, defaultAlertHistoryLimit, maxAlertHistoryLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		events, err := store.ListEvents(r.URL.Query().Get("rule_id"), limit, ctx)
+		if err != nil {
+			writeAlertError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"events": events})
+	}
+}
+
+// writeAlertError responds with the status for an error from alerts.Store.
+func writeAlertError(w http.ResponseWriter, err error) {
+	var invalid *alerts.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]string{
+			"errors": errorStrings(invalid.Errs),
+		})
+	case errors.Is(err, alerts.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
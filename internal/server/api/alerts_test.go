@@ -0,0 +1,66 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+func TestAlertHandlers(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	ctx := context.Background()
+	store := alerts.NewStore(db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/alerts", api.AlertRulesHandler(store, ctx))
+	mux.HandleFunc("/api/alerts/history", api.AlertHistoryHandler(store, ctx))
+	mux.HandleFunc("/api/alerts/{id}", api.AlertRuleHandler(store, ctx))
+
+	w := send(t, mux, "POST", "/api/alerts", `{"name":"Errors","filter":"level:error","window":"5m","threshold":0}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var rule alerts.Rule
+	json.Unmarshal(w.Body.Bytes(), &rule)
+
+	if err := pipeline.Process(`{"level":"error","message":"boom"}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := alerts.NewScheduler(store, false).Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var list struct {
+		Rules []alerts.Rule `json:"rules"`
+	}
+	if code := getJSON(t, mux, "/api/alerts", &list); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].Status.State != alerts.StateFiring || list.Rules[0].Status.LastCount != 1 {
+		t.Errorf("Expected the rule to be firing, got %+v", list.Rules)
+	}
+
+	var history struct {
+		Events []alerts.Event `json:"events"`
+	}
+	if code := getJSON(t, mux, "/api/alerts/history?rule_id="+rule.ID, &history); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(history.Events) != 1 || history.Events[0].Message != "Errors: 1 matching line in the last 5m, more than 0" {
+		t.Errorf("Unexpected history %+v", history.Events)
+	}
+
+	if w := send(t, mux, "PUT", "/api/alerts/"+rule.ID, `{"name":"Errors","where":"bogus("}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+	if w := send(t, mux, "DELETE", "/api/alerts/"+rule.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if code := getJSON(t, mux, "/api/alerts/"+rule.ID, &rule); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const defaultFieldsSample = 10000
+const maxFieldsSample = 100000
+
+const defaultTopValues = 5
+const maxTopValues = 50
+
+// maxDistinct bounds the values counted for each field. Fields with more are
+// reported as having at least that many, with top values from those seen
+// first.
+const maxDistinct = 1000
+
+// maxFields bounds the fields reported, as logs with generated keys could
+// otherwise have any number.
+const maxFields = 1000
+
+type fieldValue struct {
+	Value any `json:"value"`
+	Count int `json:"count"`
+}
+
+type fieldStats struct {
+	Path  string         `json:"path"`
+	Types map[string]int `json:"types"`
+	Count int            `json:"count"`
+	// FillRate is the fraction of the scanned rows that have the field.
+	FillRate float64 `json:"fill_rate"`
+	// Cardinality is the number of distinct values, which is a lower bound
+	// if CardinalityExact is false.
+	Cardinality      int          `json:"cardinality"`
+	CardinalityExact bool         `json:"cardinality_exact"`
+	TopValues        []fieldValue `json:"top_values"`
+
+	values map[string]*fieldValue
+}
+
+// FieldsHandler describes the fields found in the log JSON of the most recent
+// rows: their types, how often they are set, how many distinct values they
+// have and their most common values. Nested fields are reported by their
+// dotted path, such as request.method.
+//
+// It takes the same where, filter, from and to parameters as
+// HistogramHandler, with from and to bounding the entries' timestamp so that
+// the fields describe the entries a histogram of the same range counts.
+// sample sets the number of rows scanned and top the number of values
+// reported for each field.
+func FieldsHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		where, args, err := filterParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if condition := strings.TrimSpace(r.URL.Query().Get("where")); condition != "" {
+			where = append(where, "("+condition+")")
+		}
+		timeWhere, timeArgs, err := timeRange(r, "timestamp")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		where = append(append(where, timeWhere...), "log IS NOT NULL")
+		args = append(args, timeArgs...)
+
+		sample, err := intParam(r, "sample", defaultFieldsSample, maxFieldsSample)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		top, err := intParam(r, "top", defaultTopValues, maxTopValues)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := fmt.Sprintf(`
+			SELECT log::TEXT
+			FROM logs
+			WHERE %s
+			ORDER BY created_at DESC
+			LIMIT ?
+		`, strings.Join(where, " AND "))
+		rows, err := db.QueryContext(ctx, query, append(args, sample)...)
+		if err != nil {
+			http.Error(w, "fields query failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		catalog := map[string]*fieldStats{}
+		scanned := 0
+		for rows.Next() {
+			var raw string
+			if err := rows.Scan(&raw); err != nil {
+				http.Error(w, "fields query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			decoder := json.NewDecoder(strings.NewReader(raw))
+			decoder.UseNumber()
+			var entry map[string]any
+			if err := decoder.Decode(&entry); err != nil {
+				continue
+			}
+			scanned++
+			observe(catalog, "", entry)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "fields query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fields := make([]fieldStats, 0, len(catalog))
+		for _, f := range catalog {
+			f.FillRate = float64(f.Count) / float64(scanned)
+			f.Cardinality = len(f.values)
+			f.CardinalityExact = len(f.values) < maxDistinct
+			f.TopValues = topValues(f.values, top)
+			fields = append(fields, *f)
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			if fields[i].Count != fields[j].Count {
+				return fields[i].Count > fields[j].Count
+			}
+			return fields[i].Path < fields[j].Path
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"rows": scanned, "fields": fields})
+	}
+}
+
+// observe adds the fields of an object to the catalog, descending into
+// nested objects.
+func observe(catalog map[string]*fieldStats, prefix string, object map[string]any) {
+	for key, value := range object {
+		path := prefix + key
+		f, ok := catalog[path]
+		if !ok {
+			if len(catalog) >= maxFields {
+				continue
+			}
+			f = &fieldStats{Path: path, Types: map[string]int{}, values: map[string]*fieldValue{}}
+			catalog[path] = f
+		}
+		f.Count++
+
+		kind := jsonType(value)
+		f.Types[kind]++
+		switch kind {
+		case "object":
+			observe(catalog, path+".", value.(map[string]any))
+			continue
+		case "array", "null":
+			continue
+		}
+
+		key := kind + ":" + fmt.Sprint(value)
+		if v, ok := f.values[key]; ok {
+			v.Count++
+		} else if len(f.values) < maxDistinct {
+			f.values[key] = &fieldValue{Value: value, Count: 1}
+		}
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+// topValues returns the n most common values, most common first.
+func topValues(values map[string]*fieldValue, n int) []fieldValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := values[keys[i]], values[keys[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return keys[i] < keys[j]
+	})
+
+	result := []fieldValue{}
+	for _, key := range keys[:min(n, len(keys))] {
+		result = append(result, *values[key])
+	}
+	return result
+}
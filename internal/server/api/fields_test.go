@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+type fieldsResponse struct {
+	Rows   int `json:"rows"`
+	Fields []struct {
+		Path             string         `json:"path"`
+		Types            map[string]int `json:"types"`
+		Count            int            `json:"count"`
+		FillRate         float64        `json:"fill_rate"`
+		Cardinality      int            `json:"cardinality"`
+		CardinalityExact bool           `json:"cardinality_exact"`
+		TopValues        []struct {
+			Value any `json:"value"`
+			Count int `json:"count"`
+		} `json:"top_values"`
+	} `json:"fields"`
+}
+
+func TestFieldsHandler(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	ctx := context.Background()
+
+	for i := range 4 {
+		method := "GET"
+		if i == 3 {
+			method = "POST"
+		}
+		line := fmt.Sprintf(`{"level":"info","message":"request %d","request":{"method":%q,"status":%d},"tags":["a"]}`, i, method, 200+i%2)
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pipeline.Process(`{"level":"error","message":"boom","user":null}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := api.FieldsHandler(db, ctx)
+	var resp fieldsResponse
+	if code := getJSON(t, handler, "/api/fields", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Rows != 5 {
+		t.Errorf("Expected 5 rows scanned, got %d", resp.Rows)
+	}
+
+	fields := map[string]int{}
+	for i, f := range resp.Fields {
+		fields[f.Path] = i
+	}
+	for _, path := range []string{"level", "message", "timestamp", "request", "request.method", "request.status", "tags", "user"} {
+		if _, ok := fields[path]; !ok {
+			t.Errorf("Expected field %s, got %+v", path, resp.Fields)
+		}
+	}
+
+	method := resp.Fields[fields["request.method"]]
+	if method.Count != 4 || method.FillRate != 0.8 || method.Types["string"] != 4 {
+		t.Errorf("Unexpected request.method stats %+v", method)
+	}
+	if method.Cardinality != 2 || !method.CardinalityExact {
+		t.Errorf("Expected 2 distinct methods, got %+v", method)
+	}
+	if len(method.TopValues) != 2 || method.TopValues[0].Value != "GET" || method.TopValues[0].Count != 3 {
+		t.Errorf("Unexpected top values %+v", method.TopValues)
+	}
+
+	status := resp.Fields[fields["request.status"]]
+	if status.Types["number"] != 4 || status.TopValues[0].Value != float64(200) {
+		t.Errorf("Unexpected request.status stats %+v", status)
+	}
+
+	if user := resp.Fields[fields["user"]]; user.Types["null"] != 1 || len(user.TopValues) != 0 {
+		t.Errorf("Unexpected user stats %+v", user)
+	}
+	if request := resp.Fields[fields["request"]]; request.Types["object"] != 4 {
+		t.Errorf("Unexpected request stats %+v", request)
+	}
+
+	if code := getJSON(t, handler, "/api/fields?filter=level=error&top=1", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Rows != 1 {
+		t.Errorf("Expected only the filtered row, got %d", resp.Rows)
+	}
+
+	// Like the histogram, from and to bound the entries' timestamp rather than
+	// when they were received.
+	if err := pipeline.Process(`{"timestamp":"2025-01-01T10:00:00Z","message":"old","region":"eu"}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := getJSON(t, handler, "/api/fields?from=2025-01-01T09:00:00Z&to=2025-01-01T11:00:00Z", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Rows != 1 {
+		t.Errorf("Expected only the row timestamped in range, got %d", resp.Rows)
+	}
+
+	if code := getJSON(t, handler, "/api/fields?sample=0", &resp); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid sample, got %d", code)
+	}
+}
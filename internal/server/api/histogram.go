@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+)
+
+// targetBuckets is the number of bars an automatic bucket size aims for.
+const targetBuckets = 100
+
+// maxBuckets bounds the bars in a histogram, so a small bucket over a long
+// range is refused rather than answered with a huge response.
+const maxBuckets = 10000
+
+const defaultSeries = 10
+const maxSeries = 50
+
+// bucketSizes are the sizes an automatic bucket is chosen from.
+var bucketSizes = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour,
+}
+
+// Series names for entries without a value for the group_by field, and for
+// the groups beyond the series limit.
+const (
+	noneSeries  = "(none)"
+	otherSeries = "(other)"
+)
+
+type histogramSeries struct {
+	Name   string `json:"name"`
+	Total  int    `json:"total"`
+	Counts []int  `json:"counts"`
+}
+
+type histogram struct {
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	Bucket        string            `json:"bucket"`
+	BucketSeconds float64           `json:"bucket_seconds"`
+	Buckets       []time.Time       `json:"buckets"`
+	Series        []histogramSeries `json:"series"`
+	Total         int               `json:"total"`
+}
+
+// HistogramHandler counts entries in time buckets, optionally split into a
+// series for each value of a field, for charts such as logs per minute by
+// level. Every series has a count for every bucket, including empty ones.
+// Counts are of lines rather than rows, so entries sampled out or collapsed
+// into a repeated row are counted too.
+//
+// Entries are matched by the optional where parameter, a SQL condition, and
+// filter parameters, such as level:error, and bucketed by their timestamp
+// between from and to, which default to the first and last matching entry.
+// bucket is a duration such as 1m, or auto to aim for about 100 buckets.
+// group_by names the field to split by, keeping the series most common ones
+// and counting the rest together.
+func HistogramHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		where, args, err := filterParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if condition := strings.TrimSpace(r.URL.Query().Get("where")); condition != "" {
+			where = append(where, "("+condition+")")
+		}
+		where = append(where, "timestamp IS NOT NULL")
+
+		// Without group_by every entry is counted in one series.
+		group := "'count'"
+		if field := r.URL.Query().Get("group_by"); field != "" {
+			if group, err = filter.Field(field); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		series, err := intParam(r, "series", defaultSeries, maxSeries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, hasFrom, err := timeParam(r, "from")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, hasTo, err := timeParam(r, "to")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !hasFrom || !hasTo {
+			var first, last sql.NullTime
+			query := fmt.Sprintf(`SELECT min(timestamp), max(timestamp) FROM logs WHERE %s`, strings.Join(where, " AND "))
+			if err := db.QueryRowContext(ctx, query, args...).Scan(&first, &last); err != nil {
+				http.Error(w, "histogram query failed: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !first.Valid {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(histogram{From: from, To: to, Buckets: []time.Time{}, Series: []histogramSeries{}})
+				return
+			}
+			if !hasFrom {
+				from = first.Time.UTC()
+			}
+			if !hasTo {
+				to = last.Time.UTC()
+			}
+		}
+		if to.Before(from) {
+			http.Error(w, "to must not be before from", http.StatusBadRequest)
+			return
+		}
+
+		bucket, err := bucketParam(r, to.Sub(from))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start := from.Truncate(bucket)
+		n := int(to.Sub(start)/bucket) + 1
+		if n > maxBuckets {
+			http.Error(w, fmt.Sprintf("bucket %s is too small for the range, which would need %d buckets (at most %d)", bucket, n, maxBuckets), http.StatusBadRequest)
+			return
+		}
+
+		query := fmt.Sprintf(`
+			SELECT
+				(epoch_us(timestamp) - ?) // ?,
+				coalesce(%s, ?),
+				sum(coalesce(sample_weight, 1) * coalesce(repeat_count, 1))
+			FROM logs
+			WHERE %s AND timestamp >= ? AND timestamp <= ?
+			GROUP BY ALL
+		`, group, strings.Join(where, " AND "))
+		queryArgs := append([]any{start.UnixMicro(), bucket.Microseconds(), noneSeries}, args...)
+		queryArgs = append(queryArgs, from, to)
+
+		rows, err := db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			http.Error(w, "histogram query failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer rows.Close()
+
+		counts := map[string][]int{}
+		totals := map[string]int{}
+		for rows.Next() {
+			var index int64
+			var name string
+			var count int
+			if err := rows.Scan(&index, &name, &count); err != nil {
+				http.Error(w, "histogram query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if index < 0 || index >= int64(n) {
+				continue
+			}
+			if counts[name] == nil {
+				counts[name] = make([]int, n)
+			}
+			counts[name][index] += count
+			totals[name] += count
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "histogram query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result := histogram{
+			From:          from,
+			To:            to,
+			Bucket:        bucket.String(),
+			BucketSeconds: bucket.Seconds(),
+			Buckets:       make([]time.Time, n),
+			Series:        topSeries(counts, totals, series, n),
+		}
+		for i := range result.Buckets {
+			result.Buckets[i] = start.Add(time.Duration(i) * bucket)
+		}
+		for _, total := range totals {
+			result.Total += total
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// bucketParam returns the bucket size in the bucket query parameter, choosing
+// one for span if it is unset or auto.
+func bucketParam(r *http.Request, span time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get("bucket")
+	if value == "" || value == "auto" {
+		return autoBucket(span), nil
+	}
+	bucket, err := time.ParseDuration(value)
+	if err != nil || bucket < time.Second {
+		return 0, fmt.Errorf("invalid bucket param %q (expected auto or a duration of at least 1s)", value)
+	}
+	return bucket, nil
+}
+
+// autoBucket returns the smallest bucket size that splits span into no more
+// than targetBuckets buckets.
+func autoBucket(span time.Duration) time.Duration {
+	for _, size := range bucketSizes {
+		if span/size < targetBuckets {
+			return size
+		}
+	}
+	return bucketSizes[len(bucketSizes)-1]
+}
+
+// topSeries returns the limit largest series, most common first, with the
+// rest added together into one more.
+func topSeries(counts map[string][]int, totals map[string]int, limit, buckets int) []histogramSeries {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if totals[names[i]] != totals[names[j]] {
+			return totals[names[i]] > totals[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	result := []histogramSeries{}
+	for i, name := range names {
+		if i < limit {
+			result = append(result, histogramSeries{Name: name, Total: totals[name], Counts: counts[name]})
+			continue
+		}
+		if i == limit {
+			result = append(result, histogramSeries{Name: otherSeries, Counts: make([]int, buckets)})
+		}
+		other := &result[limit]
+		other.Total += totals[name]
+		for b, c := range counts[name] {
+			other.Counts[b] += c
+		}
+	}
+	return result
+}
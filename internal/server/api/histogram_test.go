@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+type histogramResponse struct {
+	Bucket        string   `json:"bucket"`
+	BucketSeconds float64  `json:"bucket_seconds"`
+	Buckets       []string `json:"buckets"`
+	Series        []struct {
+		Name   string `json:"name"`
+		Total  int    `json:"total"`
+		Counts []int  `json:"counts"`
+	} `json:"series"`
+	Total int `json:"total"`
+}
+
+func setupHistogram(t *testing.T) http.Handler {
+	t.Helper()
+	db, pipeline := setupPipeline(t, "json", "")
+	ctx := context.Background()
+
+	lines := []string{
+		`{"timestamp":"2025-01-01T10:00:05Z","level":"info","message":"a","service":"api"}`,
+		`{"timestamp":"2025-01-01T10:00:40Z","level":"error","message":"b","service":"api"}`,
+		`{"timestamp":"2025-01-01T10:02:10Z","level":"info","message":"c","service":"worker"}`,
+		`{"timestamp":"2025-01-01T10:03:59Z","level":"warn","message":"d"}`,
+		`{"timestamp":"2025-01-01T10:03:00Z","level":"info","message":"e","service":"api"}`,
+	}
+	for _, line := range lines {
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return api.HistogramHandler(db, ctx)
+}
+
+func TestHistogramHandler(t *testing.T) {
+	handler := setupHistogram(t)
+
+	var resp histogramResponse
+	if code := getJSON(t, handler, "/api/histogram?bucket=1m", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+
+	if resp.Bucket != "1m0s" || resp.BucketSeconds != 60 || resp.Total != 5 {
+		t.Errorf("Unexpected histogram %+v", resp)
+	}
+	if len(resp.Buckets) != 4 || resp.Buckets[0] != "2025-01-01T10:00:00Z" {
+		t.Errorf("Expected 4 buckets from 10:00, got %v", resp.Buckets)
+	}
+	if len(resp.Series) != 1 || !slices.Equal(resp.Series[0].Counts, []int{2, 0, 1, 2}) {
+		t.Errorf("Expected zero-filled counts, got %+v", resp.Series)
+	}
+}
+
+func TestHistogramHandler_GroupBy(t *testing.T) {
+	handler := setupHistogram(t)
+
+	var resp histogramResponse
+	code := getJSON(t, handler, "/api/histogram?bucket=1m&group_by=level", &resp)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Series) != 3 {
+		t.Fatalf("Expected 3 series, got %+v", resp.Series)
+	}
+	if info := resp.Series[0]; info.Name != "info" || info.Total != 3 || !slices.Equal(info.Counts, []int{1, 0, 1, 1}) {
+		t.Errorf("Unexpected info series %+v", info)
+	}
+
+	// JSON fields can be grouped by too, with missing values in their own
+	// series and the least common counted together.
+	code = getJSON(t, handler, "/api/histogram?bucket=1m&group_by=service&series=1", &resp)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Series) != 2 || resp.Series[0].Name != "api" || resp.Series[1].Name != "(other)" || resp.Series[1].Total != 2 {
+		t.Errorf("Unexpected series %+v", resp.Series)
+	}
+}
+
+func TestHistogramHandler_Filters(t *testing.T) {
+	handler := setupHistogram(t)
+
+	var resp histogramResponse
+	query := url.Values{
+		"filter": {"service:api"},
+		"where":  {"level != 'error'"},
+		"from":   {"2025-01-01T10:00:00Z"},
+		"to":     {"2025-01-01T11:00:00Z"},
+	}
+	if code := getJSON(t, handler, "/api/histogram?"+query.Encode(), &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Total != 2 {
+		t.Errorf("Expected 2 matching entries, got %d", resp.Total)
+	}
+	// An hour is split into buckets of about a minute automatically.
+	if resp.Bucket != "1m0s" || len(resp.Buckets) != 61 {
+		t.Errorf("Expected automatic 1m buckets, got %s with %d buckets", resp.Bucket, len(resp.Buckets))
+	}
+}
+
+func TestHistogramHandler_CountsWeightedLines(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	ctx := context.Background()
+
+	for _, line := range []string{
+		`{"timestamp":"2025-01-01T10:00:05Z","message":"sampled"}`,
+		`{"timestamp":"2025-01-01T10:00:10Z","message":"repeated"}`,
+		`{"timestamp":"2025-01-01T10:01:00Z","message":"once"}`,
+	} {
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE logs SET sample_weight = 3 WHERE message = 'sampled'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE logs SET repeat_count = 4 WHERE message = 'repeated'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp histogramResponse
+	if code := getJSON(t, api.HistogramHandler(db, ctx), "/api/histogram?bucket=1m", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Total != 8 || len(resp.Series) != 1 || !slices.Equal(resp.Series[0].Counts, []int{7, 1}) {
+		t.Errorf("Expected the lines the rows stand for to be counted, got %+v", resp)
+	}
+}
+
+func TestHistogramHandler_InvalidParams(t *testing.T) {
+	handler := setupHistogram(t)
+
+	for _, query := range []string{
+		"bucket=fast",
+		"bucket=1ms",
+		"bucket=1s&from=2020-01-01T00:00:00Z",
+		"group_by=" + url.QueryEscape("level; DROP TABLE logs"),
+		"filter=level:",
+		"where=" + url.QueryEscape("no_such_column = 1"),
+		"from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z",
+	} {
+		var resp histogramResponse
+		if code := getJSON(t, handler, "/api/histogram?"+query, &resp); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
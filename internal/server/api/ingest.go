@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+)
+
+const maxIngestBodySize = 64 << 20
+const maxIngestLineSize = 1 << 20
+const maxReportedErrors = 10
+
+type ingestResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+func (r *ingestResult) reject(line int, err error) {
+	r.Rejected++
+	if len(r.Errors) < maxReportedErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("record %d: %v", line, err))
+	}
+}
+
+func (r *ingestResult) record(line int, err error) {
+	if err != nil {
+		r.reject(line, err)
+		return
+	}
+	r.Accepted++
+}
+
+// IngestHandler accepts logs pushed over HTTP. Bodies may be NDJSON, a JSON
+// array of objects, or plain text lines parsed with the configured log format,
+// optionally gzip encoded.
+func IngestHandler(pipeline *ingest.Pipeline, ctx context.Context) http.HandlerFunc {
+	jsonPipeline := pipeline.WithLogFormat("json")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := requestBody(w, r)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		reader := bufio.NewReader(body)
+		var result ingestResult
+
+		switch bodyKind(r.Header.Get("Content-Type"), reader) {
+		case "array":
+			err = ingestJSONArray(reader, jsonPipeline, &result, ctx)
+		case "ndjson":
+			err = ingestLines(reader, &result, func(line string) error {
+				entry, err := decodeObject([]byte(line))
+				if err != nil {
+					return err
+				}
+				return jsonPipeline.ProcessParsed(line, entry, ctx)
+			})
+		default:
+			var text *ingest.Pipeline
+			if text, err = withCSVHeader(reader, pipeline); err == nil {
+				err = ingestLines(reader, &result, func(line string) error {
+					return text.Process(line, ctx)
+				})
+			}
+		}
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func requestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	body := http.MaxBytesReader(w, r.Body, maxIngestBodySize)
+
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return gz, nil
+	}
+	return body, nil
+}
+
+// bodyKind picks a decoder from the content type, sniffing the first
+// non-whitespace byte when the type is missing or generic.
+func bodyKind(contentType string, reader *bufio.Reader) string {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+
+	switch mediaType {
+	case "text/plain":
+		return "text"
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return "ndjson"
+	}
+
+	first := firstNonSpace(reader)
+	switch {
+	case first == '[':
+		return "array"
+	case first == '{' || mediaType == "application/json":
+		return "ndjson"
+	default:
+		return "text"
+	}
+}
+
+func firstNonSpace(reader *bufio.Reader) byte {
+	for n := 1; ; n++ {
+		peeked, err := reader.Peek(n)
+		if len(peeked) < n {
+			return 0
+		}
+		if c := peeked[n-1]; c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c
+		}
+		if err != nil {
+			return 0
+		}
+	}
+}
+
+// withCSVHeader reads the header row from the start of a CSV body, if the
+// pipeline expects one, returning a pipeline that uses it for the rest.
+func withCSVHeader(reader *bufio.Reader, pipeline *ingest.Pipeline) (*ingest.Pipeline, error) {
+	if !pipeline.ExpectsCSVHeader() {
+		return pipeline, nil
+	}
+	header, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if header = strings.TrimRight(header, "\r\n"); header == "" {
+		return pipeline, nil
+	}
+	return pipeline.WithCSVHeader(header)
+}
+
+func ingestLines(reader io.Reader, result *ingestResult, process func(string) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxIngestLineSize)
+
+	lineNo := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result.record(lineNo, process(line))
+	}
+	return scanner.Err()
+}
+
+func ingestJSONArray(reader io.Reader, pipeline *ingest.Pipeline, result *ingestResult, ctx context.Context) error {
+	var records []json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&records); err != nil {
+		return err
+	}
+
+	for i, raw := range records {
+		entry, err := decodeObject(raw)
+		if err != nil {
+			result.reject(i+1, err)
+			continue
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			result.reject(i+1, err)
+			continue
+		}
+		result.record(i+1, pipeline.ProcessParsed(compact.String(), entry, ctx))
+	}
+	return nil
+}
+
+func decodeObject(raw []byte) (shared.LogEntry, error) {
+	var entry shared.LogEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %w", err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return entry, nil
+}
+
+// IngestStatsHandler reports how many lines have been ingested, how many
+// failed to parse and why, and the most recent parse failures.
+func IngestStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingest.Snapshot())
+}
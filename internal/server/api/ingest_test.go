@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+type ingestResponse struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors"`
+}
+
+func setupPipeline(t *testing.T, logFormat, regex string) (*sql.DB, *ingest.Pipeline) {
+	t.Helper()
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	t.Cleanup(func() { db.Close() })
+
+	return db, ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), logFormat, regex, "", "", false, false)
+}
+
+func setupIngest(t *testing.T, logFormat, regex string) (*sql.DB, http.HandlerFunc) {
+	t.Helper()
+	db, pipeline := setupPipeline(t, logFormat, regex)
+	return db, api.IngestHandler(pipeline, context.Background())
+}
+
+func postIngest(t *testing.T, handler http.HandlerFunc, body []byte, headers map[string]string) ingestResponse {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/ingest", bytes.NewReader(body))
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ingestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	return resp
+}
+
+func countLogs(t *testing.T, db *sql.DB, where string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM logs WHERE ` + where).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestIngestHandler_NDJSON(t *testing.T) {
+	db, handler := setupIngest(t, "json", "")
+
+	body := `{"level":"info","message":"one"}
+{"level":"warn","message":"two"}
+
+not json
+`
+	resp := postIngest(t, handler, []byte(body), map[string]string{"Content-Type": "application/x-ndjson"})
+
+	if resp.Accepted != 2 || resp.Rejected != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected, got %+v", resp)
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0], "record 4") {
+		t.Errorf("Expected error for record 4, got %v", resp.Errors)
+	}
+	if n := countLogs(t, db, `message IN ('one', 'two') AND log_format = 'json'`); n != 2 {
+		t.Errorf("Expected 2 stored rows, got %d", n)
+	}
+}
+
+func TestIngestHandler_JSONArray(t *testing.T) {
+	db, handler := setupIngest(t, "text", "")
+
+	body := `[{"level":"error","message":"boom","trace_id":"arr1"}, 42]`
+	resp := postIngest(t, handler, []byte(body), map[string]string{"Content-Type": "application/json"})
+
+	if resp.Accepted != 1 || resp.Rejected != 1 {
+		t.Errorf("Expected 1 accepted and 1 rejected, got %+v", resp)
+	}
+	if n := countLogs(t, db, `trace_id = 'arr1' AND level = 'error'`); n != 1 {
+		t.Errorf("Expected stored row for arr1, got %d", n)
+	}
+}
+
+func TestIngestHandler_GzipPlainText(t *testing.T) {
+	db, handler := setupIngest(t, "text", `\[(?P<level>\w+)] (?P<message>.+)`)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("[WARN] disk almost full\n[INFO] all good\n"))
+	gz.Close()
+
+	resp := postIngest(t, handler, buf.Bytes(), map[string]string{
+		"Content-Type":     "text/plain",
+		"Content-Encoding": "gzip",
+	})
+
+	if resp.Accepted != 2 || resp.Rejected != 0 {
+		t.Errorf("Expected 2 accepted, got %+v", resp)
+	}
+	if n := countLogs(t, db, `level = 'WARN' AND message = 'disk almost full'`); n != 1 {
+		t.Errorf("Expected parsed text row, got %d", n)
+	}
+}
+
+func TestIngestHandler_CSVHeader(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	t.Cleanup(func() { db.Close() })
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "csv", "", "", "", true, false)
+	handler := api.IngestHandler(pipeline, ctx)
+
+	// stdin and each request have their own header row.
+	stdin := pipeline.Start(strings.NewReader("level,message\nwarn,from stdin\n"), ctx)
+	resp := postIngest(t, handler, []byte("message,level\nfrom http,error\n"), map[string]string{"Content-Type": "text/plain"})
+	<-stdin
+
+	if resp.Accepted != 1 || resp.Rejected != 0 {
+		t.Errorf("Expected 1 accepted, got %+v", resp)
+	}
+	if n := countLogs(t, db, `level = 'error' AND message = 'from http'`); n != 1 {
+		t.Errorf("Expected the HTTP row to use its own header, got %d", n)
+	}
+	if n := countLogs(t, db, `level = 'warn' AND message = 'from stdin'`); n != 1 {
+		t.Errorf("Expected the stdin row to use its own header, got %d", n)
+	}
+}
+
+func TestIngestHandler_MethodNotAllowed(t *testing.T) {
+	_, handler := setupIngest(t, "json", "")
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/ingest", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestIngestStatsHandler(t *testing.T) {
+	_, handler := setupIngest(t, "text", `^(?P<level>[A-Z]+) (?P<message>.+)$`)
+	postIngest(t, handler, []byte("INFO started\nnot matching\n"), map[string]string{"Content-Type": "text/plain"})
+
+	w := httptest.NewRecorder()
+	api.IngestStatsHandler(w, httptest.NewRequest("GET", "/api/ingest/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var stats ingest.Counters
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if stats.Lines < 2 || stats.ParseErrors["regex"] < 1 {
+		t.Errorf("Expected counted lines and a regex error, got %+v", stats)
+	}
+	if len(stats.Recent) == 0 || stats.Recent[0].RawLine != "not matching" || stats.Recent[0].Reason != "no match" {
+		t.Errorf("Expected the regex failure as the most recent error, got %+v", stats.Recent)
+	}
+}
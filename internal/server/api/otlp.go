@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/otlp"
+	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLPLogsHandler implements the OTLP/HTTP logs endpoint (/v1/logs) for both
+// the protobuf and JSON encodings of ExportLogsServiceRequest.
+func OTLPLogsHandler(pipeline *ingest.Pipeline, ctx context.Context) http.HandlerFunc {
+	otlpPipeline := pipeline.WithLogFormat("otlp")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mediaType := strings.TrimSpace(strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0])
+		var decode func([]byte) ([]shared.LogEntry, error)
+		switch mediaType {
+		case "application/x-protobuf", "application/protobuf":
+			decode = otlp.DecodeProtobuf
+		case "application/json":
+			decode = otlp.DecodeJSON
+		default:
+			http.Error(w, "Unsupported content type: "+mediaType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := requestBody(w, r)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := decode(data)
+		if err != nil {
+			http.Error(w, "Invalid ExportLogsServiceRequest: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var rejected int64
+		var lastErr error
+		for _, entry := range entries {
+			raw := string(shared.MustJson(entry))
+			if err := otlpPipeline.ProcessParsed(raw, entry, ctx); err != nil {
+				rejected++
+				lastErr = err
+			}
+		}
+
+		writeOTLPResponse(w, mediaType, rejected, lastErr)
+	}
+}
+
+// writeOTLPResponse replies with an ExportLogsServiceResponse, reporting a
+// partial success when some records could not be stored.
+func writeOTLPResponse(w http.ResponseWriter, mediaType string, rejected int64, lastErr error) {
+	errMsg := ""
+	if lastErr != nil {
+		errMsg = fmt.Sprintf("failed to store %d log records: %v", rejected, lastErr)
+	}
+
+	if mediaType == "application/json" {
+		resp := map[string]any{}
+		if rejected > 0 {
+			resp["partialSuccess"] = map[string]any{
+				"rejectedLogRecords": strconv.FormatInt(rejected, 10),
+				"errorMessage":       errMsg,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	var out []byte
+	if rejected > 0 {
+		var partial []byte
+		partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+		partial = protowire.AppendVarint(partial, uint64(rejected))
+		partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+		partial = protowire.AppendString(partial, errMsg)
+
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, partial)
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
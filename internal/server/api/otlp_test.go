@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+func TestOTLPLogsHandler_JSON(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	handler := api.OTLPLogsHandler(pipeline, context.Background())
+
+	body := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[
+		{"severityText":"ERROR","body":{"stringValue":"db timeout"},"traceId":"0af7651916cd43dd8448eb211c80319c"}
+	]}]}]}`
+	r := httptest.NewRequest("POST", "/v1/logs", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Errorf("Expected empty response, got %s", w.Body.String())
+	}
+	where := `trace_id = '0af7651916cd43dd8448eb211c80319c' AND level = 'error' AND message = 'db timeout' AND log_format = 'otlp'`
+	if n := countLogs(t, db, where); n != 1 {
+		t.Errorf("Expected OTLP record to be stored, got %d", n)
+	}
+}
+
+func TestOTLPLogsHandler_UnsupportedContentType(t *testing.T) {
+	_, pipeline := setupPipeline(t, "json", "")
+
+	r := httptest.NewRequest("POST", "/v1/logs", strings.NewReader("hello"))
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	api.OTLPLogsHandler(pipeline, context.Background())(w, r)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", w.Code)
+	}
+}
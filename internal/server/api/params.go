@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+)
+
+// timeParam returns the RFC3339 time in the named query parameter, and
+// whether it was set.
+func timeParam(r *http.Request, name string) (time.Time, bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s param: %v", name, err)
+	}
+	return t.UTC(), true, nil
+}
+
+// timeRange returns SQL conditions on column for the optional RFC3339 from
+// and to query parameters, with their arguments.
+func timeRange(r *http.Request, column string) ([]string, []any, error) {
+	var where []string
+	var args []any
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+		t, ok, err := timeParam(r, bound.param)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			where = append(where, column+" "+bound.op+" ?")
+			args = append(args, t)
+		}
+	}
+	return where, args, nil
+}
+
+// limitParam returns the limit query parameter, or def if it is not set.
+// Limits above max are lowered to max.
+func limitParam(r *http.Request, def, max int) (int, error) {
+	return intParam(r, "limit", def, max)
+}
+
+// intParam returns the named positive integer query parameter, or def if it
+// is not set. Values above max are lowered to max.
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s param", name)
+	}
+	return min(n, max), nil
+}
+
+// filterParams returns SQL conditions for the filter query parameters, which
+// use the filter syntax, such as level:error status>=500, with their
+// arguments.
+func filterParams(r *http.Request) ([]string, []any, error) {
+	var where []string
+	var args []any
+	for _, value := range r.URL.Query()["filter"] {
+		condition, filterArgs, err := filter.Compile(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid filter: %v", err)
+		}
+		where = append(where, condition)
+		args = append(args, filterArgs...)
+	}
+	return where, args, nil
+}
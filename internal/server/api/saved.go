@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/saved"
+)
+
+// SavedQueriesHandler lists saved queries and creates new ones.
+func SavedQueriesHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			queries, err := store.ListQueries(ctx)
+			if err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"queries": queries})
+		case http.MethodPost:
+			var q saved.Query
+			if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			q, err := store.CreateQuery(q, ctx)
+			if err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(q)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// SavedQueryHandler gets, replaces or deletes the saved query in the path.
+func SavedQueryHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var q saved.Query
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			q, err = store.GetQuery(id, ctx)
+		case http.MethodPut:
+			if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			q.ID = id
+			q, err = store.UpdateQuery(q, ctx)
+		case http.MethodDelete:
+			if err := store.DeleteQuery(id, ctx); err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			writeSavedError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+// DashboardsHandler lists dashboards and creates new ones.
+func DashboardsHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			dashboards, err := store.ListDashboards(ctx)
+			if err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"dashboards": dashboards})
+		case http.MethodPost:
+			var d saved.Dashboard
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			d, err := store.CreateDashboard(d, ctx)
+			if err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(d)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// DashboardHandler gets, replaces or deletes the dashboard in the path.
+func DashboardHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var d saved.Dashboard
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			d, err = store.GetDashboard(id, ctx)
+		case http.MethodPut:
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			d.ID = id
+			d, err = store.UpdateDashboard(d, ctx)
+		case http.MethodDelete:
+			if err := store.DeleteDashboard(id, ctx); err != nil {
+				writeSavedError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			writeSavedError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// ExportSavedHandler downloads every saved query and dashboard as a file
+// that ImportSavedHandler accepts.
+func ExportSavedHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		bundle, err := store.Export(ctx)
+		if err != nil {
+			writeSavedError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="magic-log-saved.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(bundle)
+	}
+}
+
+// ImportSavedHandler saves the queries and dashboards in an exported file,
+// replacing those with the same ids.
+func ImportSavedHandler(store *saved.Store, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var bundle saved.Bundle
+		if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := store.Import(bundle, ctx); err != nil {
+			writeSavedError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{
+			"queries":    len(bundle.Queries),
+			"dashboards": len(bundle.Dashboards),
+		})
+	}
+}
+
+// writeSavedError responds with the status for an error from saved.Store,
+// listing every problem when the input was invalid, as /api/config does.
+func writeSavedError(w http.ResponseWriter, err error) {
+	var invalid *saved.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]string{
+			"errors": errorStrings(invalid.Errs),
+		})
+	case errors.Is(err, saved.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, saved.ErrInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
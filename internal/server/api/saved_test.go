@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/saved"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+func setupSaved(t *testing.T) *http.ServeMux {
+	t.Helper()
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	t.Cleanup(func() { db.Close() })
+	store := saved.NewStore(db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/saved-queries", api.SavedQueriesHandler(store, ctx))
+	mux.HandleFunc("/api/saved-queries/{id}", api.SavedQueryHandler(store, ctx))
+	mux.HandleFunc("/api/dashboards", api.DashboardsHandler(store, ctx))
+	mux.HandleFunc("/api/dashboards/{id}", api.DashboardHandler(store, ctx))
+	mux.HandleFunc("/api/saved/export", api.ExportSavedHandler(store, ctx))
+	mux.HandleFunc("/api/saved/import", api.ImportSavedHandler(store, ctx))
+	return mux
+}
+
+func send(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestSavedQueriesHandler(t *testing.T) {
+	mux := setupSaved(t)
+
+	w := send(t, mux, "POST", "/api/saved-queries", `{"name":"Errors","filter":"level:error","time_range":{"last":"1h"},"visualization":"line"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var q saved.Query
+	json.Unmarshal(w.Body.Bytes(), &q)
+
+	w = send(t, mux, "PUT", "/api/saved-queries/"+q.ID, `{"name":"All errors","filter":"level:error"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var list struct {
+		Queries []saved.Query `json:"queries"`
+	}
+	if code := getJSON(t, mux, "/api/saved-queries", &list); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(list.Queries) != 1 || list.Queries[0].Name != "All errors" || list.Queries[0].Visualization != "table" {
+		t.Errorf("Unexpected queries %+v", list.Queries)
+	}
+
+	w = send(t, mux, "DELETE", "/api/saved-queries/"+q.ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if code := getJSON(t, mux, "/api/saved-queries/"+q.ID, &q); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+}
+
+func TestSavedQueriesHandler_Invalid(t *testing.T) {
+	mux := setupSaved(t)
+
+	w := send(t, mux, "POST", "/api/saved-queries", `{"name":"","time_range":{"last":"-1h"}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Errors) != 3 {
+		t.Errorf("Expected every problem to be listed, got %v", resp.Errors)
+	}
+
+	if w := send(t, mux, "PUT", "/api/saved-queries/missing", `{"name":"x","sql":"SELECT 1"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestDashboardsHandler(t *testing.T) {
+	mux := setupSaved(t)
+
+	var q saved.Query
+	w := send(t, mux, "POST", "/api/saved-queries", `{"name":"Errors","filter":"level:error"}`)
+	json.Unmarshal(w.Body.Bytes(), &q)
+
+	w = send(t, mux, "POST", "/api/dashboards", `{"name":"Overview","panels":[{"query_id":"`+q.ID+`","x":0,"y":0,"w":6,"h":4}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var d saved.Dashboard
+	json.Unmarshal(w.Body.Bytes(), &d)
+
+	if code := getJSON(t, mux, "/api/dashboards/"+d.ID, &d); code != http.StatusOK || len(d.Panels) != 1 {
+		t.Errorf("Unexpected dashboard %d %+v", code, d)
+	}
+
+	// The query cannot be deleted while the dashboard shows it.
+	if w := send(t, mux, "DELETE", "/api/saved-queries/"+q.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409, got %d", w.Code)
+	}
+}
+
+func TestExportImportSavedHandlers(t *testing.T) {
+	source := setupSaved(t)
+	var q saved.Query
+	w := send(t, source, "POST", "/api/saved-queries", `{"name":"Errors","filter":"level:error"}`)
+	json.Unmarshal(w.Body.Bytes(), &q)
+	send(t, source, "POST", "/api/dashboards", `{"name":"Overview","panels":[{"query_id":"`+q.ID+`","w":12,"h":4}]}`)
+
+	w = send(t, source, "GET", "/api/saved/export", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Expected a file download, got %d %v", w.Code, w.Header())
+	}
+
+	target := setupSaved(t)
+	w = send(t, target, "POST", "/api/saved/import", w.Body.String())
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"dashboards":1,"queries":1}` {
+		t.Fatalf("Unexpected import response %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := send(t, target, "POST", "/api/saved/import", `{"version":2}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown version, got %d", w.Code)
+	}
+}
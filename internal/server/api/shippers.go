@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/loki"
+)
+
+var bulkActions = []string{"index", "create", "update", "delete"}
+
+type bulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type bulkItem struct {
+	Index  string     `json:"_index,omitempty"`
+	ID     string     `json:"_id"`
+	Status int        `json:"status"`
+	Result string     `json:"result,omitempty"`
+	Error  *bulkError `json:"error,omitempty"`
+}
+
+// ElasticBulkHandler implements enough of the Elasticsearch _bulk API for log
+// shippers such as Fluent Bit and Vector. Each indexed document is stored as a
+// log entry; deletes are acknowledged but ignored.
+func ElasticBulkHandler(pipeline *ingest.Pipeline, ctx context.Context) http.HandlerFunc {
+	esPipeline := pipeline.WithLogFormat("elasticsearch")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := requestBody(w, r)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		start := time.Now()
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxIngestLineSize)
+
+		items := []map[string]bulkItem{}
+		hasErrors := false
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			action, meta, err := parseBulkAction(line)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if meta.Index == "" {
+				meta.Index = bulkPathIndex(r.URL.Path)
+			}
+			if meta.ID == "" {
+				meta.ID = uuid.New().String()
+			}
+
+			if action == "delete" {
+				items = append(items, map[string]bulkItem{action: {Index: meta.Index, ID: meta.ID, Status: http.StatusOK, Result: "noop"}})
+				continue
+			}
+
+			// Earlier documents are already stored, so a truncated body fails
+			// only its last item rather than the whole request.
+			item := bulkItem{Index: meta.Index, ID: meta.ID, Status: http.StatusCreated, Result: "created"}
+			if !scanner.Scan() {
+				hasErrors = true
+				item.Status = http.StatusBadRequest
+				item.Result = ""
+				item.Error = &bulkError{Type: "illegal_argument_exception", Reason: "missing source for " + action + " action"}
+				items = append(items, map[string]bulkItem{action: item})
+				break
+			}
+			source := scanner.Text()
+
+			if err := storeBulkDocument(esPipeline, action, meta.Index, source, ctx); err != nil {
+				hasErrors = true
+				item.Status = http.StatusBadRequest
+				item.Result = ""
+				item.Error = &bulkError{Type: "mapper_parsing_exception", Reason: err.Error()}
+			}
+			items = append(items, map[string]bulkItem{action: item})
+		}
+		if err := scanner.Err(); err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"took":   time.Since(start).Milliseconds(),
+			"errors": hasErrors,
+			"items":  items,
+		})
+	}
+}
+
+// bulkPathIndex returns the default index from a /<index>/_bulk path.
+func bulkPathIndex(path string) string {
+	return strings.Trim(strings.TrimSuffix(path, "_bulk"), "/")
+}
+
+func parseBulkAction(line string) (string, bulkItem, error) {
+	var action map[string]bulkItem
+	if err := json.Unmarshal([]byte(line), &action); err != nil {
+		return "", bulkItem{}, fmt.Errorf("malformed action/metadata line: %v", err)
+	}
+	for _, name := range bulkActions {
+		if meta, ok := action[name]; ok && len(action) == 1 {
+			return name, meta, nil
+		}
+	}
+	return "", bulkItem{}, fmt.Errorf("malformed action/metadata line: expected one of %v", bulkActions)
+}
+
+func storeBulkDocument(pipeline *ingest.Pipeline, action, index, source string, ctx context.Context) error {
+	entry, err := decodeObject([]byte(source))
+	if err != nil {
+		return err
+	}
+
+	// Updates carry the document under "doc" (or "upsert" for new ids).
+	if action == "update" {
+		doc, ok := entry["doc"].(map[string]any)
+		if !ok {
+			doc, ok = entry["upsert"].(map[string]any)
+		}
+		if !ok {
+			return fmt.Errorf("update action requires a doc")
+		}
+		entry = doc
+	}
+
+	if _, ok := entry["timestamp"]; !ok {
+		if ts, ok := entry["@timestamp"]; ok {
+			entry["timestamp"] = ts
+		}
+	}
+	if _, ok := entry["message"]; !ok {
+		if msg, ok := entry["log"].(string); ok {
+			entry["message"] = strings.TrimRight(msg, "\n")
+		}
+	}
+	if index != "" {
+		entry["_index"] = index
+	}
+
+	return pipeline.ProcessParsed(source, entry, ctx)
+}
+
+// ElasticClusterHealthHandler answers the health checks some shippers perform
+// before sending.
+func ElasticClusterHealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"cluster_name": "magic-log",
+		"status":       "green",
+	})
+}
+
+// LokiPushHandler implements the Loki push API. JSON bodies (optionally gzip
+// encoded) and snappy compressed protobuf bodies are accepted. Stream labels
+// are stored as fields on each entry.
+func LokiPushHandler(pipeline *ingest.Pipeline, ctx context.Context) http.HandlerFunc {
+	lokiPipeline := pipeline.WithLogFormat("loki")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mediaType := strings.TrimSpace(strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0])
+		var decode func([]byte) ([]loki.Entry, error)
+		switch mediaType {
+		case "application/json":
+			decode = loki.DecodeJSON
+		case "application/x-protobuf", "":
+			decode = loki.DecodeProtobuf
+		default:
+			http.Error(w, "Unsupported content type: "+mediaType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := requestBody(w, r)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := decode(data)
+		if err != nil {
+			http.Error(w, "Invalid push request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var failed []string
+		for _, e := range entries {
+			if err := lokiPipeline.ProcessParsed(e.Line, e.Fields, ctx); err != nil {
+				failed = append(failed, err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			http.Error(w, fmt.Sprintf("failed to store %d entries: %s", len(failed), failed[0]), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
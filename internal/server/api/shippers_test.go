@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+func TestElasticBulkHandler(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	handler := api.ElasticBulkHandler(pipeline, context.Background())
+
+	body := `{"index":{"_id":"1"}}
+{"@timestamp":"2024-01-01T00:00:00.123Z","log":"container started\n","level":"info"}
+{"create":{"_index":"other"}}
+{"message":"created doc","level":"warn"}
+{"delete":{"_id":"1"}}
+{"index":{}}
+not json
+`
+	r := httptest.NewRequest("POST", "/fluent-bit/_bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Errors bool                        `json:"errors"`
+		Items  []map[string]map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if !resp.Errors || len(resp.Items) != 4 {
+		t.Fatalf("Expected 4 items with errors, got %s", w.Body.String())
+	}
+	if resp.Items[0]["index"]["status"] != float64(201) || resp.Items[0]["index"]["_index"] != "fluent-bit" {
+		t.Errorf("Unexpected first item: %v", resp.Items[0])
+	}
+	if resp.Items[3]["index"]["status"] != float64(400) {
+		t.Errorf("Expected invalid document to fail, got %v", resp.Items[3])
+	}
+
+	where := `message = 'container started' AND timestamp = TIMESTAMP '2024-01-01 00:00:00.123' AND json_extract_string(log, '$._index') = 'fluent-bit' AND log_format = 'elasticsearch'`
+	if n := countLogs(t, db, where); n != 1 {
+		t.Errorf("Expected stored fluent-bit document, got %d", n)
+	}
+	if n := countLogs(t, db, `message = 'created doc' AND json_extract_string(log, '$._index') = 'other'`); n != 1 {
+		t.Errorf("Expected stored created document, got %d", n)
+	}
+}
+
+func TestElasticBulkHandler_MissingSource(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	handler := api.ElasticBulkHandler(pipeline, context.Background())
+
+	body := `{"index":{}}
+{"message":"stored"}
+{"index":{}}
+`
+	r := httptest.NewRequest("POST", "/_bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Errors bool                        `json:"errors"`
+		Items  []map[string]map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if !resp.Errors || len(resp.Items) != 2 || resp.Items[0]["index"]["status"] != float64(201) || resp.Items[1]["index"]["status"] != float64(400) {
+		t.Errorf("Expected only the last item to fail, got %s", w.Body.String())
+	}
+	if n := countLogs(t, db, `message = 'stored'`); n != 1 {
+		t.Errorf("Expected the first document to be stored, got %d", n)
+	}
+}
+
+func TestLokiPushHandler_JSON(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	handler := api.LokiPushHandler(pipeline, context.Background())
+
+	body := `{"streams":[{"stream":{"service":"checkout","level":"error"},"values":[["1700000000000000000","payment declined"]]}]}`
+	r := httptest.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	where := `message = 'payment declined' AND level = 'error' AND json_extract_string(log, '$.service') = 'checkout' AND log_format = 'loki'`
+	if n := countLogs(t, db, where); n != 1 {
+		t.Errorf("Expected stored loki entry, got %d", n)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultTemplatesLimit = 100
+const maxTemplatesLimit = 1000
+const templateSamples = 3
+
+type templateSummary struct {
+	ID       string `json:"template_id"`
+	Template string `json:"template"`
+	// Count is the number of rows stored for the template, and Lines the
+	// number of lines they stand for once sampling and repeats are counted.
+	Count     int       `json:"count"`
+	Lines     int       `json:"lines"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Samples   []string  `json:"samples"`
+}
+
+// TemplatesHandler lists the message templates seen between the optional
+// RFC3339 from and to parameters, most common first, with a few recent lines
+// for each. Each template is listed with its current text.
+func TemplatesHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		where, args, err := timeRange(r, "created_at")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		where = append(where, "template_id IS NOT NULL")
+
+		limit, err := limitParam(r, defaultTemplatesLimit, maxTemplatesLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = append(args, limit)
+
+		query := fmt.Sprintf(`
+			SELECT
+				template_id,
+				coalesce(any_value(t.template), arg_max(logs.template, created_at)),
+				count(*),
+				sum(coalesce(sample_weight, 1) * coalesce(repeat_count, 1)),
+				min(coalesce(first_seen, timestamp)),
+				max(coalesce(last_seen, timestamp)),
+				list(raw_log ORDER BY timestamp DESC)[1:%d]
+			FROM logs LEFT JOIN templates t ON t.id = logs.template_id
+			WHERE %s
+			GROUP BY template_id
+			ORDER BY count(*) DESC, template_id
+			LIMIT ?
+		`, templateSamples, strings.Join(where, " AND "))
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			http.Error(w, "templates query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		templates := []templateSummary{}
+		for rows.Next() {
+			var t templateSummary
+			var samples []any
+			if err := rows.Scan(&t.ID, &t.Template, &t.Count, &t.Lines, &t.FirstSeen, &t.LastSeen, &samples); err != nil {
+				http.Error(w, "templates query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, s := range samples {
+				if s, ok := s.(string); ok {
+					t.Samples = append(t.Samples, s)
+				}
+			}
+			templates = append(templates, t)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "templates query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"templates": templates})
+	}
+}
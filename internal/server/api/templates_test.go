@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
+)
+
+type templatesResponse struct {
+	Templates []struct {
+		ID       string   `json:"template_id"`
+		Template string   `json:"template"`
+		Count    int      `json:"count"`
+		Lines    int      `json:"lines"`
+		Samples  []string `json:"samples"`
+	} `json:"templates"`
+}
+
+func getTemplates(t *testing.T, handler http.HandlerFunc, query string) (int, templatesResponse) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/api/templates?"+query, nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp templatesResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestTemplatesHandler(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	pipeline = pipeline.WithTemplates(templates.NewMiner())
+	ctx := context.Background()
+
+	for i := range 5 {
+		line := fmt.Sprintf(`{"message":"connected to db-%d in %dms"}`, i, i*10)
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pipeline.Process(`{"message":"cache warmed"}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := api.TemplatesHandler(db, ctx)
+	code, resp := getTemplates(t, handler, "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Templates) != 2 {
+		t.Fatalf("Expected 2 templates, got %+v", resp.Templates)
+	}
+
+	top := resp.Templates[0]
+	if top.Template != "connected to <*> in <*>" || top.Count != 5 || top.Lines != 5 {
+		t.Errorf("Unexpected top template %+v", top)
+	}
+	if len(top.Samples) != 3 {
+		t.Errorf("Expected 3 samples, got %v", top.Samples)
+	}
+
+	code, resp = getTemplates(t, handler, "limit=1")
+	if code != http.StatusOK || len(resp.Templates) != 1 {
+		t.Errorf("Expected 1 template with a limit, got %d %+v", code, resp.Templates)
+	}
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	code, resp = getTemplates(t, handler, "from="+future)
+	if code != http.StatusOK || len(resp.Templates) != 0 {
+		t.Errorf("Expected no templates after from, got %d %+v", code, resp.Templates)
+	}
+}
+
+func TestTemplatesHandler_CurrentText(t *testing.T) {
+	db, pipeline := setupPipeline(t, "json", "")
+	miner := templates.NewMiner()
+	pipeline = pipeline.WithTemplates(miner)
+	ctx := context.Background()
+
+	writer, err := ingest.NewTemplateWriter(db, miner, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pipeline.Process(`{"message":"user alice logged in from web"}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Rows are timestamped to the microsecond.
+	time.Sleep(2 * time.Millisecond)
+	before := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if err := pipeline.Process(`{"message":"user bob logged in from mobile"}`, ctx); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	// Only the first row is in range, but it is listed under the template it
+	// has since become part of.
+	handler := api.TemplatesHandler(db, ctx)
+	code, resp := getTemplates(t, handler, "to="+url.QueryEscape(before.Format(time.RFC3339Nano)))
+	if code != http.StatusOK || len(resp.Templates) != 1 {
+		t.Fatalf("Expected 1 template, got %d %+v", code, resp.Templates)
+	}
+	if tmpl := resp.Templates[0].Template; tmpl != "user <*> logged in from <*>" {
+		t.Errorf("Expected the current template, got %q", tmpl)
+	}
+
+	condition, args, err := filter.Compile(`template="user <*> logged in from <*>"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM logs WHERE `+condition, args...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected the filter to match both rows by their current template, got %d", count)
+	}
+}
+
+func TestTemplatesHandler_InvalidParams(t *testing.T) {
+	db, _ := setupPipeline(t, "json", "")
+	handler := api.TemplatesHandler(db, context.Background())
+
+	for _, query := range []string{"from=yesterday", "to=2024-01-01", "limit=none"} {
+		if code, _ := getTemplates(t, handler, query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
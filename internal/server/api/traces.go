@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultTracesLimit = 50
+const maxTracesLimit = 1000
+
+// maxTraceEntries bounds the entries returned for a single trace.
+const maxTraceEntries = 10000
+
+// levelRank orders levels by severity so the worst level in a trace can be
+// found. Unknown levels rank with info.
+const levelRank = `CASE lower(level)
+	WHEN 'trace' THEN 0
+	WHEN 'debug' THEN 1
+	WHEN 'notice' THEN 3
+	WHEN 'warn' THEN 4 WHEN 'warning' THEN 4
+	WHEN 'error' THEN 5 WHEN 'err' THEN 5
+	WHEN 'critical' THEN 6 WHEN 'crit' THEN 6 WHEN 'fatal' THEN 6 WHEN 'panic' THEN 6
+	WHEN 'alert' THEN 7
+	WHEN 'emergency' THEN 8 WHEN 'emerg' THEN 8
+	ELSE 2 END`
+
+type traceSummary struct {
+	TraceID    string    `json:"trace_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs float64   `json:"duration_ms"`
+	Entries    int       `json:"entries"`
+	MaxLevel   string    `json:"max_level"`
+	// Message is the first message in the trace.
+	Message string `json:"message"`
+}
+
+type traceEntry struct {
+	ID           string          `json:"id"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Level        string          `json:"level"`
+	Message      string          `json:"message"`
+	SpanID       string          `json:"span_id,omitempty"`
+	ParentSpanID string          `json:"parent_span_id,omitempty"`
+	Log          json.RawMessage `json:"log"`
+	// OffsetMs is the time since the first entry in the trace, and DeltaMs
+	// the time since the previous one.
+	OffsetMs float64 `json:"offset_ms"`
+	DeltaMs  float64 `json:"delta_ms"`
+}
+
+type traceSpan struct {
+	SpanID       string    `json:"span_id"`
+	ParentSpanID string    `json:"parent_span_id,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	DurationMs   float64   `json:"duration_ms"`
+	Entries      int       `json:"entries"`
+	// Depth is the number of ancestors the span has in the trace.
+	Depth int `json:"depth"`
+}
+
+type traceDetail struct {
+	TraceID    string       `json:"trace_id"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	DurationMs float64      `json:"duration_ms"`
+	MaxLevel   string       `json:"max_level"`
+	Spans      []traceSpan  `json:"spans"`
+	Entries    []traceEntry `json:"entries"`
+}
+
+// TracesHandler lists the most recent traces between the optional RFC3339
+// from and to parameters, with their duration, number of entries and most
+// severe level.
+func TracesHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		where, args, err := timeRange(r, "created_at")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		where = append(where, "trace_id IS NOT NULL", "trace_id != ''")
+
+		limit, err := limitParam(r, defaultTracesLimit, maxTracesLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = append(args, limit)
+
+		query := fmt.Sprintf(`
+			SELECT
+				trace_id,
+				min(timestamp),
+				max(timestamp),
+				count(*),
+				arg_max(level, %s),
+				arg_min(message, timestamp)
+			FROM logs
+			WHERE %s
+			GROUP BY trace_id
+			ORDER BY max(timestamp) DESC, trace_id
+			LIMIT ?
+		`, levelRank, strings.Join(where, " AND "))
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			http.Error(w, "traces query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		traces := []traceSummary{}
+		for rows.Next() {
+			var t traceSummary
+			var level, message sql.NullString
+			if err := rows.Scan(&t.TraceID, &t.Start, &t.End, &t.Entries, &level, &message); err != nil {
+				http.Error(w, "traces query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			t.MaxLevel, t.Message = level.String, message.String
+			t.DurationMs = milliseconds(t.End.Sub(t.Start))
+			traces = append(traces, t)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "traces query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"traces": traces})
+	}
+}
+
+// TraceHandler returns every entry in the trace named by the trace_id path
+// value, in order, with the time between them. Entries with span_id and
+// parent_span_id fields are also grouped into spans.
+func TraceHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		traceID := r.PathValue("trace_id")
+		if traceID == "" {
+			http.Error(w, "missing trace id", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT
+				%s,
+				id::TEXT,
+				timestamp,
+				level,
+				message,
+				coalesce(json_extract_string(log, '$.span_id'), ''),
+				coalesce(json_extract_string(log, '$.parent_span_id'), ''),
+				coalesce(log::TEXT, 'null')
+			FROM logs
+			WHERE trace_id = ?
+			ORDER BY timestamp, created_at
+			LIMIT ?
+		`, levelRank), traceID, maxTraceEntries)
+		if err != nil {
+			http.Error(w, "trace query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		detail := traceDetail{TraceID: traceID, Entries: []traceEntry{}}
+		maxRank := -1
+		for rows.Next() {
+			var e traceEntry
+			var level, message sql.NullString
+			var logJSON string
+			var rank int
+			if err := rows.Scan(&rank, &e.ID, &e.Timestamp, &level, &message, &e.SpanID, &e.ParentSpanID, &logJSON); err != nil {
+				http.Error(w, "trace query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			e.Level, e.Message, e.Log = level.String, message.String, json.RawMessage(logJSON)
+
+			if len(detail.Entries) == 0 {
+				detail.Start = e.Timestamp
+			} else {
+				e.DeltaMs = milliseconds(e.Timestamp.Sub(detail.End))
+			}
+			e.OffsetMs = milliseconds(e.Timestamp.Sub(detail.Start))
+			detail.End = e.Timestamp
+			if rank > maxRank {
+				detail.MaxLevel, maxRank = e.Level, rank
+			}
+			detail.Entries = append(detail.Entries, e)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "trace query failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(detail.Entries) == 0 {
+			http.Error(w, "trace not found", http.StatusNotFound)
+			return
+		}
+
+		detail.DurationMs = milliseconds(detail.End.Sub(detail.Start))
+		detail.Spans = spans(detail.Entries)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// spans groups entries by span_id, returning the spans in the order they
+// started, each after its parent.
+func spans(entries []traceEntry) []traceSpan {
+	byID := map[string]*traceSpan{}
+	var order []string
+	for _, e := range entries {
+		if e.SpanID == "" {
+			continue
+		}
+		s, ok := byID[e.SpanID]
+		if !ok {
+			s = &traceSpan{SpanID: e.SpanID, Start: e.Timestamp}
+			byID[e.SpanID] = s
+			order = append(order, e.SpanID)
+		}
+		if s.ParentSpanID == "" && e.ParentSpanID != e.SpanID {
+			s.ParentSpanID = e.ParentSpanID
+		}
+		s.End = e.Timestamp
+		s.Entries++
+	}
+
+	children := map[string][]string{}
+	var roots []string
+	for _, id := range order {
+		s := byID[id]
+		s.DurationMs = milliseconds(s.End.Sub(s.Start))
+		if _, ok := byID[s.ParentSpanID]; ok {
+			children[s.ParentSpanID] = append(children[s.ParentSpanID], id)
+		} else {
+			// Parents that logged nothing are not known, so their children
+			// are shown at the top level.
+			roots = append(roots, id)
+		}
+	}
+
+	result := []traceSpan{}
+	seen := map[string]bool{}
+	var visit func(id string, depth int)
+	visit = func(id string, depth int) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		s := byID[id]
+		s.Depth = depth
+		result = append(result, *s)
+		for _, child := range children[id] {
+			visit(child, depth+1)
+		}
+	}
+	for _, id := range roots {
+		visit(id, 0)
+	}
+	// Spans in a cycle of parents have no root to be reached from.
+	for _, id := range order {
+		visit(id, 0)
+	}
+	return result
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
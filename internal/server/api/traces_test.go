@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
+)
+
+type traceResponse struct {
+	TraceID    string  `json:"trace_id"`
+	DurationMs float64 `json:"duration_ms"`
+	MaxLevel   string  `json:"max_level"`
+	Spans      []struct {
+		SpanID       string  `json:"span_id"`
+		ParentSpanID string  `json:"parent_span_id"`
+		DurationMs   float64 `json:"duration_ms"`
+		Entries      int     `json:"entries"`
+		Depth        int     `json:"depth"`
+	} `json:"spans"`
+	Entries []struct {
+		Message  string  `json:"message"`
+		OffsetMs float64 `json:"offset_ms"`
+		DeltaMs  float64 `json:"delta_ms"`
+	} `json:"entries"`
+}
+
+type tracesResponse struct {
+	Traces []struct {
+		TraceID    string  `json:"trace_id"`
+		DurationMs float64 `json:"duration_ms"`
+		Entries    int     `json:"entries"`
+		MaxLevel   string  `json:"max_level"`
+		Message    string  `json:"message"`
+	} `json:"traces"`
+}
+
+func setupTraces(t *testing.T) *http.ServeMux {
+	t.Helper()
+	db, pipeline := setupPipeline(t, "json", "")
+	ctx := context.Background()
+
+	lines := []string{
+		`{"trace_id":"t1","span_id":"a","timestamp":"2025-01-01T10:00:00Z","level":"info","message":"request started"}`,
+		`{"trace_id":"t1","span_id":"b","parent_span_id":"a","timestamp":"2025-01-01T10:00:00.250Z","level":"debug","message":"query"}`,
+		`{"trace_id":"t1","span_id":"b","parent_span_id":"a","timestamp":"2025-01-01T10:00:00.500Z","level":"error","message":"query failed"}`,
+		`{"trace_id":"t1","span_id":"a","timestamp":"2025-01-01T10:00:01Z","level":"warn","message":"request finished"}`,
+		`{"trace_id":"t2","timestamp":"2025-01-01T11:00:00Z","level":"info","message":"health check"}`,
+		`{"timestamp":"2025-01-01T12:00:00Z","level":"info","message":"no trace"}`,
+	}
+	for _, line := range lines {
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/traces", api.TracesHandler(db, ctx))
+	mux.HandleFunc("/api/traces/{trace_id}", api.TraceHandler(db, ctx))
+	return mux
+}
+
+func getJSON(t *testing.T, handler http.Handler, path string, v any) int {
+	t.Helper()
+	r := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+	}
+	return w.Code
+}
+
+func TestTracesHandler(t *testing.T) {
+	mux := setupTraces(t)
+
+	var resp tracesResponse
+	if code := getJSON(t, mux, "/api/traces", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Traces) != 2 {
+		t.Fatalf("Expected 2 traces, got %+v", resp.Traces)
+	}
+
+	// Most recent first.
+	if resp.Traces[0].TraceID != "t2" {
+		t.Errorf("Expected t2 first, got %+v", resp.Traces)
+	}
+	t1 := resp.Traces[1]
+	if t1.Entries != 4 || t1.DurationMs != 1000 || t1.MaxLevel != "error" || t1.Message != "request started" {
+		t.Errorf("Unexpected summary %+v", t1)
+	}
+
+	if code := getJSON(t, mux, "/api/traces?limit=1", &resp); code != http.StatusOK || len(resp.Traces) != 1 {
+		t.Errorf("Expected 1 trace with a limit, got %d %+v", code, resp.Traces)
+	}
+	if code := getJSON(t, mux, "/api/traces?from=soon", &resp); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid from, got %d", code)
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	mux := setupTraces(t)
+
+	var resp traceResponse
+	if code := getJSON(t, mux, "/api/traces/t1", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+
+	if resp.DurationMs != 1000 || resp.MaxLevel != "error" {
+		t.Errorf("Unexpected trace %+v", resp)
+	}
+
+	if len(resp.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %+v", resp.Entries)
+	}
+	third := resp.Entries[2]
+	if third.Message != "query failed" || third.OffsetMs != 500 || third.DeltaMs != 250 {
+		t.Errorf("Unexpected entry %+v", third)
+	}
+
+	if len(resp.Spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %+v", resp.Spans)
+	}
+	root, child := resp.Spans[0], resp.Spans[1]
+	if root.SpanID != "a" || root.Depth != 0 || root.DurationMs != 1000 || root.Entries != 2 {
+		t.Errorf("Unexpected root span %+v", root)
+	}
+	if child.SpanID != "b" || child.ParentSpanID != "a" || child.Depth != 1 || child.DurationMs != 250 {
+		t.Errorf("Unexpected child span %+v", child)
+	}
+}
+
+func TestTraceHandler_NoSpans(t *testing.T) {
+	mux := setupTraces(t)
+
+	var resp traceResponse
+	if code := getJSON(t, mux, "/api/traces/t2", &resp); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Entries) != 1 || len(resp.Spans) != 0 {
+		t.Errorf("Expected one entry and no spans, got %+v", resp)
+	}
+
+	if code := getJSON(t, mux, "/api/traces/missing", &resp); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown trace, got %d", code)
+	}
+}
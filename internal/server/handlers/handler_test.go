@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,6 +11,8 @@ import (
 	"testing"
 
 	_ "github.com/marcboeker/go-duckdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server/handlers"
 )
 
@@ -71,3 +74,113 @@ func TestQueryHandlerMissingParam(t *testing.T) {
 		t.Errorf("Expected error in response, got: %s", w.Body.String())
 	}
 }
+
+func TestQueryHandlerFilter(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO logs (trace_id, level, message, raw, created_at) VALUES
+			('t1', 'info', 'started', '{}', CURRENT_TIMESTAMP),
+			('t2', 'error', 'timeout talking to db', '{}', CURRENT_TIMESTAMP),
+			('t3', 'error', 'disk full', '{}', CURRENT_TIMESTAMP)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without q, the filter selects whole rows.
+	r := httptest.NewRequest("GET", "/query?filter="+url.QueryEscape("level:ERROR -trace_id:t3"), nil)
+	w := httptest.NewRecorder()
+	handlers.QueryHandler(db, ctx)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "timeout talking to db") || strings.Contains(w.Body.String(), "disk full") {
+		t.Errorf("Expected only the matching error, got: %s", w.Body.String())
+	}
+
+	// With q, the query runs over the filtered logs.
+	q := url.QueryEscape("SELECT count(*) AS n FROM logs")
+	r = httptest.NewRequest("GET", "/query?q="+q+"&filter=level:error", nil)
+	w = httptest.NewRecorder()
+	handlers.QueryHandler(db, ctx)(w, r)
+
+	if !strings.Contains(w.Body.String(), `"n":2`) {
+		t.Errorf("Expected the query to count filtered logs, got: %s", w.Body.String())
+	}
+}
+
+func TestQueryHandlerFilterSyntaxError(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	r := httptest.NewRequest("GET", "/query?filter="+url.QueryEscape("(level:error"), nil)
+	w := httptest.NewRecorder()
+	handlers.QueryHandler(db, ctx)(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "column 1") {
+		t.Errorf("Expected the error position in response, got: %s", w.Body.String())
+	}
+}
+
+func TestQueryHandlerSearch(t *testing.T) {
+	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+	for _, line := range []string{
+		`{"level":"error","message":"timeout talking to db"}`,
+		`{"level":"info","message":"connected to db"}`,
+		`{"level":"error","message":"disk full"}`,
+	} {
+		if err := pipeline.Process(line, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var resp struct {
+		Data []struct {
+			Message    string            `json:"message"`
+			Highlights map[string]string `json:"highlights"`
+		} `json:"data"`
+	}
+	search := func(query string) int {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/query?mode=search&"+query, nil)
+		w := httptest.NewRecorder()
+		handlers.QueryHandler(db, ctx)(w, r)
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code
+	}
+
+	// Entries are found without waiting for the index to be refreshed.
+	if code := search("q=" + url.QueryEscape("DB timeout")); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Message != "timeout talking to db" {
+		t.Fatalf("Expected the best match first, got %+v", resp.Data)
+	}
+	if got := resp.Data[0].Highlights["message"]; got != "<mark>timeout</mark> talking to <mark>db</mark>" {
+		t.Errorf("Unexpected highlight %q", got)
+	}
+
+	if code := search("q=db&filter=level:info"); code != http.StatusOK || len(resp.Data) != 1 || resp.Data[0].Message != "connected to db" {
+		t.Errorf("Expected the filter to apply, got %d %+v", code, resp.Data)
+	}
+
+	for _, query := range []string{"q=" + url.QueryEscape("!!"), "q=db&filter=" + url.QueryEscape("(level"), "q=db&from=yesterday"} {
+		if code := search(query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
 )
 
 const maxLimit = 1000
@@ -17,16 +19,30 @@ const defaultLimit = 100
 
 func QueryHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		switch mode := r.URL.Query().Get("mode"); mode {
+		case "", "sql":
+		case "search":
+			searchQuery(db, w, r, ctx)
+			return
+		default:
+			http.Error(w, "unknown mode: "+mode, http.StatusBadRequest)
+			return
+		}
+
 		userQuery := r.URL.Query().Get("q")
 		pageStr := r.URL.Query().Get("page")
 		limitStr := r.URL.Query().Get("limit")
 		fromStr := r.URL.Query().Get("from")
 		toStr := r.URL.Query().Get("to")
+		filterStr := r.URL.Query().Get("filter")
 
-		if userQuery == "" {
+		if userQuery == "" && filterStr == "" {
 			http.Error(w, "missing q param", http.StatusBadRequest)
 			return
 		}
+		if userQuery == "" {
+			userQuery = "SELECT * FROM logs"
+		}
 
 		page, _ := strconv.Atoi(pageStr)
 		limit, err := strconv.Atoi(limitStr)
@@ -61,6 +77,22 @@ func QueryHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 			}
 		}
 
+		// The filter narrows down the logs the query sees, like the time range.
+		var filterArgs []any
+		if filterStr != "" {
+			condition, args, err := filter.Compile(filterStr)
+			if err != nil {
+				http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if timeFilter == "" {
+				timeFilter = "WHERE " + condition
+			} else {
+				timeFilter += " AND " + condition
+			}
+			filterArgs = args
+		}
+
 		hasOrderBy := strings.Contains(strings.ToLower(userQuery), "order by")
 
 		if err != nil || limit <= 0 {
@@ -80,7 +112,7 @@ func QueryHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 			SELECT COUNT(*) FROM q
 		`, timeFilter, userQuery)
 		var totalRows int
-		err = db.QueryRowContext(ctx, countQuery).Scan(&totalRows)
+		err = db.QueryRowContext(ctx, countQuery, filterArgs...).Scan(&totalRows)
 		if err != nil {
 			http.Error(w, "count query failed: "+err.Error(), http.StatusBadRequest)
 			return
@@ -107,7 +139,7 @@ func QueryHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 			offset,
 		)
 
-		rows, err := db.QueryContext(ctx, safeQuery)
+		rows, err := db.QueryContext(ctx, safeQuery, filterArgs...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
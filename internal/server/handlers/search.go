@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/filter"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
+)
+
+// snippetWidth is the length, in characters, of the excerpts in highlights.
+const snippetWidth = 160
+
+// searchQuery answers /query?mode=search, where q is a list of words rather
+// than SQL. Entries containing any of the words are ranked by BM25, and each
+// has highlights: excerpts of its message and raw_log with the words marked.
+func searchQuery(db *sql.DB, w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	terms := logdb.SearchTerms(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		http.Error(w, "missing search words in q param", http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	var where []string
+	var args []any
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s param: %v", bound.param, err), http.StatusBadRequest)
+			return
+		}
+		where = append(where, "l.created_at "+bound.op+" ?")
+		args = append(args, t.UTC())
+	}
+	if filterStr := r.URL.Query().Get("filter"); filterStr != "" {
+		condition, filterArgs, err := filter.Compile(filterStr)
+		if err != nil {
+			http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		where = append(where, condition)
+		args = append(args, filterArgs...)
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	// Index the entries added since the last refresh, so that they can be
+	// found straight away.
+	if _, err := logdb.RefreshRecentSearchIndex(db, ctx); err != nil {
+		http.Error(w, "failed to refresh search index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scores, scoreArgs := logdb.SearchScores(terms)
+	args = append(scoreArgs, args...)
+	from := fmt.Sprintf("FROM (%s) s JOIN logs l ON l.id = s.log_id %s", scores, whereClause)
+
+	var totalRows int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) "+from, args...).Scan(&totalRows); err != nil {
+		http.Error(w, "count query failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := fmt.Sprintf("SELECT l.*, s.score %s ORDER BY s.score DESC, l.created_at DESC LIMIT %d OFFSET %d", from, limit+1, page*limit)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer rows.Close()
+
+	cols, _ := rows.Columns()
+	results := []map[string]any{}
+
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range ptrs {
+			ptrs[i] = &vals[i]
+		}
+		rows.Scan(ptrs...)
+		row := map[string]any{}
+		for i, col := range cols {
+			row[col] = vals[i]
+		}
+
+		highlights := map[string]string{}
+		for _, col := range []string{"message", "raw_log"} {
+			text, _ := row[col].(string)
+			if snippet := logdb.Highlight(text, terms, snippetWidth); snippet != "" {
+				highlights[col] = snippet
+			}
+		}
+		row["highlights"] = highlights
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hasNext := len(results) > limit
+	if hasNext {
+		results = results[:limit]
+	}
+
+	resp := map[string]any{
+		"data": results,
+		"meta": map[string]any{
+			"hasNextPage":     hasNext,
+			"hasPreviousPage": page > 0,
+			"totalPages":      int(math.Ceil(float64(totalRows) / float64(limit))),
+			"page":            page,
+			"terms":           terms,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -6,14 +6,20 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
 	"github.com/paul-schwendenman/magic-log-ui/internal/shared"
 )
 
 var (
 	clients   = make(map[*websocket.Conn]bool)
 	clientsMu sync.Mutex
+
+	wsClients = metrics.NewGauge("magiclog_websocket_clients", "WebSocket clients currently connected.")
+	wsSent    = metrics.NewCounter("magiclog_websocket_messages_sent_total", "Log entries sent to WebSocket clients.")
+	wsDropped = metrics.NewCounter("magiclog_websocket_messages_dropped_total", "Log entries that could not be delivered to a WebSocket client.")
 )
 
 func WebSocketHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
@@ -32,6 +38,7 @@ func WebSocketHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 
 		clientsMu.Lock()
 		clients[conn] = true
+		wsClients.Set(int64(len(clients)))
 		clientsMu.Unlock()
 		log.Println("✅ WebSocket connected")
 
@@ -64,6 +71,7 @@ func WebSocketHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 					log.Println("👋 WebSocket disconnected")
 					clientsMu.Lock()
 					delete(clients, c)
+					wsClients.Set(int64(len(clients)))
 					clientsMu.Unlock()
 					c.Close()
 					return
@@ -74,13 +82,62 @@ func WebSocketHandler(db *sql.DB, ctx context.Context) http.HandlerFunc {
 }
 
 func Broadcast(entry shared.LogEntry) {
+	send(entry)
+}
+
+// Event is a notification sent to WebSocket clients alongside log entries,
+// such as an input closing. The _event key tells it apart from a log entry.
+type Event struct {
+	Event   string `json:"_event"`
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+
+	// For "repeated" events, the _repeat_id of the entry that was repeated
+	// and its total count so far.
+	ID          string     `json:"id,omitempty"`
+	RepeatCount int        `json:"repeat_count,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+}
+
+// Notify sends an event to every WebSocket client.
+func Notify(event Event) {
+	send(event)
+}
+
+// ClientCount returns the number of connected WebSocket clients.
+func ClientCount() int {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	return len(clients)
+}
+
+func send(v any) {
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 	for conn := range clients {
-		if err := conn.WriteJSON(entry); err != nil {
+		if err := conn.WriteJSON(v); err != nil {
+			wsDropped.Inc()
 			conn.Close()
 			delete(clients, conn)
+			wsClients.Set(int64(len(clients)))
 			log.Println("❌ Failed to write to WebSocket, removed client")
+			continue
 		}
+		wsSent.Inc()
+	}
+}
+
+// CloseClients disconnects every WebSocket client, telling them the server is
+// going away.
+func CloseClients() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range clients {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		conn.Close()
+		delete(clients, conn)
 	}
+	wsClients.Set(0)
 }
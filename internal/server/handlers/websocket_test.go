@@ -89,3 +89,46 @@ func TestWebSocketDisconnect(t *testing.T) {
 	c.Close()
 	time.Sleep(200 * time.Millisecond)
 }
+
+func TestWebSocketNotifyAndClose(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(handlers.WebSocketHandler(db, ctx)))
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+	c, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; handlers.ClientCount() == 0; i++ {
+		if i == 50 {
+			t.Fatal("client was not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	handlers.Notify(handlers.Event{Event: "input_closed", Source: "STDIN", Message: "STDIN closed"})
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if strings.Contains(string(msg), `"_event":"input_closed"`) {
+			break
+		}
+	}
+
+	handlers.CloseClients()
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected a going away close, got %v", err)
+	}
+	if n := handlers.ClientCount(); n != 0 {
+		t.Errorf("Expected no clients after closing, got %d", n)
+	}
+}
@@ -7,13 +7,60 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/paul-schwendenman/magic-log-ui/internal/alerts"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/metrics"
+	"github.com/paul-schwendenman/magic-log-ui/internal/saved"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server/api"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server/handlers"
 )
 
-func Start(port int, staticFiles embed.FS, db *sql.DB, ctx context.Context) {
-	http.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+var lastActivity atomic.Int64
+
+// unattended are the paths polled by monitoring, which do not count as
+// activity so that a Prometheus scrape does not keep magic-log running.
+var unattended = map[string]bool{
+	"/metrics":          true,
+	"/api/ingest/stats": true,
+}
+
+// trackActivity records when the last request was received.
+func trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !unattended[r.URL.Path] {
+			lastActivity.Store(time.Now().UnixNano())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LastActivity returns when the server last received a request other than a
+// monitoring poll, or the zero time if it has not received any.
+func LastActivity() time.Time {
+	n := lastActivity.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 5 * time.Second
+
+// Start serves the UI and API until ctx is cancelled, then stops accepting
+// connections, closes WebSocket clients and waits for in-flight requests.
+func Start(port int, staticFiles embed.FS, db *sql.DB, pipeline *ingest.Pipeline, ctx context.Context) error {
+	mux := http.NewServeMux()
+	alertStore := alerts.NewStore(db)
+	mux.HandleFunc("/api/alerts", api.AlertRulesHandler(alertStore, ctx))
+	mux.HandleFunc("/api/alerts/history", api.AlertHistoryHandler(alertStore, ctx))
+	mux.HandleFunc("/api/alerts/{id}", api.AlertRuleHandler(alertStore, ctx))
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			api.GetConfigHandler(w, r)
@@ -23,12 +70,56 @@ func Start(port int, staticFiles embed.FS, db *sql.DB, ctx context.Context) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	http.HandleFunc("/query", handlers.QueryHandler(db, ctx))
-	http.HandleFunc("/ws", handlers.WebSocketHandler(db, ctx))
-	http.HandleFunc("/", handlers.StaticHandler(staticFiles))
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFiles))))
+	mux.HandleFunc("/api/ingest", api.IngestHandler(pipeline, ctx))
+	mux.HandleFunc("/api/ingest/stats", api.IngestStatsHandler)
+	mux.HandleFunc("/api/fields", api.FieldsHandler(db, ctx))
+	mux.HandleFunc("/api/histogram", api.HistogramHandler(db, ctx))
+	store := saved.NewStore(db)
+	mux.HandleFunc("/api/saved-queries", api.SavedQueriesHandler(store, ctx))
+	mux.HandleFunc("/api/saved-queries/{id}", api.SavedQueryHandler(store, ctx))
+	mux.HandleFunc("/api/dashboards", api.DashboardsHandler(store, ctx))
+	mux.HandleFunc("/api/dashboards/{id}", api.DashboardHandler(store, ctx))
+	mux.HandleFunc("/api/saved/export", api.ExportSavedHandler(store, ctx))
+	mux.HandleFunc("/api/saved/import", api.ImportSavedHandler(store, ctx))
+	mux.HandleFunc("/api/templates", api.TemplatesHandler(db, ctx))
+	mux.HandleFunc("/api/traces", api.TracesHandler(db, ctx))
+	mux.HandleFunc("/api/traces/{trace_id}", api.TraceHandler(db, ctx))
+	mux.HandleFunc("/v1/logs", api.OTLPLogsHandler(pipeline, ctx))
+	mux.HandleFunc("/_cluster/health", api.ElasticClusterHealthHandler)
+	mux.HandleFunc("/loki/api/v1/push", api.LokiPushHandler(pipeline, ctx))
+	mux.HandleFunc("/metrics", metrics.Handler)
+	mux.HandleFunc("/query", handlers.QueryHandler(db, ctx))
+	mux.HandleFunc("/ws", handlers.WebSocketHandler(db, ctx))
+	bulkHandler := api.ElasticBulkHandler(pipeline, ctx)
+	staticHandler := handlers.StaticHandler(staticFiles)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Elasticsearch clients post to /_bulk or /<index>/_bulk.
+		if strings.HasSuffix(r.URL.Path, "/_bulk") {
+			bulkHandler(w, r)
+			return
+		}
+		staticHandler(w, r)
+	})
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFiles))))
 
 	addr := fmt.Sprintf(":%d", port)
 	log.Printf("🌐 Serving UI at http://localhost%s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	srv := &http.Server{Addr: addr, Handler: trackActivity(mux)}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("🛑 Stopping web server")
+	handlers.CloseClients()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
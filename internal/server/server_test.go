@@ -2,13 +2,14 @@ package server_test
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"testing"
+	"time"
 
 	"embed"
 
-	_ "github.com/marcboeker/go-duckdb"
+	"github.com/paul-schwendenman/magic-log-ui/internal/ingest"
+	"github.com/paul-schwendenman/magic-log-ui/internal/logdb"
 	"github.com/paul-schwendenman/magic-log-ui/internal/server"
 )
 
@@ -16,8 +17,9 @@ import (
 var fakeStatic embed.FS
 
 func TestServer_StartBasicRoutes(t *testing.T) {
-	db, _ := sql.Open("duckdb", "")
 	ctx := context.Background()
+	db := logdb.MustInit("", ctx)
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
 
 	// Dry-run to ensure nothing panics
 	go func() {
@@ -26,7 +28,7 @@ func TestServer_StartBasicRoutes(t *testing.T) {
 				t.Errorf("Server panicked: %v", r)
 			}
 		}()
-		server.Start(34567, fakeStatic, db, ctx)
+		server.Start(34567, fakeStatic, db, pipeline, ctx)
 	}()
 
 	// Give server time to boot
@@ -36,3 +38,41 @@ func TestServer_StartBasicRoutes(t *testing.T) {
 		t.Logf("Startup request succeeded with code %d", resp.StatusCode)
 	}
 }
+
+func TestServer_StartStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := logdb.MustInit("", ctx)
+	defer db.Close()
+	pipeline := ingest.NewPipeline(logdb.MustPrepareInsert(db, ctx), "json", "", "", "", false, false)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Start(34568, fakeStatic, db, pipeline, ctx)
+	}()
+
+	for i := 0; ; i++ {
+		resp, err := http.Get("http://localhost:34568/metrics")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+
+	if _, err := http.Get("http://localhost:34568/metrics"); err == nil {
+		t.Error("Expected the server to stop accepting connections")
+	}
+}
@@ -0,0 +1,206 @@
+// Package templates groups log messages into templates, such as
+// "connected to <*> in <*>", so the kinds of messages can be counted rather
+// than read one by one.
+//
+// Messages are clustered online with the Drain algorithm: messages are routed
+// through a tree by their length and first few tokens, then matched against
+// the templates at the leaf by the fraction of tokens they share. Tokens that
+// differ become wildcards.
+package templates
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Wildcard stands for the tokens that vary between messages in a template.
+const Wildcard = "<*>"
+
+const (
+	// prefixTokens is the number of leading tokens used to route messages.
+	// Messages often vary from their second token, as in "user bob ...".
+	prefixTokens = 1
+	// similarity is the fraction of tokens a message must share with a
+	// template to join it.
+	similarity = 0.5
+	// maxChildren bounds the branches of each tree node. Further tokens are
+	// routed through a wildcard branch.
+	maxChildren = 100
+	// maxTokens bounds the length of messages that are clustered, as very long
+	// messages are rarely repeated and costly to compare.
+	maxTokens = 200
+)
+
+// Miner assigns templates to messages. It is safe for concurrent use.
+type Miner struct {
+	mu sync.Mutex
+	// root holds a tree for each message length.
+	root map[int]*node
+	// changed holds the templates created or generalized since the last call
+	// to Changes.
+	changed map[string]*cluster
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*cluster
+}
+
+type cluster struct {
+	id     string
+	tokens []string
+}
+
+func NewMiner() *Miner {
+	return &Miner{root: map[int]*node{}, changed: map[string]*cluster{}}
+}
+
+// Match returns the template a message belongs to and its id, creating a new
+// template if no existing one is similar enough. Ids do not change as a
+// template becomes more general. Messages without any tokens, or with too
+// many, have no template.
+func (m *Miner) Match(message string) (id, template string) {
+	tokens := tokenize(message)
+	if len(tokens) == 0 || len(tokens) > maxTokens {
+		return "", ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.leaf(tokens)
+
+	var best *cluster
+	bestScore, bestWildcards := -1.0, 0
+	for _, c := range leaf.clusters {
+		score, wildcards := compare(c.tokens, tokens)
+		if score > bestScore || (score == bestScore && wildcards > bestWildcards) {
+			best, bestScore, bestWildcards = c, score, wildcards
+		}
+	}
+
+	if best != nil && bestScore >= similarity {
+		if best.merge(tokens) {
+			m.changed[best.id] = best
+		}
+		return best.id, best.template()
+	}
+
+	c := &cluster{id: newID(tokens), tokens: tokens}
+	leaf.clusters = append(leaf.clusters, c)
+	m.changed[c.id] = c
+	return c.id, c.template()
+}
+
+// Load adds a template mined earlier, such as before a restart, so that
+// messages join it rather than starting over from a less general template.
+func (m *Miner) Load(id, template string) {
+	tokens := strings.Fields(template)
+	if len(tokens) == 0 || len(tokens) > maxTokens {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.leaf(tokens)
+	for _, c := range leaf.clusters {
+		if c.id == id {
+			return
+		}
+	}
+	leaf.clusters = append(leaf.clusters, &cluster{id: id, tokens: tokens})
+}
+
+// Changes returns the current text of the templates created or generalized
+// since it was last called, by id.
+func (m *Miner) Changes() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := make(map[string]string, len(m.changed))
+	for id, c := range m.changed {
+		changes[id] = c.template()
+	}
+	clear(m.changed)
+	return changes
+}
+
+func (m *Miner) leaf(tokens []string) *node {
+	n, ok := m.root[len(tokens)]
+	if !ok {
+		n = &node{children: map[string]*node{}}
+		m.root[len(tokens)] = n
+	}
+
+	for _, token := range tokens[:min(prefixTokens, len(tokens))] {
+		child, ok := n.children[token]
+		if !ok {
+			if len(n.children) >= maxChildren {
+				token = Wildcard
+				child = n.children[token]
+			}
+			if child == nil {
+				child = &node{children: map[string]*node{}}
+				n.children[token] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// compare returns the fraction of tokens a message shares with a template,
+// counting wildcards as matches, and the number of wildcards.
+func compare(template, tokens []string) (float64, int) {
+	matched, wildcards := 0, 0
+	for i, t := range template {
+		switch {
+		case t == Wildcard:
+			matched++
+			wildcards++
+		case t == tokens[i]:
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(template)), wildcards
+}
+
+// merge generalizes the template to cover a message, reporting whether it
+// changed.
+func (c *cluster) merge(tokens []string) bool {
+	changed := false
+	for i, t := range c.tokens {
+		if t != Wildcard && t != tokens[i] {
+			c.tokens[i] = Wildcard
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (c *cluster) template() string {
+	return strings.Join(c.tokens, " ")
+}
+
+// tokenize splits a message on whitespace, replacing tokens that contain
+// digits, such as ids, counts and durations, with wildcards up front.
+func tokenize(message string) []string {
+	tokens := strings.Fields(message)
+	for i, t := range tokens {
+		if strings.ContainsFunc(t, unicode.IsDigit) {
+			tokens[i] = Wildcard
+		}
+	}
+	return tokens
+}
+
+// newID derives an id from the first message in a template, so the same
+// message starts the same template after a restart.
+func newID(tokens []string) string {
+	sum := sha1.Sum([]byte(strings.Join(tokens, " ")))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,96 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/paul-schwendenman/magic-log-ui/internal/templates"
+)
+
+func TestMiner_Match(t *testing.T) {
+	m := templates.NewMiner()
+
+	id1, tmpl := m.Match("user alice logged in from web")
+	if tmpl != "user alice logged in from web" {
+		t.Errorf("Expected the first message as its own template, got %q", tmpl)
+	}
+
+	id2, tmpl := m.Match("user bob logged in from mobile")
+	if id2 != id1 {
+		t.Errorf("Expected a similar message to join the template, got ids %s and %s", id1, id2)
+	}
+	if tmpl != "user <*> logged in from <*>" {
+		t.Errorf("Unexpected template %q", tmpl)
+	}
+
+	id3, tmpl := m.Match("cache miss for key session")
+	if id3 == id1 {
+		t.Error("Expected a different message to start a new template")
+	}
+	if tmpl != "cache miss for key session" {
+		t.Errorf("Unexpected template %q", tmpl)
+	}
+}
+
+func TestMiner_MasksNumbers(t *testing.T) {
+	m := templates.NewMiner()
+
+	id1, tmpl := m.Match("retry 3 in 200ms")
+	id2, _ := m.Match("retry 4 in 400ms")
+	if id1 != id2 || tmpl != "retry <*> in <*>" {
+		t.Errorf("Expected numbers to be wildcards, got %q (%s, %s)", tmpl, id1, id2)
+	}
+
+	// Ids depend only on the first message, not on the order of the miner.
+	other := templates.NewMiner()
+	other.Match("something else entirely")
+	if id, _ := other.Match("retry 9 in 1s"); id != id1 {
+		t.Errorf("Expected a stable id, got %s and %s", id1, id)
+	}
+}
+
+func TestMiner_DifferentLengths(t *testing.T) {
+	m := templates.NewMiner()
+
+	id1, _ := m.Match("GET /health")
+	id2, _ := m.Match("GET /health 200")
+	if id1 == id2 {
+		t.Error("Expected messages of different lengths to have different templates")
+	}
+
+	if id, tmpl := m.Match("   "); id != "" || tmpl != "" {
+		t.Errorf("Expected no template for an empty message, got %q", tmpl)
+	}
+}
+
+func TestMiner_Changes(t *testing.T) {
+	m := templates.NewMiner()
+
+	id, _ := m.Match("user alice logged in")
+	if changes := m.Changes(); changes[id] != "user alice logged in" {
+		t.Errorf("Expected a new template to be a change, got %v", changes)
+	}
+
+	m.Match("user bob logged in")
+	m.Match("user carol logged in")
+	if changes := m.Changes(); len(changes) != 1 || changes[id] != "user <*> logged in" {
+		t.Errorf("Expected the generalized template, got %v", changes)
+	}
+
+	m.Match("user dave logged in")
+	if changes := m.Changes(); len(changes) != 0 {
+		t.Errorf("Expected no changes once the template covers a message, got %v", changes)
+	}
+}
+
+func TestMiner_Load(t *testing.T) {
+	m := templates.NewMiner()
+	m.Load("abc123", "user <*> logged in from <*>")
+
+	id, tmpl := m.Match("user alice logged in from web")
+	if id != "abc123" || tmpl != "user <*> logged in from <*>" {
+		t.Errorf("Expected the message to join the loaded template, got %s %q", id, tmpl)
+	}
+	if changes := m.Changes(); len(changes) != 0 {
+		t.Errorf("Expected joining a loaded template not to change it, got %v", changes)
+	}
+}
@@ -25,6 +25,12 @@ export function createBufferedLogsStore<T>({ max = 500, flushInterval = 50 } = {
 		}
 	}
 
+	// Replaces entries in place, both shown and still buffered.
+	function map(fn: (entry: T) => T) {
+		logs.update((l) => l.map(fn));
+		buffer.update((b) => b.map(fn));
+	}
+
 	function clearLogs() {
 		logs.set([]);
 	}
@@ -40,6 +46,7 @@ export function createBufferedLogsStore<T>({ max = 500, flushInterval = 50 } = {
 	return {
 		subscribe: logs.subscribe,
 		add,
+		map,
 		clearLogs,
 		clearBuffer,
 		setPaused,
@@ -1,11 +1,12 @@
 import { browser } from '$app/environment';
 import { derived, writable } from 'svelte/store';
 import { createBufferedLogsStore } from '$lib/stores/bufferedArrayStore';
-import type { LogEntry } from '$lib/types';
+import type { LogEntry, StreamEvent } from '$lib/types';
 import { useWebSocket } from '$lib/useWebSocket';
 
 export const liveFilter = writable('');
 export const paused = writable(false);
+export const inputClosed = writable<StreamEvent | null>(null);
 export const liveLogs = createBufferedLogsStore<LogEntry>({
 	max: 1_000,
 	flushInterval: 100
@@ -28,8 +29,17 @@ paused.subscribe((p) => liveLogs.setPaused(p));
 if (browser) {
 	useWebSocket(`ws://${location.host}/ws`, {
 		onMessage: (data) => {
-			const { timestamp, trace_id, level, message, ...rest } = data;
+			if ('_event' in data) {
+				if (data._event === 'input_closed') inputClosed.set(data);
+				if (data._event === 'repeated') {
+					const { id, repeat_count, last_seen } = data;
+					liveLogs.map((log) => (log.id === id ? { ...log, repeat_count, last_seen } : log));
+				}
+				return;
+			}
+			const { _repeat_id, timestamp, trace_id, level, message, ...rest } = data;
 			const log: LogEntry = {
+				id: _repeat_id,
 				timestamp,
 				trace_id,
 				level,
@@ -68,6 +68,7 @@ export const createQueryStore = ({
 	const pageStore = writable(initialPage);
 	const limitStore = writable(initialLimit);
 	const queryStore = writable(initialQuery);
+	const filterStore = writable('');
 	const loading = writable(false);
 
 	const timeRangeStore = writable<TimeRange>({
@@ -76,15 +77,16 @@ export const createQueryStore = ({
 	});
 
 	queryStore.subscribe(() => pageStore.set(0));
+	filterStore.subscribe(() => pageStore.set(0));
 	limitStore.subscribe(() => pageStore.set(0));
 	timeRangeStore.subscribe(() => pageStore.set(0));
 
 	const results = derived<
-		[Readable<number>, Readable<number>, Readable<string>, Readable<TimeRange>],
+		[Readable<number>, Readable<number>, Readable<string>, Readable<string>, Readable<TimeRange>],
 		QueryResult<any>
 	>(
-		[pageStore, limitStore, queryStore, timeRangeStore],
-		([$pageStore, $limitStore, $queryStore, $timeRangeStore], set) => {
+		[pageStore, limitStore, queryStore, filterStore, timeRangeStore],
+		([$pageStore, $limitStore, $queryStore, $filterStore, $timeRangeStore], set) => {
 			const query = new URLSearchParams({
 				q: $queryStore,
 				limit: $limitStore.toString(),
@@ -92,6 +94,9 @@ export const createQueryStore = ({
 				from: $timeRangeStore.from.toISOString(),
 				to: $timeRangeStore.to.toISOString()
 			});
+			if ($filterStore.trim()) {
+				query.set('filter', $filterStore);
+			}
 
 			fetchQuery(`/query?${query.toString()}`, loading).then((r) => set({ ...r }));
 		},
@@ -113,6 +118,7 @@ export const createQueryStore = ({
 	return {
 		subscribe: results.subscribe,
 		setQuery: queryStore.set,
+		setFilter: filterStore.set,
 		setLimit: limitStore.set,
 		setTimeRange: timeRangeStore.set,
 		page: pageStore,
@@ -5,6 +5,19 @@ export type LogEntry = {
 	level?: string;
 	message?: string;
 	raw?: any;
+	// Set on live entries when later lines were collapsed into them.
+	repeat_count?: number;
+	last_seen?: string;
+};
+
+// Sent over the WebSocket alongside log entries, told apart by the _event key.
+export type StreamEvent = {
+	_event: string;
+	source?: string;
+	message: string;
+	id?: string;
+	repeat_count?: number;
+	last_seen?: string;
 };
 
 export type TimeRange = {